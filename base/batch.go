@@ -0,0 +1,181 @@
+package base
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"github.com/walegarrett/cpk-algs/base/edwards25519"
+	"golang.org/x/crypto/blake2b"
+	"sort"
+)
+
+// SignatureR is the signature of Sign in the encoding R || s, which carries the commitment R
+// instead of the challenge c so that many signatures can be verified in one batch
+//
+// 与 Signature 是同一个签名的两种编码：c = blake2b512(R || A || m)，R = sB - cA
+type SignatureR struct {
+	r *edwards25519.Point
+	// R 的编码，计算挑战值时不必再次求逆
+	encodedR [32]byte
+	s        *edwards25519.Scalar
+}
+
+func (sig *SignatureR) SerializedByteSize() int64 {
+	return 64
+}
+
+func (sig *SignatureR) Bytes() []byte {
+	buf := make([]byte, 0, 64)
+	buf = append(buf, sig.encodedR[:]...)
+	return append(buf, sig.s.Bytes()...)
+}
+
+// SetBytes decodes R || s, only the canonical encodings of R and s are accepted
+func (sig *SignatureR) SetBytes(x []byte) (err error) {
+	if len(x) != 64 {
+		return errors.New("bad signature length")
+	}
+	R, err := (&edwards25519.Point{}).SetBytes(x[:32])
+	if err != nil {
+		return
+	}
+	// 拒绝 y 坐标的非规范编码，保证编码与点一一对应
+	if string(R.Bytes()) != string(x[:32]) {
+		return errors.New("non-canonical signature commitment")
+	}
+	s, err := (&edwards25519.Scalar{}).SetCanonicalBytes(x[32:])
+	if err != nil {
+		return
+	}
+	sig.r, sig.s = R, s
+	copy(sig.encodedR[:], x[:32])
+	return nil
+}
+
+// SignR signs the message like Sign and returns the signature in the encoding R || s
+func (p *PrivateKey) SignR(m []byte) *SignatureR {
+	R, s, _ := p.sign(signModePlain, nil, nil, m)
+	sig := &SignatureR{r: R, s: s}
+	copy(sig.encodedR[:], R.Bytes())
+	return sig
+}
+
+// signChallenge returns the challenge c = blake2b512(prefix || R || A || m) of a signature
+func signChallenge(prefix, R []byte, A *edwards25519.Point, m []byte) *edwards25519.Scalar {
+	hash, err := blake2b.New512(nil)
+	if err != nil {
+		panic(err)
+	}
+	hash.Write(prefix)
+	hash.Write(R)
+	hash.Write(A.Bytes())
+	hash.Write(m)
+	return (&edwards25519.Scalar{}).SetUniformBytes(hash.Sum(nil))
+}
+
+// VerifyR verifies a signature in the encoding R || s with the cofactored equation
+// [8](sB - R - cA) = 0, the same equation VerifyBatch checks, so both always agree
+//
+// 带余因子的验证接受 R 附加小阶分量的签名，同一消息可能存在多个有效签名，
+// 需要签名唯一性的场景应使用 Verify
+func (p *PublicKey) VerifyR(m []byte, sig *SignatureR) bool {
+	if p.Point == nil || sig == nil || sig.r == nil {
+		return false
+	}
+	c := signChallenge(nil, sig.encodedR[:], p.Point, m)
+	check := (&edwards25519.Point{}).VarTimeDoubleScalarBaseMult(c, (&edwards25519.Point{}).Negate(p.Point), sig.s)
+	check.Subtract(check, sig.r)
+	return check.MultByCofactor(check).Equal(edwards25519.NewIdentityPoint()) == 1
+}
+
+// ErrBatchVerify reports the entries of a batch whose signatures are invalid
+type ErrBatchVerify struct {
+	// 无效签名的下标，升序排列
+	Invalid []int
+}
+
+func (e *ErrBatchVerify) Error() string {
+	return fmt.Sprintf("batch verify: %d invalid signatures, first at %d", len(e.Invalid), e.Invalid[0])
+}
+
+// batchEntry is a signature of the batch with its challenge precomputed
+type batchEntry struct {
+	index int
+	A, R  *edwards25519.Point
+	s, c  *edwards25519.Scalar
+}
+
+// VerifyBatch verifies sigs[i] of msgs[i] under pks[i] for every i, it returns nil if all the
+// signatures are valid and *ErrBatchVerify listing the invalid entries otherwise
+//
+// 用随机的 128 位系数 z_i 检查 [8](Σz_i·s_i·B - Σz_i·R_i - Σz_i·c_i·A_i) = 0，一次多标量乘法
+// 验证整批签名；失败时二分查找，只对失败的一半递归，定位出所有无效的签名
+func VerifyBatch(pks []PublicKey, msgs [][]byte, sigs []*SignatureR) error {
+	if len(pks) != len(msgs) || len(pks) != len(sigs) {
+		return errors.New("batch verify: length mismatch")
+	}
+	entries := make([]batchEntry, 0, len(sigs))
+	var invalid []int
+	for i := range sigs {
+		sig := sigs[i]
+		if pks[i].Point == nil || sig == nil || sig.r == nil {
+			invalid = append(invalid, i)
+			continue
+		}
+		entries = append(entries, batchEntry{
+			index: i,
+			A:     pks[i].Point,
+			R:     sig.r,
+			s:     sig.s,
+			c:     signChallenge(nil, sig.encodedR[:], pks[i].Point, msgs[i]),
+		})
+	}
+	invalid = bisectBatch(entries, invalid)
+	if len(invalid) > 0 {
+		sort.Ints(invalid)
+		return &ErrBatchVerify{Invalid: invalid}
+	}
+	return nil
+}
+
+// bisectBatch appends the indices of the invalid entries to invalid
+func bisectBatch(entries []batchEntry, invalid []int) []int {
+	if len(entries) == 0 || verifyEntries(entries) {
+		return invalid
+	}
+	if len(entries) == 1 {
+		return append(invalid, entries[0].index)
+	}
+	half := len(entries) / 2
+	invalid = bisectBatch(entries[:half], invalid)
+	return bisectBatch(entries[half:], invalid)
+}
+
+// verifyEntries checks the random linear combination of the entries' equations
+func verifyEntries(entries []batchEntry) bool {
+	scalars := make([]*edwards25519.Scalar, 0, 2*len(entries)+1)
+	points := make([]*edwards25519.Point, 0, 2*len(entries)+1)
+	sum := edwards25519.NewScalar()
+	var buf [32]byte
+	for i := range entries {
+		// 系数只取 128 位，缩短一半的 NAF 展开，伪造者猜中的概率为 2^-128
+		if _, err := rand.Read(buf[:16]); err != nil {
+			panic(err)
+		}
+		z, err := edwards25519.NewScalar().SetCanonicalBytes(buf[:])
+		if err != nil {
+			panic(err)
+		}
+		sum.MultiplyAdd(z, entries[i].s, sum)
+		// 取反的是点而不是 z，保持 R_i 的系数只有 128 位
+		scalars = append(scalars, z)
+		points = append(points, (&edwards25519.Point{}).Negate(entries[i].R))
+		zc := edwards25519.NewScalar().Multiply(z, entries[i].c)
+		scalars = append(scalars, zc.Negate(zc))
+		points = append(points, entries[i].A)
+	}
+	scalars = append(scalars, sum)
+	points = append(points, edwards25519.NewGeneratorPoint())
+	check := (&edwards25519.Point{}).VarTimeMultiScalarMult(scalars, points)
+	return check.MultByCofactor(check).Equal(edwards25519.NewIdentityPoint()) == 1
+}
@@ -0,0 +1,107 @@
+package base
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/require"
+	"github.com/walegarrett/cpk-algs/base/edwards25519"
+	"testing"
+)
+
+func newBatch(n int) ([]PublicKey, [][]byte, []*SignatureR) {
+	pks := make([]PublicKey, n)
+	msgs := make([][]byte, n)
+	sigs := make([]*SignatureR, n)
+	for i := 0; i < n; i++ {
+		priv := RandomPrivateKey()
+		pks[i] = priv.Public()
+		msgs[i] = []byte(fmt.Sprintf("log line %d", i))
+		sigs[i] = priv.SignR(msgs[i])
+	}
+	return pks, msgs, sigs
+}
+
+func TestPrivateKey_SignR(t *testing.T) {
+	priv := RandomPrivateKey()
+	pub := priv.Public()
+	m := []byte("123456")
+	sig := priv.SignR(m)
+	require.True(t, pub.VerifyR(m, sig))
+	require.False(t, pub.VerifyR([]byte("123457"), sig))
+
+	// 两种编码是同一个签名：R = sB - cA
+	compact := priv.Sign(m)
+	require.True(t, pub.Verify(m, compact))
+	require.Equal(t, 1, sig.s.Equal(compact.s))
+	R := (&edwards25519.Point{}).VarTimeDoubleScalarBaseMult(compact.c, (&edwards25519.Point{}).Negate(pub.Point), compact.s)
+	require.Equal(t, 1, sig.r.Equal(R))
+
+	var decoded SignatureR
+	require.NoError(t, decoded.SetBytes(sig.Bytes()))
+	require.True(t, pub.VerifyR(m, &decoded))
+	require.Error(t, decoded.SetBytes(sig.Bytes()[1:]))
+	// y = p 是 0 的非规范编码
+	nonCanonical := append([]byte{0xed}, make([]byte, 63)...)
+	for i := 1; i < 31; i++ {
+		nonCanonical[i] = 0xff
+	}
+	nonCanonical[31] = 0x7f
+	require.Error(t, decoded.SetBytes(nonCanonical))
+}
+
+func TestVerifyBatch(t *testing.T) {
+	pks, msgs, sigs := newBatch(64)
+	require.NoError(t, VerifyBatch(pks, msgs, sigs))
+	require.NoError(t, VerifyBatch(nil, nil, nil))
+	require.Error(t, VerifyBatch(pks, msgs[1:], sigs))
+
+	// 篡改消息、换用别人的签名、缺失签名
+	msgs[3] = []byte("forged")
+	sigs[17], sigs[18] = sigs[18], sigs[17]
+	sigs[40] = nil
+	pks[63] = PublicKey{}
+	err := VerifyBatch(pks, msgs, sigs)
+	var batchErr *ErrBatchVerify
+	require.ErrorAs(t, err, &batchErr)
+	require.Equal(t, []int{3, 17, 18, 40, 63}, batchErr.Invalid)
+}
+
+func TestVerifyBatch_MatchesVerifyR(t *testing.T) {
+	// y = -1 是 2 阶点
+	torsion, err := (&edwards25519.Point{}).SetBytes([]byte{
+		0xec, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+		0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x7f})
+	require.NoError(t, err)
+
+	priv := RandomPrivateKey()
+	pub := priv.Public()
+	m := []byte("123456")
+	sig := priv.SignR(m)
+	// 公钥附加小阶分量时，带余因子的方程仍然成立，单个验证与批量验证结论一致
+	tainted := PublicKey{Point: (&edwards25519.Point{}).Add(pub.Point, torsion)}
+	R, s, _ := (&PrivateKey{Scalar: priv.Scalar, pk: tainted, initialized: true}).sign(signModePlain, nil, nil, m)
+	taintedSig := &SignatureR{r: R, s: s}
+	copy(taintedSig.encodedR[:], R.Bytes())
+	require.True(t, tainted.VerifyR(m, taintedSig))
+	require.NoError(t, VerifyBatch([]PublicKey{pub, tainted}, [][]byte{m, m}, []*SignatureR{sig, taintedSig}))
+
+	// R 附加小阶分量会改变挑战值，两者都拒绝
+	forged := &SignatureR{r: (&edwards25519.Point{}).Add(sig.r, torsion), s: sig.s}
+	copy(forged.encodedR[:], forged.r.Bytes())
+	require.False(t, pub.VerifyR(m, forged))
+	var batchErr *ErrBatchVerify
+	require.ErrorAs(t, VerifyBatch([]PublicKey{pub, pub}, [][]byte{m, m}, []*SignatureR{sig, forged}), &batchErr)
+	require.Equal(t, []int{1}, batchErr.Invalid)
+}
+
+func BenchmarkVerifyBatch(b *testing.B) {
+	for _, n := range []int{1, 64, 1024} {
+		pks, msgs, sigs := newBatch(n)
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if err := VerifyBatch(pks, msgs, sigs); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
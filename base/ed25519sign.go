@@ -0,0 +1,92 @@
+package base
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/sha512"
+	"errors"
+	"github.com/walegarrett/cpk-algs/base/edwards25519"
+	"io"
+)
+
+// RFC 8032 签名随机数前缀的域标签，CPK 私钥没有种子，前缀由标量派生
+const ed25519PrefixTag = "cpk-ed25519-prefix-v1"
+
+// ed25519Prefix derives the nonce prefix of RFC 8032 signatures from the scalar
+func (p *PrivateKey) ed25519Prefix() [32]byte {
+	hash := sha512.New()
+	hash.Write([]byte(ed25519PrefixTag))
+	hash.Write(p.Scalar.Bytes())
+	var prefix [32]byte
+	copy(prefix[:], hash.Sum(nil))
+	return prefix
+}
+
+// SignEd25519 returns the RFC 8032 Ed25519 signature R || S of the message, which
+// crypto/ed25519.Verify accepts with PublicKey.Bytes
+func (p *PrivateKey) SignEd25519(m []byte) []byte {
+	p.initialize()
+	prefix := p.ed25519Prefix()
+	hash := sha512.New()
+	hash.Write(prefix[:])
+	hash.Write(m)
+	r := (&edwards25519.Scalar{}).SetUniformBytes(hash.Sum(nil))
+	R := (&edwards25519.Point{}).ScalarBaseMult(r)
+
+	hash.Reset()
+	hash.Write(R.Bytes())
+	hash.Write(p.pk.Bytes())
+	hash.Write(m)
+	k := (&edwards25519.Scalar{}).SetUniformBytes(hash.Sum(nil))
+	S := (&edwards25519.Scalar{}).MultiplyAdd(k, p.Scalar, r)
+
+	sig := make([]byte, 0, ed25519.SignatureSize)
+	sig = append(sig, R.Bytes()...)
+	return append(sig, S.Bytes()...)
+}
+
+// VerifyEd25519 verifies an RFC 8032 Ed25519 signature of the message
+func (p *PublicKey) VerifyEd25519(m []byte, sig []byte) bool {
+	return ed25519.Verify(p.Bytes(), m, sig)
+}
+
+// Ed25519PublicKey returns the public key in the form of crypto/ed25519
+func (p *PublicKey) Ed25519PublicKey() ed25519.PublicKey {
+	return p.Bytes()
+}
+
+// ed25519Signer signs with RFC 8032 Ed25519 for the standard library
+type ed25519Signer struct {
+	priv *PrivateKey
+}
+
+// Signer returns the key as a crypto.Signer producing RFC 8032 Ed25519 signatures, so it
+// can sign X.509 certificates and TLS handshakes
+//
+// PrivateKey 自身的 Public 与 Sign 方法签名与 crypto.Signer 不同，因此通过适配器实现
+func (p *PrivateKey) Signer() crypto.Signer {
+	return ed25519Signer{priv: p}
+}
+
+func (signer ed25519Signer) Public() crypto.PublicKey {
+	pub := signer.priv.Public()
+	return pub.Ed25519PublicKey()
+}
+
+// Sign signs the message itself as crypto/ed25519 does, opts must be crypto.Hash(0) or
+// *ed25519.Options without hash and context, Ed25519ph and Ed25519ctx are not supported
+func (signer ed25519Signer) Sign(rand io.Reader, message []byte, opts crypto.SignerOpts) ([]byte, error) {
+	if options, ok := opts.(*ed25519.Options); ok {
+		// 带上下文的签名无法用纯 Ed25519 验证，拒绝而不是忽略上下文
+		if options.Context != "" {
+			return nil, errors.New("ed25519: Ed25519ctx is not supported")
+		}
+		if options.Hash != crypto.Hash(0) {
+			return nil, errors.New("ed25519: Ed25519ph is not supported")
+		}
+	}
+	if opts.HashFunc() != crypto.Hash(0) {
+		return nil, errors.New("ed25519: cannot sign hashed message")
+	}
+	return signer.priv.SignEd25519(message), nil
+}
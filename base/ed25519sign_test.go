@@ -0,0 +1,91 @@
+package base
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha512"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"github.com/stretchr/testify/require"
+	"github.com/walegarrett/cpk-algs/base/edwards25519"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func TestPrivateKey_SignEd25519(t *testing.T) {
+	var buf [64]byte
+	for i := range buf {
+		buf[i] = byte(i)
+	}
+	priv := PrivateKey{Scalar: (&edwards25519.Scalar{}).SetUniformBytes(buf[:])}
+	pub := priv.Public()
+	require.Equal(t, "f9302fcb3a2937cff4950e4c6272340e171b0a65ed680d8fca72087ab4da078d", hex.EncodeToString(pub.Bytes()))
+	// 前缀派生方式固定后签名是确定的
+	sig := priv.SignEd25519([]byte("cpk"))
+	require.Equal(t, "d4e9d25c30b6ef215b92d124abd7a89da50ebec75e66d8a27de7401ec2da63d1"+
+		"edcef8b14c58a63204f25849d66afcbf2e980b2997381f569c19ffe46e432401", hex.EncodeToString(sig))
+	require.True(t, ed25519.Verify(pub.Bytes(), []byte("cpk"), sig))
+	require.True(t, pub.VerifyEd25519([]byte("cpk"), sig))
+	require.False(t, pub.VerifyEd25519([]byte("cpK"), sig))
+
+	for i := 0; i < 16; i++ {
+		priv := RandomPrivateKey()
+		pub := priv.Public()
+		m := make([]byte, i*7)
+		_, err := rand.Read(m)
+		require.NoError(t, err)
+		require.True(t, ed25519.Verify(pub.Ed25519PublicKey(), m, priv.SignEd25519(m)))
+	}
+}
+
+func TestPrivateKey_SignEd25519WithSeedKey(t *testing.T) {
+	// RFC 8032 7.1 TEST 1 的种子，按标准方式展开为标量后公钥一致
+	seed, err := hex.DecodeString("9d61b19deffd5a60ba844af492ec2cc44449c5697b326919703bac031cae7f60")
+	require.NoError(t, err)
+	digest := sha512.Sum512(seed)
+	digest[0] &= 248
+	digest[31] &= 127
+	digest[31] |= 64
+	var wide [64]byte
+	copy(wide[:], digest[:32])
+	priv := PrivateKey{Scalar: (&edwards25519.Scalar{}).SetUniformBytes(wide[:])}
+	pub := priv.Public()
+	require.Equal(t, "d75a980182b10ab7d54bfed3c964073a0ee172f3daa62325af021a68f707511a", hex.EncodeToString(pub.Bytes()))
+	std := ed25519.NewKeyFromSeed(seed)
+	require.Equal(t, std.Public(), priv.Signer().Public())
+	require.True(t, ed25519.Verify(std.Public().(ed25519.PublicKey), nil, priv.SignEd25519(nil)))
+}
+
+func TestPrivateKey_Signer(t *testing.T) {
+	priv := RandomPrivateKey()
+	signer := priv.Signer()
+	_, err := signer.Sign(rand.Reader, make([]byte, 32), crypto.SHA256)
+	require.Error(t, err)
+	_, err = signer.Sign(rand.Reader, []byte("message"), &ed25519.Options{Context: "context"})
+	require.Error(t, err)
+	_, err = signer.Sign(rand.Reader, make([]byte, 64), &ed25519.Options{Hash: crypto.SHA512})
+	require.Error(t, err)
+	sig, err := signer.Sign(rand.Reader, []byte("message"), &ed25519.Options{})
+	require.NoError(t, err)
+	pub := priv.Public()
+	require.True(t, ed25519.Verify(pub.Ed25519PublicKey(), []byte("message"), sig))
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "alice"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, signer.Public(), signer)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	require.NoError(t, cert.CheckSignatureFrom(cert))
+	require.Equal(t, pub.Ed25519PublicKey(), cert.PublicKey)
+}
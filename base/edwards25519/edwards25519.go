@@ -270,6 +270,42 @@ func (v *Point) Subtract(p, q *Point) *Point {
 	return v.fromP1xP1(result)
 }
 
+// AffineCached is a point precomputed in the affine cached form used by the
+// base point tables. Adding it to a Point skips the conversion and one field
+// multiplication of Add, which pays off when the same point is added many times.
+//
+// The zero value is not a valid point, use FromPoint to set it.
+type AffineCached struct {
+	c affineCached
+}
+
+// FromPoint sets v = p, and returns v. It costs one field inversion.
+func (v *AffineCached) FromPoint(p *Point) *AffineCached {
+	checkInitialized(p)
+	v.c.FromP3(p)
+	return v
+}
+
+// AddAffineCached sets v = p + q, and returns v.
+func (v *Point) AddAffineCached(p *Point, q *AffineCached) *Point {
+	checkInitialized(p)
+	result := new(projP1xP1).AddAffine(p, &q.c)
+	return v.fromP1xP1(result)
+}
+
+// SumAffineCached sets v to the sum of table[i] for every i in indices, and
+// returns v. The sum is accumulated in a single scratch completed point without
+// allocating or checking v on every addition, which makes it cheaper than
+// repeated calls to AddAffineCached.
+func (v *Point) SumAffineCached(table []AffineCached, indices []int) *Point {
+	var sum projP1xP1
+	v.Set(NewIdentityPoint())
+	for _, i := range indices {
+		v.fromP1xP1(sum.AddAffine(v, &table[i].c))
+	}
+	return v
+}
+
 func (v *projP1xP1) Add(p *Point, q *projCached) *projP1xP1 {
 	var YplusX, YminusX, PP, MM, TT2d, ZZ2 field.Element
 
@@ -11,6 +11,7 @@ import (
 	"reflect"
 	"strings"
 	"testing"
+	"testing/quick"
 )
 
 var B = NewGeneratorPoint()
@@ -88,6 +89,48 @@ func TestAddSubNegOnBasePoint(t *testing.T) {
 	checkOnCurve(t, checkLhs, checkRhs, Bneg)
 }
 
+func TestAddAffineCached(t *testing.T) {
+	addAffineCachedMatchesAdd := func(x, y Scalar) bool {
+		var p, q, check, res Point
+		p.ScalarBaseMult(&x)
+		q.ScalarBaseMult(&y)
+		check.Add(&p, &q)
+		res.AddAffineCached(&p, new(AffineCached).FromPoint(&q))
+		checkOnCurve(t, &res)
+		return check.Equal(&res) == 1
+	}
+	if err := quick.Check(addAffineCachedMatchesAdd, quickCheckConfig32); err != nil {
+		t.Error(err)
+	}
+	var res Point
+	res.AddAffineCached(I, new(AffineCached).FromPoint(B))
+	if res.Equal(B) != 1 {
+		t.Error("0 + B != B")
+	}
+}
+
+func TestSumAffineCached(t *testing.T) {
+	sumAffineCachedMatchesAdd := func(x, y, z Scalar) bool {
+		var p, q, r, check, res Point
+		p.ScalarBaseMult(&x)
+		q.ScalarBaseMult(&y)
+		r.ScalarBaseMult(&z)
+		table := []AffineCached{*new(AffineCached).FromPoint(&p), *new(AffineCached).FromPoint(&q), *new(AffineCached).FromPoint(&r)}
+		check.Add(&p, &r)
+		check.Add(&check, &r)
+		res.SumAffineCached(table, []int{2, 0, 2})
+		checkOnCurve(t, &res)
+		return check.Equal(&res) == 1
+	}
+	if err := quick.Check(sumAffineCachedMatchesAdd, quickCheckConfig32); err != nil {
+		t.Error(err)
+	}
+	var res Point
+	if res.SumAffineCached(nil, nil).Equal(I) != 1 {
+		t.Error("empty sum != 0")
+	}
+}
+
 func TestComparable(t *testing.T) {
 	if reflect.TypeOf(Point{}).Comparable() {
 		t.Error("Point is unexpectedly comparable")
@@ -31,6 +31,8 @@ var (
 
 	scOne = Scalar{[32]byte{1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}}
 
+	scMinusTwo = Scalar{[32]byte{235, 211, 245, 92, 26, 99, 18, 88, 214, 156, 247, 162, 222, 249, 222, 20, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 16}}
+
 	scMinusOne = Scalar{[32]byte{236, 211, 245, 92, 26, 99, 18, 88, 214, 156, 247, 162, 222, 249, 222, 20, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 16}}
 )
 
@@ -73,6 +75,24 @@ func (s *Scalar) Multiply(x, y *Scalar) *Scalar {
 	return s
 }
 
+// Invert sets s to the inverse of a nonzero scalar v, and returns s.
+//
+// If t is zero, Invert returns zero.
+func (s *Scalar) Invert(t *Scalar) *Scalar {
+	// Uses Fermat's little theorem, t^(l-2) = t^-1 mod l. The exponent is
+	// public, so the square-and-multiply schedule does not depend on t.
+	var z Scalar
+	z.Set(&scOne)
+	x := *t
+	for i := len(scMinusTwo.s)*8 - 1; i >= 0; i-- {
+		z.Multiply(&z, &z)
+		if (scMinusTwo.s[i/8]>>(i%8))&1 == 1 {
+			z.Multiply(&z, &x)
+		}
+	}
+	return s.Set(&z)
+}
+
 // Set sets s = x, and returns s.
 func (s *Scalar) Set(x *Scalar) *Scalar {
 	*s = *x
@@ -186,6 +186,28 @@ func TestScalarAddLikeSubNeg(t *testing.T) {
 	}
 }
 
+func TestScalarInvert(t *testing.T) {
+	invertWorks := func(xInv Scalar) bool {
+		if xInv == scZero {
+			return true
+		}
+		var x, check Scalar
+		x.Invert(&xInv)
+		check.Multiply(&x, &xInv)
+
+		return check == scOne && isReduced(&x)
+	}
+
+	if err := quick.Check(invertWorks, quickCheckConfig32); err != nil {
+		t.Error(err)
+	}
+
+	zero := NewScalar()
+	if xx := NewScalar().Invert(zero); xx.Equal(zero) != 1 {
+		t.Errorf("inverse of zero is %v, expected zero", xx)
+	}
+}
+
 func TestScalarNonAdjacentForm(t *testing.T) {
 	s := Scalar{[32]byte{
 		0x1a, 0x0e, 0x97, 0x8a, 0x90, 0xf6, 0x62, 0x2d,
@@ -207,3 +207,57 @@ func BenchmarkVarTimeDoubleScalarBaseMult(t *testing.B) {
 		p.VarTimeDoubleScalarBaseMult(&dalekScalar, B, &dalekScalar)
 	}
 }
+
+func TestVarTimeMultiScalarMultMatchesSum(t *testing.T) {
+	varTimeMultiScalarMultMatchesSum := func(x, y, z Scalar) bool {
+		var p, q, r, check Point
+		p.ScalarBaseMult(&x)
+		q.ScalarBaseMult(&y)
+		r.ScalarMult(&z, B)
+
+		var expected, term Point
+		expected.Set(I)
+		expected.Add(&expected, term.ScalarMult(&x, &q))
+		expected.Add(&expected, term.ScalarMult(&y, &r))
+		expected.Add(&expected, term.ScalarMult(&z, &p))
+
+		check.VarTimeMultiScalarMult([]*Scalar{&x, &y, &z}, []*Point{&q, &r, &p})
+		checkOnCurve(t, &check)
+		return check.Equal(&expected) == 1
+	}
+
+	if err := quick.Check(varTimeMultiScalarMultMatchesSum, quickCheckConfig32); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestVarTimeMultiScalarMultEdgeCases(t *testing.T) {
+	var p Point
+	p.VarTimeMultiScalarMult(nil, nil)
+	if I.Equal(&p) != 1 {
+		t.Error("empty sum != 0")
+	}
+	var z Scalar
+	p.VarTimeMultiScalarMult([]*Scalar{&z, &dalekScalar}, []*Point{B, B})
+	if dalekScalarBasepoint.Equal(&p) != 1 {
+		t.Error("VarTimeMultiScalarMult does not match dalek")
+	}
+	checkOnCurve(t, &p)
+}
+
+func TestMultByCofactor(t *testing.T) {
+	multByCofactor := func(x Scalar) bool {
+		var p, check, expected Point
+		p.ScalarBaseMult(&x)
+		check.MultByCofactor(&p)
+		expected.Add(&p, &p)
+		expected.Add(&expected, &expected)
+		expected.Add(&expected, &expected)
+		checkOnCurve(t, &check)
+		return check.Equal(&expected) == 1
+	}
+
+	if err := quick.Check(multByCofactor, quickCheckConfig32); err != nil {
+		t.Error(err)
+	}
+}
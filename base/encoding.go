@@ -0,0 +1,181 @@
+package base
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"github.com/walegarrett/cpk-algs/base/edwards25519"
+)
+
+var errNotInitialized = errors.New("encoding: value not initialized")
+
+// decodePoint decodes a point and rejects non-canonical encodings
+func decodePoint(x []byte) (*edwards25519.Point, error) {
+	pt, err := (&edwards25519.Point{}).SetBytes(x)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(pt.Bytes(), x) {
+		return nil, errors.New("encoding: non-canonical point encoding")
+	}
+	return pt, nil
+}
+
+// marshalJSONText encodes the text form of the value as a JSON string
+func marshalJSONText(text []byte, err error) ([]byte, error) {
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(string(text))
+}
+
+// unmarshalJSONText decodes a JSON string and passes it to the text decoder
+func unmarshalJSONText(data []byte, unmarshalText func([]byte) error) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		return err
+	}
+	return unmarshalText([]byte(text))
+}
+
+// MarshalText returns the hex encoding of the point
+func (point Ed25519Point) MarshalText() ([]byte, error) {
+	if point.Point == nil {
+		return nil, errNotInitialized
+	}
+	return []byte(hex.EncodeToString(point.Point.Bytes())), nil
+}
+
+// UnmarshalText decodes the hex encoding of a point
+func (point *Ed25519Point) UnmarshalText(text []byte) error {
+	buf, err := hex.DecodeString(string(text))
+	if err != nil {
+		return err
+	}
+	pt, err := decodePoint(buf)
+	if err != nil {
+		return err
+	}
+	point.Point = pt
+	return nil
+}
+
+func (point Ed25519Point) MarshalJSON() ([]byte, error) {
+	return marshalJSONText(point.MarshalText())
+}
+
+func (point *Ed25519Point) UnmarshalJSON(data []byte) error {
+	return unmarshalJSONText(data, point.UnmarshalText)
+}
+
+// MarshalText returns the hex encoding of the scalar
+func (scala Ed25519Scala) MarshalText() ([]byte, error) {
+	if scala.Scalar == nil {
+		return nil, errNotInitialized
+	}
+	return []byte(hex.EncodeToString(scala.Scalar.Bytes())), nil
+}
+
+// UnmarshalText decodes the hex encoding of a canonical scalar
+func (scala *Ed25519Scala) UnmarshalText(text []byte) error {
+	buf, err := hex.DecodeString(string(text))
+	if err != nil {
+		return err
+	}
+	return scala.SetBytes(buf)
+}
+
+func (scala Ed25519Scala) MarshalJSON() ([]byte, error) {
+	return marshalJSONText(scala.MarshalText())
+}
+
+func (scala *Ed25519Scala) UnmarshalJSON(data []byte) error {
+	return unmarshalJSONText(data, scala.UnmarshalText)
+}
+
+// MarshalText returns the hex encoding of the public key
+func (pk PublicKey) MarshalText() ([]byte, error) {
+	if pk.Point == nil {
+		return nil, errNotInitialized
+	}
+	return []byte(hex.EncodeToString(pk.Point.Bytes())), nil
+}
+
+// UnmarshalText decodes the hex encoding of a public key
+func (pk *PublicKey) UnmarshalText(text []byte) error {
+	buf, err := hex.DecodeString(string(text))
+	if err != nil {
+		return err
+	}
+	pt, err := decodePoint(buf)
+	if err != nil {
+		return err
+	}
+	pk.Point = pt
+	return nil
+}
+
+func (pk PublicKey) MarshalJSON() ([]byte, error) {
+	return marshalJSONText(pk.MarshalText())
+}
+
+func (pk *PublicKey) UnmarshalJSON(data []byte) error {
+	return unmarshalJSONText(data, pk.UnmarshalText)
+}
+
+// MarshalText returns the hex encoding of the private key scalar
+func (sk PrivateKey) MarshalText() ([]byte, error) {
+	if sk.Scalar == nil {
+		return nil, errNotInitialized
+	}
+	return []byte(hex.EncodeToString(sk.Scalar.Bytes())), nil
+}
+
+// UnmarshalText decodes the hex encoding of a canonical private key scalar
+func (sk *PrivateKey) UnmarshalText(text []byte) error {
+	buf, err := hex.DecodeString(string(text))
+	if err != nil {
+		return err
+	}
+	sc, err := (&edwards25519.Scalar{}).SetCanonicalBytes(buf)
+	if err != nil {
+		return err
+	}
+	// 重置签名密钥等缓存的派生值
+	*sk = PrivateKey{Scalar: sc}
+	return nil
+}
+
+func (sk PrivateKey) MarshalJSON() ([]byte, error) {
+	return marshalJSONText(sk.MarshalText())
+}
+
+func (sk *PrivateKey) UnmarshalJSON(data []byte) error {
+	return unmarshalJSONText(data, sk.UnmarshalText)
+}
+
+// MarshalText returns the hex encoding of the signature
+func (s Signature) MarshalText() ([]byte, error) {
+	if s.s == nil || s.c == nil {
+		return nil, errNotInitialized
+	}
+	return []byte(hex.EncodeToString(s.Bytes())), nil
+}
+
+// UnmarshalText decodes the hex encoding of a signature
+func (s *Signature) UnmarshalText(text []byte) error {
+	buf, err := hex.DecodeString(string(text))
+	if err != nil {
+		return err
+	}
+	return s.SetBytes(buf)
+}
+
+func (s Signature) MarshalJSON() ([]byte, error) {
+	return marshalJSONText(s.MarshalText())
+}
+
+func (s *Signature) UnmarshalJSON(data []byte) error {
+	return unmarshalJSONText(data, s.UnmarshalText)
+}
@@ -0,0 +1,78 @@
+package base
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestKeyJSON(t *testing.T) {
+	priv := RandomPrivateKey()
+	pub := priv.Public()
+	sig := priv.Sign([]byte("123456"))
+	encoded, err := json.Marshal(struct {
+		Priv PrivateKey
+		Pub  PublicKey
+		Sig  *Signature
+	}{priv, pub, sig})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	var decoded struct {
+		Priv PrivateKey
+		Pub  PublicKey
+		Sig  Signature
+	}
+	err = json.Unmarshal(encoded, &decoded)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if decoded.Priv.Scalar.Equal(priv.Scalar) != 1 || decoded.Pub.Equal(pub.Point) != 1 {
+		t.Error("keys not equal")
+		return
+	}
+	if !decoded.Pub.Verify([]byte("123456"), &decoded.Sig) {
+		t.Error("verify failed")
+		return
+	}
+	if !strings.Contains(string(encoded), string(mustText(t, pub))) {
+		t.Error("public key not hex encoded")
+	}
+}
+
+func mustText(t *testing.T, pub PublicKey) []byte {
+	text, err := pub.MarshalText()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return text
+}
+
+func TestPointText(t *testing.T) {
+	point := NewEd25519Point()
+	text, err := point.MarshalText()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if string(text) != "0100000000000000000000000000000000000000000000000000000000000000" {
+		t.Error("bad identity encoding", string(text))
+		return
+	}
+	var decoded Ed25519Point
+	// 非规范编码
+	if decoded.UnmarshalText([]byte("edffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff7f")) == nil {
+		t.Error("non-canonical point accepted")
+		return
+	}
+	if _, err = (Ed25519Point{}).MarshalText(); err == nil {
+		t.Error("nil point encoded")
+		return
+	}
+	var scala Ed25519Scala
+	if scala.UnmarshalText([]byte("ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff")) == nil {
+		t.Error("non-canonical scalar accepted")
+	}
+}
@@ -1,7 +1,6 @@
 package base
 
 import (
-	"bytes"
 	"encoding/binary"
 	"golang.org/x/crypto/blake2b"
 	"hash"
@@ -11,7 +10,9 @@ const BytesMax = blake2b.Size
 
 // Hashstream represents the unlimited hash str
 type Hashstream struct {
-	secret  []byte
+	secret []byte
+	// 以 secret 为密钥的哈希，每个分组重置后复用
+	hash    hash.Hash
 	counter int64
 	ptr     int64
 	curr    []byte
@@ -20,32 +21,31 @@ type Hashstream struct {
 func NewHashstream(src []byte) *Hashstream {
 	if len(src) != BytesMax {
 		panic("src's length cannot less than BytesMax")
-		return nil
 	}
 	var hashstream Hashstream
 	hashstream.counter = 0
 	hashstream.ptr = BytesMax
 	hashstream.secret = make([]byte, BytesMax)
 	copy(hashstream.secret, src)
+	hash, err := blake2b.New512(hashstream.secret)
+	if err != nil {
+		panic(err)
+	}
+	hashstream.hash = hash
 	hashstream.curr = make([]byte, BytesMax)
 	return &hashstream
 }
 
 func (hashstrem *Hashstream) ToNextByte() byte {
 	if hashstrem.ptr == BytesMax {
-		hash, err := blake2b.New512(hashstrem.secret)
-		if err != nil {
-			panic(err)
-		}
+		hash := hashstrem.hash
+		// 重置后仍保留密钥
+		hash.Reset()
 		hash.Write(hashstrem.secret)
-		bytesBuffer := bytes.NewBuffer([]byte{})
-		err = binary.Write(bytesBuffer, binary.LittleEndian, hashstrem.counter)
-		if err != nil {
-			panic(err)
-		}
-		hash.Write(bytesBuffer.Bytes())
-		sum := hash.Sum(nil)
-		copy(hashstrem.curr, sum[:])
+		var counter [8]byte
+		binary.LittleEndian.PutUint64(counter[:], uint64(hashstrem.counter))
+		hash.Write(counter[:])
+		hash.Sum(hashstrem.curr[:0])
 		hashstrem.counter++
 		hashstrem.ptr = 0
 	}
@@ -54,6 +54,31 @@ func (hashstrem *Hashstream) ToNextByte() byte {
 	return b
 }
 
+// ToNextIntn returns a uniformly distributed integer in [0, n).
+// 使用拒绝采样避免取模偏差，当 n 整除 256 时与 ToNextByte() % n 的结果一致
+func (hashstrem *Hashstream) ToNextIntn(n int) int {
+	if n <= 0 {
+		panic("hashstream: invalid argument to ToNextIntn")
+	}
+	// 计算覆盖 n 所需的字节数
+	width := 1
+	space := uint64(256)
+	for space < uint64(n) {
+		width++
+		space <<= 8
+	}
+	limit := space - space%uint64(n)
+	for {
+		var v uint64
+		for i := 0; i < width; i++ {
+			v |= uint64(hashstrem.ToNextByte()) << (8 * i)
+		}
+		if v < limit {
+			return int(v % uint64(n))
+		}
+	}
+}
+
 func FromHash(hash hash.Hash) *Hashstream {
 	hashstream := NewHashstream(hash.Sum(nil))
 	return hashstream
@@ -18,3 +18,27 @@ func TestHashstream_ToNextByte(t *testing.T) {
 		return
 	}
 }
+
+func TestHashstream_ToNextIntn(t *testing.T) {
+	secret, err := hex.DecodeString("f0500705de23d877bc6b332514659a6d94e3e7835eaca4b471eea6541223b536cd42abcab96d409ef3a6bfb203e9051f2354457d81a781440c77688200ec60f8")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	// n 整除 256 时与 ToNextByte 取模的结果一致
+	hashstream := NewHashstream(secret)
+	if hashstream.ToNextIntn(32) != 130%32 {
+		t.Error("hashstream to next intn error")
+		return
+	}
+	for _, n := range []int{3, 48, 255, 1000} {
+		hashstream = NewHashstream(secret)
+		for i := 0; i < 256; i++ {
+			v := hashstream.ToNextIntn(n)
+			if v < 0 || v >= n {
+				t.Error("hashstream to next intn out of range:", v)
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package base
+
+import (
+	"errors"
+	"github.com/walegarrett/cpk-algs/base/edwards25519"
+	"golang.org/x/crypto/blake2b"
+)
+
+const (
+	// 绑定记录的密钥交换的域标签
+	kxTranscriptTag = "cpk-kx-transcript-v1"
+	// 派生密钥的标签
+	kxEncLabel = "enc"
+	kxMacLabel = "mac"
+	// 派生密钥的默认长度与最大长度
+	defaultKxKeySize = 32
+	maxKxKeySize     = 1024
+)
+
+// KxOptions configures KxSendWithOptions and KxReceiveWithOptions, both sides must use the
+// same options, nil options use an empty context and 32-byte keys
+type KxOptions struct {
+	// Context labels the purpose of the exchange, keys of different contexts are independent
+	Context string
+	// EncKeySize and MacKeySize are the lengths of the derived keys in bytes, 32 if zero
+	EncKeySize int
+	MacKeySize int
+}
+
+// KxKeys are the keys derived from a key exchange, each key is labelled with its purpose
+type KxKeys struct {
+	EncKey []byte
+	MacKey []byte
+}
+
+// keySizes returns the lengths of the derived keys
+func (opts *KxOptions) keySizes() (encKeySize, macKeySize int, err error) {
+	encKeySize, macKeySize = defaultKxKeySize, defaultKxKeySize
+	if opts == nil {
+		return
+	}
+	if opts.EncKeySize != 0 {
+		encKeySize = opts.EncKeySize
+	}
+	if opts.MacKeySize != 0 {
+		macKeySize = opts.MacKeySize
+	}
+	if encKeySize < 0 || encKeySize > maxKxKeySize || macKeySize < 0 || macKeySize > maxKxKeySize {
+		err = errors.New("kx: bad key size")
+	}
+	return
+}
+
+// isSmallOrder reports whether the point is of small order, the shared point of such a key
+// does not depend on the private key
+func isSmallOrder(pt *edwards25519.Point) bool {
+	return (&edwards25519.Point{}).MultByCofactor(pt).Equal(edwards25519.NewIdentityPoint()) == 1
+}
+
+// kxKeys derives the labelled keys from the transcript of the exchange
+//
+// prk = BLAKE2b-512(标签 || 上下文 || 临时公钥 || 接收者公钥 || 共享点)，
+// 每个密钥为以 prk 为密钥、以用途标签为输入的 BLAKE2Xb 输出
+func kxKeys(opts *KxOptions, sent []byte, recipient *PublicKey, shared *edwards25519.Point) (*KxKeys, error) {
+	encKeySize, macKeySize, err := opts.keySizes()
+	if err != nil {
+		return nil, err
+	}
+	var context string
+	if opts != nil {
+		context = opts.Context
+	}
+	var transcript Serializer
+	transcript.WriteString(kxTranscriptTag)
+	transcript.WriteString(context)
+	transcript.WriteBytesWithLength(sent)
+	transcript.WriteBytesWithLength(recipient.Bytes())
+	transcript.WriteBytesWithLength(shared.Bytes())
+	prk := blake2b.Sum512(transcript)
+	keys := &KxKeys{}
+	if keys.EncKey, err = kxExpand(prk[:], kxEncLabel, encKeySize); err != nil {
+		return nil, err
+	}
+	if keys.MacKey, err = kxExpand(prk[:], kxMacLabel, macKeySize); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// kxExpand returns size bytes of the key labelled with label
+func kxExpand(prk []byte, label string, size int) ([]byte, error) {
+	xof, err := blake2b.NewXOF(uint32(size), prk)
+	if err != nil {
+		return nil, err
+	}
+	xof.Write([]byte(label))
+	key := make([]byte, size)
+	if _, err = xof.Read(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// KxSendWithOptions starts a key exchange with the owner of the public key and returns the
+// ephemeral point to send along with the keys derived from the whole transcript
+//
+// 与 KxSend 不同，派生的密钥绑定临时公钥、接收者公钥与上下文，加密与认证使用相互独立的密钥
+func (p *PublicKey) KxSendWithOptions(opts *KxOptions) (sent []byte, keys *KxKeys, err error) {
+	if _, _, err = opts.keySizes(); err != nil {
+		return
+	}
+	if p.Point == nil || isSmallOrder(p.Point) {
+		err = errors.New("kx: bad public key")
+		return
+	}
+	r := RandomPrivateKey()
+	sentPt := (&edwards25519.Point{}).ScalarBaseMult(r.Scalar)
+	shared := (&edwards25519.Point{}).ScalarMult(r.Scalar, p.Point)
+	sent = sentPt.Bytes()
+	keys, err = kxKeys(opts, sent, p, shared)
+	return
+}
+
+// KxReceiveWithOptions completes a key exchange started by KxSendWithOptions with the same options
+func (p *PrivateKey) KxReceiveWithOptions(received []byte, opts *KxOptions) (*KxKeys, error) {
+	pt, err := (&edwards25519.Point{}).SetBytes(received)
+	if err != nil {
+		return nil, err
+	}
+	if isSmallOrder(pt) {
+		return nil, errors.New("kx: bad public key")
+	}
+	shared := (&edwards25519.Point{}).ScalarMult(p.Scalar, pt)
+	pub := p.Public()
+	return kxKeys(opts, received, &pub, shared)
+}
@@ -0,0 +1,72 @@
+package base
+
+import (
+	"encoding/hex"
+	"github.com/stretchr/testify/require"
+	"github.com/walegarrett/cpk-algs/base/edwards25519"
+	"testing"
+)
+
+func TestPublicKey_KxSendWithOptions(t *testing.T) {
+	priv := RandomPrivateKey()
+	pub := priv.Public()
+	sent, keys, err := pub.KxSendWithOptions(nil)
+	require.NoError(t, err)
+	require.Len(t, keys.EncKey, 32)
+	require.Len(t, keys.MacKey, 32)
+	require.NotEqual(t, keys.EncKey, keys.MacKey)
+	received, err := priv.KxReceiveWithOptions(sent, nil)
+	require.NoError(t, err)
+	require.Equal(t, keys, received)
+
+	opts := &KxOptions{Context: "file-transfer", EncKeySize: 16, MacKeySize: 64}
+	sent, keys, err = pub.KxSendWithOptions(opts)
+	require.NoError(t, err)
+	require.Len(t, keys.EncKey, 16)
+	require.Len(t, keys.MacKey, 64)
+	received, err = priv.KxReceiveWithOptions(sent, opts)
+	require.NoError(t, err)
+	require.Equal(t, keys, received)
+
+	// 上下文、接收者或长度不同，派生的密钥互不相关
+	other, err := priv.KxReceiveWithOptions(sent, &KxOptions{Context: "chat", EncKeySize: 16, MacKeySize: 64})
+	require.NoError(t, err)
+	require.NotEqual(t, keys.EncKey, other.EncKey)
+	require.NotEqual(t, keys.MacKey, other.MacKey)
+	wrong := RandomPrivateKey()
+	other, err = wrong.KxReceiveWithOptions(sent, opts)
+	require.NoError(t, err)
+	require.NotEqual(t, keys.EncKey, other.EncKey)
+	other, err = priv.KxReceiveWithOptions(sent, &KxOptions{Context: "file-transfer"})
+	require.NoError(t, err)
+	require.NotEqual(t, keys.EncKey, other.EncKey[:16])
+
+	_, _, err = pub.KxSendWithOptions(&KxOptions{EncKeySize: -1})
+	require.Error(t, err)
+	_, _, err = pub.KxSendWithOptions(&KxOptions{MacKeySize: maxKxKeySize + 1})
+	require.Error(t, err)
+	identity := PublicKey{Point: edwards25519.NewIdentityPoint()}
+	_, _, err = identity.KxSendWithOptions(nil)
+	require.Error(t, err)
+	_, err = priv.KxReceiveWithOptions(edwards25519.NewIdentityPoint().Bytes(), nil)
+	require.Error(t, err)
+}
+
+func TestPrivateKey_KxReceiveWithOptions(t *testing.T) {
+	privBuf, err := hex.DecodeString("5399cfa5eab9bd2e54f1e57731b13a2c89aee7acc552f50377c9e291fcb5870d")
+	require.NoError(t, err)
+	priv := PrivateKey{}
+	require.NoError(t, priv.SetBytes(privBuf))
+	sent, err := hex.DecodeString("e618254b8cc4fe9abf995c8423e4657ad587a80932330faae4ac226ac97cb9d5")
+	require.NoError(t, err)
+	keys, err := priv.KxReceiveWithOptions(sent, &KxOptions{Context: "cpk"})
+	require.NoError(t, err)
+	require.Equal(t, "2d5e12414e54f0175c8045c275a409e9a633df7f8fe0ba130bf1be0a4128f874", hex.EncodeToString(keys.EncKey))
+	require.Equal(t, "9ce29e44aeadb1f090764b2f528d53aaa0c68826fe5ef6369d0c4f59cef55a74", hex.EncodeToString(keys.MacKey))
+
+	// 原有的 KxReceive 保持不变
+	key, err := priv.KxReceive(sent)
+	require.NoError(t, err)
+	require.Equal(t, "f0500705de23d877bc6b332514659a6d94e3e7835eaca4b471eea6541223b536"+
+		"cd42abcab96d409ef3a6bfb203e9051f2354457d81a781440c77688200ec60f8", hex.EncodeToString(key[:]))
+}
@@ -66,6 +66,10 @@ type Signature struct {
 	s, c *edwards25519.Scalar
 }
 
+func (s *Signature) SerializedByteSize() int64 {
+	return 64
+}
+
 func (s *Signature) Bytes() []byte {
 	var buf bytes.Buffer
 	buf.Write(s.s.Bytes())
@@ -77,6 +81,12 @@ func (s *Signature) SetBytes(x []byte) (err error) {
 	if len(x) != 64 {
 		return errors.New("bad signature length")
 	}
+	if s.s == nil {
+		s.s = &edwards25519.Scalar{}
+	}
+	if s.c == nil {
+		s.c = &edwards25519.Scalar{}
+	}
 	_, err = s.s.SetCanonicalBytes(x[:32])
 	if err != nil {
 		return
@@ -107,64 +117,79 @@ func (p *PrivateKey) Public() (pub PublicKey) {
 }
 
 func (p *PrivateKey) Sign(m []byte) (sig *Signature) {
-	p.initialize()
-	hash, err := blake2b.New512(nil)
-	if err != nil {
-		panic(err)
-	}
-	_, err = hash.Write(p.signKey[:])
-	if err != nil {
-		panic(err)
-	}
-	_, err = hash.Write(m)
-	if err != nil {
-		panic(err)
-	}
-	r := (&edwards25519.Scalar{}).SetUniformBytes(hash.Sum(nil))
-	R := (&edwards25519.Point{}).ScalarBaseMult(r)
-	hash, err = blake2b.New512(nil)
-	if err != nil {
-		panic(err)
-	}
-	_, err = hash.Write(R.Bytes())
-	if err != nil {
-		panic(err)
-	}
-	_, err = hash.Write(p.pk.Bytes())
-	if err != nil {
-		panic(err)
-	}
-	_, err = hash.Write(m)
-	if err != nil {
-		panic(err)
-	}
-	c := (&edwards25519.Scalar{}).SetUniformBytes(hash.Sum(nil))
-	r.MultiplyAdd(c, p.Scalar, r)
+	_, s, c := p.sign(signModePlain, nil, nil, m)
 	return &Signature{
-		s: r,
+		s: s,
 		c: c,
 	}
 }
 
-func (p *PublicKey) Verify(m []byte, sign *Signature) bool {
-	R := (&edwards25519.Point{}).VarTimeDoubleScalarBaseMult(sign.c, (&edwards25519.Point{}).Negate(p.Point), sign.s)
-	hash, err := blake2b.New512(nil)
-	if err != nil {
-		panic(err)
-	}
-	_, err = hash.Write(R.Bytes())
-	if err != nil {
-		panic(err)
-	}
-	_, err = hash.Write(p.Bytes())
-	if err != nil {
-		panic(err)
-	}
-	_, err = hash.Write(m)
+// signMode separates the nonces of the signing modes
+type signMode int32
+
+const (
+	// 原始的 Sign，随机数为 H(signKey || m)，保持不变
+	signModePlain signMode = iota
+	signModeContext
+	signModePrehash
+)
+
+// 非原始模式随机数派生的域标签
+const signNonceTag = "cpk-sign-nonce-v1"
+
+// nonce derives the nonce of the signature in the mode
+//
+// 非原始模式以 signKey 作为 BLAKE2b 的密钥，与原始模式的无密钥哈希互不相通；
+// 模式、前缀与随机字节都带长度写入，任意两个模式或参数的随机数输入都不相同
+func (p *PrivateKey) nonce(mode signMode, prefix, random, m []byte) *edwards25519.Scalar {
+	if mode == signModePlain {
+		hash, err := blake2b.New512(nil)
+		if err != nil {
+			panic(err)
+		}
+		_, err = hash.Write(p.signKey[:])
+		if err != nil {
+			panic(err)
+		}
+		_, err = hash.Write(m)
+		if err != nil {
+			panic(err)
+		}
+		return (&edwards25519.Scalar{}).SetUniformBytes(hash.Sum(nil))
+	}
+	hash, err := blake2b.New512(p.signKey[:])
 	if err != nil {
 		panic(err)
 	}
-	return sign.c.Equal((&edwards25519.Scalar{}).SetUniformBytes(hash.Sum(nil))) == 1
+	var serializer Serializer
+	serializer.WriteString(signNonceTag)
+	serializer.WriteInt32(int32(mode))
+	serializer.WriteBytesWithLength(prefix)
+	serializer.WriteBytesWithLength(random)
+	hash.Write(serializer)
+	hash.Write(m)
+	return (&edwards25519.Scalar{}).SetUniformBytes(hash.Sum(nil))
+}
+
+// sign returns the commitment R, the response s and the challenge c of the signature, the
+// prefix is bound into both the nonce and the challenge, the random is only mixed into the nonce
+func (p *PrivateKey) sign(mode signMode, prefix, random, m []byte) (R *edwards25519.Point, s, c *edwards25519.Scalar) {
+	p.initialize()
+	r := p.nonce(mode, prefix, random, m)
+	R = (&edwards25519.Point{}).ScalarBaseMult(r)
+	c = signChallenge(prefix, R.Bytes(), p.pk.Point, m)
+	s = (&edwards25519.Scalar{}).MultiplyAdd(c, p.Scalar, r)
+	return
+}
+
+func (p *PublicKey) Verify(m []byte, sign *Signature) bool {
+	return p.verify(nil, m, sign)
+}
+
+// verify checks the challenge of the signature under the prefix
+func (p *PublicKey) verify(prefix, m []byte, sign *Signature) bool {
+	R := (&edwards25519.Point{}).VarTimeDoubleScalarBaseMult(sign.c, (&edwards25519.Point{}).Negate(p.Point), sign.s)
+	return sign.c.Equal(signChallenge(prefix, R.Bytes(), p.Point, m)) == 1
 }
 
 func (p *PublicKey) KxSend() (sent []byte, key [64]byte, err error) {
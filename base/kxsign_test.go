@@ -59,3 +59,21 @@ func TestKxSign(t *testing.T) {
 		t.Error("not equal")
 	}
 }
+
+func TestSignatureSetBytes(t *testing.T) {
+	priv := RandomPrivateKey()
+	pub := priv.Public()
+	sig := priv.Sign([]byte("123456"))
+	var decoded Signature
+	err := decoded.SetBytes(sig.Bytes())
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if !pub.Verify([]byte("123456"), &decoded) {
+		t.Error("verify failed")
+	}
+	if decoded.SetBytes(sig.Bytes()[:63]) == nil {
+		t.Error("short signature accepted")
+	}
+}
@@ -2,6 +2,7 @@ package base
 
 import (
 	"github.com/walegarrett/cpk-algs/logger"
+	"sync"
 )
 
 type Element struct {
@@ -20,7 +21,17 @@ func NewElement(key string, value interface{}) *Element {
 	return &element
 }
 
+// LRUStats counts the cache hits and misses of an LRU
+type LRUStats struct {
+	Hits   uint64
+	Misses uint64
+}
+
+// LRU is a bounded cache safe for concurrent use, values of type error returned
+// by queries are not cached
 type LRU struct {
+	mu       sync.Mutex
+	stats    LRUStats
 	capacity int64
 	cache    map[string]*Element
 	// virtual head node
@@ -31,17 +42,50 @@ type LRU struct {
 }
 
 func NewLRU(cnt int64, queries func(string) interface{}) *LRU {
+	if cnt <= 0 {
+		panic("lru: capacity must be positive")
+	}
 	var lru LRU
 	lru.capacity = cnt
-	lru.cache = make(map[string]*Element, cnt)
+	lru.queries = queries
+	lru.reset()
+	return &lru
+}
+
+func (lru *LRU) reset() {
+	lru.cache = make(map[string]*Element, lru.capacity)
 	lru.head = new(Element)
 	lru.tail = new(Element)
 	lru.head.pre = lru.tail
 	lru.head.next = lru.tail
 	lru.tail.pre = lru.head
 	lru.tail.next = lru.head
-	lru.queries = queries
-	return &lru
+}
+
+// Purge removes all the cached values, the statistics are kept
+func (lru *LRU) Purge() {
+	lru.mu.Lock()
+	defer lru.mu.Unlock()
+	lru.reset()
+}
+
+// Stats returns the hits and misses since the cache was created
+func (lru *LRU) Stats() LRUStats {
+	lru.mu.Lock()
+	defer lru.mu.Unlock()
+	return lru.stats
+}
+
+// Capacity returns the maximum number of cached values
+func (lru *LRU) Capacity() int64 {
+	return lru.capacity
+}
+
+// Len returns the number of cached values
+func (lru *LRU) Len() int {
+	lru.mu.Lock()
+	defer lru.mu.Unlock()
+	return len(lru.cache)
 }
 
 func (lru *LRU) removeNode(ele *Element) {
@@ -72,25 +116,42 @@ func (lru *LRU) removeOldest() {
 	delete(lru.cache, head.key)
 }
 
+// Query returns the cached value of the key, on a miss the value is derived without holding
+// the lock so that concurrent misses of other keys do not wait for each other
+//
+// 同一个键的并发未命中可能各自派生一次，先插入的值被保留，查询函数须对同一键返回相同的值
 func (lru *LRU) Query(key string) interface{} {
-	node, ok := lru.cache[key]
-	if !ok {
-		// key not exist
-		logger.Logger.Info("miss the cache, key", key)
-		//fmt.Printf("miss the cache, key: %+v\n", key)
-		if int64(len(lru.cache)) >= lru.capacity {
-			lru.removeOldest()
-		}
-		value := lru.queries(key)
-		element := NewElement(key, value)
-		lru.addToTail(element)
-		lru.cache[key] = element
-		return value
-	} else {
+	lru.mu.Lock()
+	if node, ok := lru.cache[key]; ok {
 		// key exist
-		logger.Logger.Info("hit the cache, key", node.key, "value", node.value)
+		lru.stats.Hits++
+		logger.Logger.Debug("hit the cache, key", node.key, "value", node.value)
 		//fmt.Printf("hit the cache, key:%+v, value:%+v\n", node.key, node.value)
 		lru.removeToTail(node)
+		lru.mu.Unlock()
 		return node.value
 	}
+	// key not exist
+	lru.stats.Misses++
+	lru.mu.Unlock()
+	logger.Logger.Debug("miss the cache, key", key)
+	//fmt.Printf("miss the cache, key: %+v\n", key)
+	value := lru.queries(key)
+	if _, failed := value.(error); failed {
+		return value
+	}
+	lru.mu.Lock()
+	defer lru.mu.Unlock()
+	// 派生期间其他查询可能已插入该键
+	if node, ok := lru.cache[key]; ok {
+		lru.removeToTail(node)
+		return node.value
+	}
+	if int64(len(lru.cache)) >= lru.capacity {
+		lru.removeOldest()
+	}
+	element := NewElement(key, value)
+	lru.addToTail(element)
+	lru.cache[key] = element
+	return value
 }
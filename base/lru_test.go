@@ -1,6 +1,12 @@
 package base
 
-import "testing"
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
 
 func TestLRU_Query(t *testing.T) {
 	var f = func(key string) interface{} {
@@ -50,3 +56,70 @@ func TestLRU_Query(t *testing.T) {
 	}
 
 }
+
+func TestLRU_Stats(t *testing.T) {
+	errBad := errors.New("bad")
+	lru := NewLRU(2, func(key string) interface{} {
+		if key == "bad" {
+			return errBad
+		}
+		return key + "-value"
+	})
+	lru.Query("1")
+	lru.Query("1")
+	if lru.Query("bad") != errBad {
+		t.Error("lru query error")
+		return
+	}
+	lru.Query("2")
+	lru.Query("3")
+	stats := lru.Stats()
+	if stats.Hits != 1 || stats.Misses != 4 || lru.Len() != 2 {
+		t.Errorf("unexpected stats %+v, len %d", stats, lru.Len())
+		return
+	}
+	lru.Purge()
+	if lru.Len() != 0 || lru.Stats() != stats {
+		t.Error("lru purge error")
+	}
+}
+
+func TestLRU_ConcurrentMiss(t *testing.T) {
+	const n = 8
+	// 每次派生都等待所有派生开始，持锁派生时只有一个能开始
+	var started sync.WaitGroup
+	started.Add(n)
+	all := make(chan struct{})
+	go func() {
+		started.Wait()
+		close(all)
+	}()
+	lru := NewLRU(n, func(key string) interface{} {
+		started.Done()
+		select {
+		case <-all:
+		case <-time.After(10 * time.Second):
+			return errors.New("derivations did not overlap")
+		}
+		return key + "-value"
+	})
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(key string) {
+			defer wg.Done()
+			if value := lru.Query(key); value != key+"-value" {
+				errs <- fmt.Errorf("unexpected value %v of key %s", value, key)
+			}
+		}(fmt.Sprint(i))
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+	if lru.Len() != n || lru.Stats().Misses != n {
+		t.Errorf("unexpected stats %+v, len %d", lru.Stats(), lru.Len())
+	}
+}
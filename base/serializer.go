@@ -106,9 +106,24 @@ func (d *DeSerializer) ReadInt32(data *int32) (*DeSerializer, error) {
 	return d, nil
 }
 
+// ReadLength reads the length prefix of a field, the length must fit in the remaining bytes
+// so that untrusted input cannot trigger a huge allocation
+func (d *DeSerializer) ReadLength(data *int64) (*DeSerializer, error) {
+	var l int64
+	_, err := d.ReadInt64(&l)
+	if err != nil {
+		return nil, err
+	}
+	if l < 0 || uint64(l) > d.Remaining() {
+		return nil, errors.New("length out of range")
+	}
+	*data = l
+	return d, nil
+}
+
 func (d *DeSerializer) ReadBytesWithLength(data *[]byte) (*DeSerializer, error) {
 	var lens int64
-	_, err := d.ReadInt64(&lens)
+	_, err := d.ReadLength(&lens)
 	if err != nil {
 		return nil, err
 	}
@@ -134,7 +149,7 @@ func (d *DeSerializer) ReadBytesWithLength(data *[]byte) (*DeSerializer, error)
 
 func (d *DeSerializer) ReadString(data *string) (*DeSerializer, error) {
 	var len int64
-	_, err := d.ReadInt64(&len)
+	_, err := d.ReadLength(&len)
 	if err != nil {
 		return nil, err
 	}
@@ -182,3 +197,8 @@ type Serializable interface {
 	Bytes() []byte
 	SetBytes([]byte) (err error)
 }
+
+// Remaining returns the number of bytes not read yet
+func (d *DeSerializer) Remaining() uint64 {
+	return d.total - d.cur
+}
@@ -98,3 +98,25 @@ func TestDeSerializer_ReadBytesWithoutLength(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, str, str2)
 }
+
+func TestDeSerializer_ReadLengthOutOfRange(t *testing.T) {
+	for _, l := range []int64{-1, 7, 1 << 62} {
+		var serializer Serializer
+		serializer.WriteInt64(l)
+		serializer.WriteBytes([]byte("123456"))
+		deserializer, err := NewDeserializer(serializer)
+		require.NoError(t, err)
+		var bs []byte
+		_, err = deserializer.ReadBytesWithLength(&bs)
+		require.Error(t, err)
+		deserializer, err = NewDeserializer(serializer)
+		require.NoError(t, err)
+		var str string
+		_, err = deserializer.ReadString(&str)
+		require.Error(t, err)
+		deserializer, err = NewDeserializer(serializer)
+		require.NoError(t, err)
+		_, err = deserializer.ReadLength(&l)
+		require.Error(t, err)
+	}
+}
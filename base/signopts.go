@@ -0,0 +1,80 @@
+package base
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+)
+
+const (
+	// 带选项签名的域标签，与 Sign 的签名互不相通
+	signContextTag = "cpk-sign-context-v1"
+	// 对冲随机数混入的新鲜随机字节数
+	hedgeSize = 32
+)
+
+// SignOptions configures SignWithOptions and VerifyWithOptions
+type SignOptions struct {
+	// Context binds the signature to a protocol, the signer and the verifier must use the
+	// same context, an empty context is still separated from the plain Sign
+	Context string
+	// Hedged mixes fresh randomness into the nonce against fault attacks, the signatures
+	// are no longer deterministic but verify the same way
+	Hedged bool
+	// Rand is the source of the hedge, crypto/rand.Reader if nil
+	Rand io.Reader
+}
+
+// prefix returns the domain tag and the length-prefixed context bound into the signature
+func (opts *SignOptions) prefix() []byte {
+	prefix := make([]byte, 0, len(signContextTag)+8+len(opts.Context))
+	prefix = append(prefix, signContextTag...)
+	var l [8]byte
+	binary.LittleEndian.PutUint64(l[:], uint64(len(opts.Context)))
+	prefix = append(prefix, l[:]...)
+	return append(prefix, opts.Context...)
+}
+
+// hedge returns the fresh randomness mixed into the nonce, nil if the options are not hedged
+func (opts *SignOptions) hedge() ([]byte, error) {
+	if opts == nil || !opts.Hedged {
+		return nil, nil
+	}
+	reader := opts.Rand
+	if reader == nil {
+		reader = rand.Reader
+	}
+	random := make([]byte, hedgeSize)
+	if _, err := io.ReadFull(reader, random); err != nil {
+		return nil, err
+	}
+	return random, nil
+}
+
+// SignWithOptions signs the message under the options, nil options sign exactly as Sign
+//
+// 上下文同时进入随机数与挑战值；对冲时随机字节带长度写入随机数输入，
+// 与任何确定性签名（包括其他消息的签名）的随机数输入都不相同，随机源可被预测时也不会复用随机数
+func (p *PrivateKey) SignWithOptions(m []byte, opts *SignOptions) (*Signature, error) {
+	if opts == nil {
+		return p.Sign(m), nil
+	}
+	random, err := opts.hedge()
+	if err != nil {
+		return nil, err
+	}
+	_, s, c := p.sign(signModeContext, opts.prefix(), random, m)
+	return &Signature{
+		s: s,
+		c: c,
+	}, nil
+}
+
+// VerifyWithOptions verifies a signature of SignWithOptions, only the context of the options
+// matters, nil options verify exactly as Verify
+func (p *PublicKey) VerifyWithOptions(m []byte, sig *Signature, opts *SignOptions) bool {
+	if opts == nil {
+		return p.Verify(m, sig)
+	}
+	return p.verify(opts.prefix(), m, sig)
+}
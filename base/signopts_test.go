@@ -0,0 +1,125 @@
+package base
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"github.com/stretchr/testify/require"
+	"github.com/walegarrett/cpk-algs/base/edwards25519"
+	"testing"
+	"testing/iotest"
+)
+
+func TestPrivateKey_SignWithOptions(t *testing.T) {
+	var buf [64]byte
+	for i := range buf {
+		buf[i] = byte(i)
+	}
+	priv := PrivateKey{Scalar: (&edwards25519.Scalar{}).SetUniformBytes(buf[:])}
+	pub := priv.Public()
+	m := []byte("cpk")
+
+	// Sign 的输出保持不变，nil 选项等同于 Sign
+	plain := priv.Sign(m)
+	require.Equal(t, "8f46f91fc601980456d404d9b426df8caee6b0d41dce52bf3298e3ea29443401"+
+		"5aa36d59adf554e2a91e1981955bf4be7a30cc779048c8bbd52ee635af89210d", hex.EncodeToString(plain.Bytes()))
+	sig, err := priv.SignWithOptions(m, nil)
+	require.NoError(t, err)
+	require.Equal(t, plain.Bytes(), sig.Bytes())
+	require.True(t, pub.VerifyWithOptions(m, plain, nil))
+
+	mail := &SignOptions{Context: "mail"}
+	sig, err = priv.SignWithOptions(m, mail)
+	require.NoError(t, err)
+	again, err := priv.SignWithOptions(m, mail)
+	require.NoError(t, err)
+	require.Equal(t, sig.Bytes(), again.Bytes())
+	require.True(t, pub.VerifyWithOptions(m, sig, mail))
+	// 签名不能跨上下文重放
+	require.False(t, pub.Verify(m, sig))
+	require.False(t, pub.VerifyWithOptions(m, sig, &SignOptions{Context: "log"}))
+	require.False(t, pub.VerifyWithOptions(m, sig, &SignOptions{}))
+	require.False(t, pub.VerifyWithOptions(m, plain, &SignOptions{}))
+	require.False(t, pub.VerifyWithOptions([]byte("cpk!"), sig, mail))
+}
+
+func TestPrivateKey_SignWithOptions_Hedged(t *testing.T) {
+	priv := RandomPrivateKey()
+	pub := priv.Public()
+	m := []byte("123456")
+	hedged := &SignOptions{Context: "mail", Hedged: true}
+	sig, err := priv.SignWithOptions(m, hedged)
+	require.NoError(t, err)
+	again, err := priv.SignWithOptions(m, hedged)
+	require.NoError(t, err)
+	require.NotEqual(t, sig.Bytes(), again.Bytes())
+	// 对冲只影响随机数，验证方式与确定性签名相同
+	require.True(t, pub.VerifyWithOptions(m, sig, hedged))
+	require.True(t, pub.VerifyWithOptions(m, again, &SignOptions{Context: "mail"}))
+
+	// 相同的随机字节得到相同的签名
+	fixed := &SignOptions{Context: "mail", Hedged: true, Rand: bytes.NewReader(make([]byte, 64))}
+	sig, err = priv.SignWithOptions(m, fixed)
+	require.NoError(t, err)
+	fixed.Rand = bytes.NewReader(make([]byte, 64))
+	again, err = priv.SignWithOptions(m, fixed)
+	require.NoError(t, err)
+	require.Equal(t, sig.Bytes(), again.Bytes())
+
+	broken := errors.New("no entropy")
+	_, err = priv.SignWithOptions(m, &SignOptions{Hedged: true, Rand: iotest.ErrReader(broken)})
+	require.ErrorIs(t, err, broken)
+}
+
+// commitment recovers the commitment R = sB - cA of a signature
+func commitment(pub *PublicKey, sig *Signature) string {
+	R := (&edwards25519.Point{}).VarTimeDoubleScalarBaseMult(sig.c, (&edwards25519.Point{}).Negate(pub.Point), sig.s)
+	return hex.EncodeToString(R.Bytes())
+}
+
+func TestPrivateKey_SignWithOptions_NonceSeparation(t *testing.T) {
+	priv := RandomPrivateKey()
+	pub := priv.Public()
+	m := []byte("123456")
+	random := bytes.Repeat([]byte{7}, hedgeSize)
+	mail := &SignOptions{Context: "mail"}
+	digest, err := prehash(bytes.NewReader(m))
+	require.NoError(t, err)
+
+	// 拼接出与其他模式相同的哈希输入，随机数仍必须互不相同，否则两个签名即可解出私钥
+	sigs := []*Signature{
+		priv.Sign(m),
+		priv.Sign(append(mail.prefix(), m...)),
+		priv.Sign(append(append(mail.prefix(), random...), m...)),
+		priv.Sign(append(prehashPrefix(nil), digest...)),
+	}
+	for _, opts := range []struct {
+		m    []byte
+		opts *SignOptions
+	}{
+		{m, mail},
+		{m, &SignOptions{}},
+		{append(append([]byte(nil), random...), m...), mail},
+		{m, &SignOptions{Context: "mail", Hedged: true, Rand: bytes.NewReader(random)}},
+		{m, &SignOptions{Hedged: true, Rand: bytes.NewReader(random)}},
+		{digest, mail},
+		{append(prehashPrefix(nil), digest...), mail},
+	} {
+		sig, err := priv.SignWithOptions(opts.m, opts.opts)
+		require.NoError(t, err)
+		sigs = append(sigs, sig)
+	}
+	for _, opts := range []*SignOptions{nil, mail, {Context: "mail", Hedged: true, Rand: bytes.NewReader(random)}} {
+		sig, err := priv.SignReader(bytes.NewReader(m), opts)
+		require.NoError(t, err)
+		sigs = append(sigs, sig)
+	}
+
+	seen := make(map[string]int)
+	for i, sig := range sigs {
+		R := commitment(&pub, sig)
+		previous, ok := seen[R]
+		require.False(t, ok, "signatures %d and %d share R", previous, i)
+		seen[R] = i
+	}
+}
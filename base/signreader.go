@@ -0,0 +1,66 @@
+package base
+
+import (
+	"golang.org/x/crypto/blake2b"
+	"io"
+)
+
+const (
+	// 流式签名预哈希的域标签
+	prehashTag = "cpk-sign-prehash-v1"
+	// 流式签名的域标签，与 Sign、SignWithOptions 的签名互不相通
+	signPrehashTag = "cpk-sign-prehash-sig-v1"
+)
+
+// prehash returns the BLAKE2b-512 digest of the tagged stream
+func prehash(r io.Reader) ([]byte, error) {
+	hash, err := blake2b.New512(nil)
+	if err != nil {
+		panic(err)
+	}
+	hash.Write([]byte(prehashTag))
+	if _, err = io.Copy(hash, r); err != nil {
+		return nil, err
+	}
+	return hash.Sum(nil), nil
+}
+
+// prehashPrefix returns the prefix bound into the signature of a prehashed message
+func prehashPrefix(opts *SignOptions) []byte {
+	prefix := []byte(signPrehashTag)
+	if opts != nil {
+		prefix = append(prefix, opts.prefix()...)
+	}
+	return prefix
+}
+
+// SignReader signs the message read from r until EOF without holding it in memory, the
+// message is prehashed with BLAKE2b-512 and only the digest is signed, opts may be nil
+//
+// 预哈希与签名都带有独立的域标签，随机数在独立的预哈希模式下派生，
+// 流式签名不能当作 Sign 对摘要的签名使用，也不会与任何其他签名共用随机数
+func (p *PrivateKey) SignReader(r io.Reader, opts *SignOptions) (*Signature, error) {
+	digest, err := prehash(r)
+	if err != nil {
+		return nil, err
+	}
+	random, err := opts.hedge()
+	if err != nil {
+		return nil, err
+	}
+	_, s, c := p.sign(signModePrehash, prehashPrefix(opts), random, digest)
+	return &Signature{
+		s: s,
+		c: c,
+	}, nil
+}
+
+// VerifyReader verifies a signature of SignReader over the message read from r, the error
+// is only returned if reading fails
+func (p *PublicKey) VerifyReader(r io.Reader, sig *Signature, opts *SignOptions) (bool, error) {
+	digest, err := prehash(r)
+	if err != nil {
+		return false, err
+	}
+	return p.verify(prehashPrefix(opts), digest, sig), nil
+}
@@ -0,0 +1,134 @@
+package base
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"github.com/stretchr/testify/require"
+	"github.com/walegarrett/cpk-algs/base/edwards25519"
+	"golang.org/x/crypto/blake2b"
+	"io"
+	"testing"
+	"testing/iotest"
+)
+
+// patternReader yields n bytes of the repeating pattern 0, 1, ..., 250
+func patternReader(n int64) io.Reader {
+	buf := make([]byte, 251)
+	for i := range buf {
+		buf[i] = byte(i)
+	}
+	return io.LimitReader(&repeatReader{pattern: buf}, n)
+}
+
+type repeatReader struct {
+	pattern []byte
+	offset  int
+}
+
+func (r *repeatReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = r.pattern[r.offset]
+		r.offset = (r.offset + 1) % len(r.pattern)
+	}
+	return len(p), nil
+}
+
+func TestPrivateKey_SignReader(t *testing.T) {
+	var buf [64]byte
+	for i := range buf {
+		buf[i] = byte(i)
+	}
+	priv := PrivateKey{Scalar: (&edwards25519.Scalar{}).SetUniformBytes(buf[:])}
+	pub := priv.Public()
+	// 预哈希为 BLAKE2b-512(标签 || 消息)
+	digest, err := prehash(patternReader(3))
+	require.NoError(t, err)
+	expected := blake2b.Sum512([]byte(prehashTag + "\x00\x01\x02"))
+	require.Equal(t, expected[:], digest)
+
+	vectors := []struct {
+		size    int64
+		context *SignOptions
+		sig     string
+	}{
+		{0, nil, "bfb3bfe4c23a96bee8a3428287f2cce441535af2872806127809690097b3480e" +
+			"22ec07af7181ba8eec9b3978f22b8b3c64b1383ed8a2a71240bbe6834c59010d"},
+		{3, nil, "e9263722cd31fc96091b5e320691029408c2c90ae00e2c9f9bfb9659d3ccd800" +
+			"846b8d805feb63d1daeffd0315868cd2aadaa26eacaeb7d8aefefdb1fa3c3201"},
+		{1 << 20, nil, "cb7de4d8c6ee0db455c2eb0a1d8b7073aa7d51893829e537365932cbbecb1f07" +
+			"5381776d5e6ecc83f0f3da30f1c59059d67f4e997adbdc4d1600c26791bc1608"},
+		{1 << 20, &SignOptions{Context: "artifact"}, "30c9cdb0d08955fc80961711469a3664b123db4cc31ea64813058ceb933a2f02" +
+			"29435c35e1b1f0c2d1aecf44a9f65ff5b06128d15290d8bf8669c33eef9edc02"},
+	}
+	for _, vector := range vectors {
+		sig, err := priv.SignReader(patternReader(vector.size), vector.context)
+		require.NoError(t, err)
+		require.Equal(t, vector.sig, hex.EncodeToString(sig.Bytes()))
+		ok, err := pub.VerifyReader(iotest.OneByteReader(patternReader(vector.size)), sig, vector.context)
+		require.NoError(t, err)
+		require.True(t, ok)
+		ok, err = pub.VerifyReader(patternReader(vector.size+1), sig, vector.context)
+		require.NoError(t, err)
+		require.False(t, ok)
+	}
+}
+
+func TestPrivateKey_SignReader_DomainSeparation(t *testing.T) {
+	priv := RandomPrivateKey()
+	pub := priv.Public()
+	m := []byte("123456")
+	sig, err := priv.SignReader(bytes.NewReader(m), nil)
+	require.NoError(t, err)
+	// 流式签名与普通签名、带上下文的签名以及对摘要的普通签名互不相通
+	require.False(t, pub.Verify(m, sig))
+	digest, err := prehash(bytes.NewReader(m))
+	require.NoError(t, err)
+	require.False(t, pub.Verify(digest, sig))
+	ok, err := pub.VerifyReader(bytes.NewReader(m), priv.Sign(m), nil)
+	require.NoError(t, err)
+	require.False(t, ok)
+	ok, err = pub.VerifyReader(bytes.NewReader(m), sig, &SignOptions{})
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	// 对拼接出相同哈希输入的消息做普通签名或带上下文的签名，R 也必须不同
+	artifact := &SignOptions{Context: "artifact"}
+	withContext, err := priv.SignReader(bytes.NewReader(m), artifact)
+	require.NoError(t, err)
+	R := commitment(&pub, sig)
+	for _, other := range []*Signature{
+		priv.Sign(append(prehashPrefix(nil), digest...)),
+		priv.Sign(digest),
+	} {
+		require.NotEqual(t, R, commitment(&pub, other))
+		require.NotEqual(t, commitment(&pub, withContext), commitment(&pub, other))
+	}
+	for _, other := range []struct {
+		m    []byte
+		opts *SignOptions
+	}{
+		{digest, artifact},
+		{append(prehashPrefix(nil), digest...), artifact},
+		{append(prehashPrefix(artifact), digest...), nil},
+		{append(prehashPrefix(artifact), digest...), &SignOptions{}},
+	} {
+		otherSig, err := priv.SignWithOptions(other.m, other.opts)
+		require.NoError(t, err)
+		require.NotEqual(t, R, commitment(&pub, otherSig))
+		require.NotEqual(t, commitment(&pub, withContext), commitment(&pub, otherSig))
+	}
+
+	hedged := &SignOptions{Context: "artifact", Hedged: true}
+	sig, err = priv.SignReader(bytes.NewReader(m), hedged)
+	require.NoError(t, err)
+	ok, err = pub.VerifyReader(bytes.NewReader(m), sig, &SignOptions{Context: "artifact"})
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	broken := errors.New("disk failure")
+	_, err = priv.SignReader(iotest.ErrReader(broken), nil)
+	require.ErrorIs(t, err, broken)
+	_, err = pub.VerifyReader(io.MultiReader(bytes.NewReader(m), iotest.ErrReader(broken)), sig, hedged)
+	require.ErrorIs(t, err, broken)
+}
@@ -0,0 +1,323 @@
+package cpk
+
+import (
+	"fmt"
+	"github.com/walegarrett/cpk-algs/base"
+	"github.com/walegarrett/cpk-algs/base/edwards25519"
+	"golang.org/x/crypto/blake2b"
+	"sort"
+)
+
+// AssemblyProgress reports the state of a MatrixAssembler
+type AssemblyProgress struct {
+	// 已接收的分片数量（含同一节点的多个副本）
+	Received int
+	// 已接收分片的不同节点数量
+	Nodes int
+	// 相互一致的最大节点集合的大小
+	Consistent int
+	// 完成组合所需的一致节点数量
+	Needed int
+	// 与多数节点不一致的节点序号
+	Disagreeing []int64
+	// 同一节点的副本之间存在分歧的节点序号
+	Contested []int64
+	Done      bool
+}
+
+// maxAnchorSets bounds the anchor sets a MatrixAssembler may enumerate in one search
+const maxAnchorSets = 1 << 10
+
+// maxAssemblyWork bounds the scalar multiplications of one search of a MatrixAssembler
+const maxAssemblyWork = 1 << 16
+
+// pieceCandidate is one distinct version of the piece of a node and the replicas voting for it
+type pieceCandidate struct {
+	digest [32]byte
+	piece  PMPiece
+	votes  int
+	// 分片的随机线性组合，用于快速校验节点之间的一致性
+	combined *edwards25519.Point
+}
+
+// MatrixAssembler combines the public matrix from PMPieces arriving one by one from
+// possibly unreliable nodes and replicas, resolving disagreements by majority
+type MatrixAssembler struct {
+	params Params
+	quorum int
+	// 随机权重，分片一致当且仅当（以压倒性概率）其线性组合一致
+	weights    []*edwards25519.Scalar
+	candidates map[int64][]*pieceCandidate
+	received   int
+	// 最大一致集合及确定其多项式的 Threshold 个锚点，升序
+	consistent []int64
+	anchors    []int64
+	progress   AssemblyProgress
+}
+
+// NewMatrixAssembler returns an assembler that finishes once quorum nodes agree, quorum
+// below Threshold means Threshold
+//
+// 一个节点选出的分片改变时需要枚举所有 Threshold 个锚点的组合，并对每个组合检查所有节点，
+// 每次检查需要 Threshold 次标量乘法。组合数或总计算量超过上限的参数被拒绝
+func NewMatrixAssembler(params Params, quorum int) (*MatrixAssembler, error) {
+	if err := params.Validate(); err != nil {
+		return nil, err
+	}
+	sets := binomial(params.Nodes, params.Threshold)
+	if sets > maxAnchorSets {
+		return nil, fmt.Errorf("%w: too many anchor sets for the assembler", ErrInvalidParams)
+	}
+	if sets*params.Nodes*params.Threshold > maxAssemblyWork {
+		return nil, fmt.Errorf("%w: too much work to search the anchor sets of the assembler", ErrInvalidParams)
+	}
+	if quorum < params.Threshold {
+		quorum = params.Threshold
+	}
+	if quorum > params.Nodes {
+		return nil, ErrInsufficientPieces
+	}
+	assembler := &MatrixAssembler{
+		params:     params,
+		quorum:     quorum,
+		weights:    make([]*edwards25519.Scalar, params.Size()),
+		candidates: make(map[int64][]*pieceCandidate),
+	}
+	for e := range assembler.weights {
+		assembler.weights[e] = base.RandomPrivateKey().Scalar
+	}
+	assembler.progress = assembler.evaluate()
+	return assembler, nil
+}
+
+// Add accepts one piece and returns the updated progress
+func (assembler *MatrixAssembler) Add(pmPiece PMPiece) (AssemblyProgress, error) {
+	params := assembler.params
+	if pmPiece.Index < 0 || pmPiece.Index >= int64(params.Nodes) {
+		return assembler.Progress(), ErrIndexOutOfRange
+	}
+	if err := checkPoints(pmPiece.Piece, params.Size()); err != nil {
+		return assembler.Progress(), err
+	}
+	var serializer base.Serializer
+	pmPiece.Serialize(&serializer)
+	digest := blake2b.Sum256(serializer)
+	previous := assembler.elected(pmPiece.Index)
+	assembler.received++
+	found := false
+	for _, candidate := range assembler.candidates[pmPiece.Index] {
+		if candidate.digest == digest {
+			candidate.votes++
+			found = true
+			break
+		}
+	}
+	if !found {
+		piece := PMPiece{Index: pmPiece.Index, Piece: make([]base.Ed25519Point, len(pmPiece.Piece))}
+		copy(piece.Piece, pmPiece.Piece)
+		assembler.candidates[pmPiece.Index] = append(assembler.candidates[pmPiece.Index], &pieceCandidate{
+			digest:   digest,
+			piece:    piece,
+			votes:    1,
+			combined: assembler.combine(piece),
+		})
+	}
+	switch {
+	case previous == nil:
+		assembler.extend(pmPiece.Index)
+	case assembler.elected(pmPiece.Index) != previous:
+		// 选出的分片改变，原来的一致集合可能不再一致
+		assembler.search(-1)
+	}
+	assembler.progress = assembler.evaluate()
+	return assembler.Progress(), nil
+}
+
+// Progress returns the current progress
+func (assembler *MatrixAssembler) Progress() AssemblyProgress {
+	progress := assembler.progress
+	progress.Disagreeing = append([]int64(nil), progress.Disagreeing...)
+	progress.Contested = append([]int64(nil), progress.Contested...)
+	return progress
+}
+
+// Client returns a client holding the assembled public matrix, or ErrInsufficientPieces
+// while not enough consistent pieces have arrived
+func (assembler *MatrixAssembler) Client() (*Client, error) {
+	if !assembler.progress.Done {
+		return nil, ErrInsufficientPieces
+	}
+	pieces := make([]PMPiece, 0, len(assembler.consistent))
+	for _, index := range assembler.consistent {
+		pieces = append(pieces, assembler.elected(index).piece)
+	}
+	var client Client
+	client.params = assembler.params
+	err := client.CombinePMPieces(pieces)
+	if err != nil {
+		return nil, err
+	}
+	return &client, nil
+}
+
+// combine returns the random linear combination of the piece elements
+func (assembler *MatrixAssembler) combine(pmPiece PMPiece) *edwards25519.Point {
+	sum := edwards25519.NewIdentityPoint()
+	for e := range pmPiece.Piece {
+		sum.Add(sum, (&edwards25519.Point{}).ScalarMult(assembler.weights[e], pmPiece.Piece[e].Point))
+	}
+	return sum
+}
+
+// elected returns the version of the piece of the node with the most votes, the earliest on ties
+func (assembler *MatrixAssembler) elected(index int64) *pieceCandidate {
+	var best *pieceCandidate
+	for _, candidate := range assembler.candidates[index] {
+		if best == nil || candidate.votes > best.votes {
+			best = candidate
+		}
+	}
+	return best
+}
+
+// extend updates the largest consistent set with the first piece of the node
+//
+// 不含新节点的集合大小不变，只需检查新节点是否位于当前锚点的多项式上，否则只枚举包含新节点的锚点组合
+func (assembler *MatrixAssembler) extend(index int64) {
+	if assembler.anchors != nil && assembler.agrees(assembler.anchors, index) {
+		assembler.consistent = insertIndex(assembler.consistent, index)
+		return
+	}
+	assembler.search(index)
+}
+
+// search enumerates the anchor sets containing the node, or all the anchor sets if the
+// node is negative, and keeps the largest set of nodes agreeing with them
+func (assembler *MatrixAssembler) search(index int64) {
+	threshold := assembler.params.Threshold
+	indices := sortedIndices(assembler.candidates)
+	pool, k := indices, threshold
+	if index < 0 {
+		assembler.consistent, assembler.anchors = nil, nil
+	} else {
+		pool = make([]int64, 0, len(indices))
+		for _, other := range indices {
+			if other != index {
+				pool = append(pool, other)
+			}
+		}
+		k--
+	}
+	if len(indices) < threshold {
+		return
+	}
+	combinations(len(pool), k, func(picked []int) bool {
+		var anchors []int64
+		for _, p := range picked {
+			anchors = insertIndex(anchors, pool[p])
+		}
+		if index >= 0 {
+			anchors = insertIndex(anchors, index)
+		}
+		var agreeing []int64
+		for _, other := range indices {
+			if assembler.agrees(anchors, other) {
+				agreeing = append(agreeing, other)
+			}
+		}
+		if len(agreeing) > len(assembler.consistent) {
+			assembler.consistent, assembler.anchors = agreeing, anchors
+		}
+		return len(assembler.consistent) < len(indices)
+	})
+}
+
+// evaluate reports the progress of the largest consistent set
+func (assembler *MatrixAssembler) evaluate() AssemblyProgress {
+	progress := AssemblyProgress{
+		Received:   assembler.received,
+		Nodes:      len(assembler.candidates),
+		Needed:     assembler.quorum,
+		Consistent: len(assembler.consistent),
+	}
+	indices := sortedIndices(assembler.candidates)
+	for _, index := range indices {
+		if len(assembler.candidates[index]) > 1 {
+			progress.Contested = append(progress.Contested, index)
+		}
+		if assembler.consistent != nil && !containsIndex(assembler.consistent, index) {
+			progress.Disagreeing = append(progress.Disagreeing, index)
+		}
+	}
+	// 一致集合需达到法定数量，且占已接收节点的多数
+	progress.Done = len(assembler.consistent) >= assembler.quorum && 2*len(assembler.consistent) > len(indices)
+	return progress
+}
+
+// agrees checks whether the elected piece of the node lies on the polynomial through the anchors
+func (assembler *MatrixAssembler) agrees(anchors []int64, index int64) bool {
+	if containsIndex(anchors, index) {
+		return true
+	}
+	coefficients := lagrangeCoefficients(anchors, index)
+	expected := edwards25519.NewIdentityPoint()
+	for i, anchor := range anchors {
+		expected.Add(expected, (&edwards25519.Point{}).ScalarMult(coefficients[i], assembler.elected(anchor).combined))
+	}
+	return expected.Equal(assembler.elected(index).combined) == 1
+}
+
+func containsIndex(indices []int64, index int64) bool {
+	i := sort.Search(len(indices), func(i int) bool {
+		return indices[i] >= index
+	})
+	return i < len(indices) && indices[i] == index
+}
+
+// insertIndex inserts index into the sorted indices unless it is already there
+func insertIndex(indices []int64, index int64) []int64 {
+	i := sort.Search(len(indices), func(i int) bool {
+		return indices[i] >= index
+	})
+	if i < len(indices) && indices[i] == index {
+		return indices
+	}
+	indices = append(indices, 0)
+	copy(indices[i+1:], indices[i:])
+	indices[i] = index
+	return indices
+}
+
+// binomial returns C(n, k), or maxAnchorSets+1 if it is larger
+func binomial(n, k int) int {
+	if k > n-k {
+		k = n - k
+	}
+	result := 1
+	for i := 0; i < k; i++ {
+		result = result * (n - i) / (i + 1)
+		if result > maxAnchorSets {
+			return maxAnchorSets + 1
+		}
+	}
+	return result
+}
+
+// combinations calls visit with every k-subset of [0, n) in lexicographic order until visit returns false
+func combinations(n, k int, visit func([]int) bool) {
+	picked := make([]int, k)
+	var walk func(start, depth int) bool
+	walk = func(start, depth int) bool {
+		if depth == k {
+			return visit(picked)
+		}
+		for i := start; i <= n-(k-depth); i++ {
+			picked[depth] = i
+			if !walk(i+1, depth+1) {
+				return false
+			}
+		}
+		return true
+	}
+	walk(0, 0)
+}
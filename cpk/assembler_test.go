@@ -0,0 +1,135 @@
+package cpk
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestMatrixAssembler(t *testing.T) {
+	var pmPieces, fakePieces [4]PMPiece
+	for i := range pmPieces {
+		var distributedCA, attacker DistributedCA
+		require.NoError(t, distributedCA.InitDistributedCA(int64(i), "gen_key"))
+		require.NoError(t, attacker.InitDistributedCA(int64(i), "attacker"))
+		var err error
+		pmPieces[i], err = distributedCA.ExportPublicMatrixPiece()
+		require.NoError(t, err)
+		fakePieces[i], err = attacker.ExportPublicMatrixPiece()
+		require.NoError(t, err)
+	}
+	assembler, err := NewMatrixAssembler(DefaultParams(), 3)
+	require.NoError(t, err)
+	_, err = assembler.Client()
+	require.ErrorIs(t, err, ErrInsufficientPieces)
+
+	_, err = assembler.Add(pmPieces[0])
+	require.NoError(t, err)
+	// 节点1的副本之间存在分歧，按多数选出
+	_, err = assembler.Add(fakePieces[1])
+	require.NoError(t, err)
+	_, err = assembler.Add(pmPieces[1])
+	require.NoError(t, err)
+	progress, err := assembler.Add(pmPieces[1])
+	require.NoError(t, err)
+	require.Equal(t, 4, progress.Received)
+	require.Equal(t, 2, progress.Nodes)
+	require.Equal(t, 2, progress.Consistent)
+	require.Equal(t, []int64{1}, progress.Contested)
+	require.False(t, progress.Done)
+
+	progress, err = assembler.Add(fakePieces[2])
+	require.NoError(t, err)
+	require.Equal(t, 2, progress.Consistent)
+	require.False(t, progress.Done)
+
+	progress, err = assembler.Add(pmPieces[3])
+	require.NoError(t, err)
+	require.Equal(t, 3, progress.Consistent)
+	require.Equal(t, []int64{2}, progress.Disagreeing)
+	require.True(t, progress.Done)
+	require.Equal(t, progress, assembler.Progress())
+
+	_, err = assembler.Add(PMPiece{Index: 4, Piece: pmPieces[0].Piece})
+	require.ErrorIs(t, err, ErrIndexOutOfRange)
+
+	client, err := assembler.Client()
+	require.NoError(t, err)
+	var ca CA
+	require.NoError(t, ca.InitCA("gen_key"))
+	sk, err := ca.QuerySK("alice")
+	require.NoError(t, err)
+	pk, err := client.QueryPK("alice")
+	require.NoError(t, err)
+	require.Equal(t, 1, pk.Equal(sk.Public().Point))
+	_, err = client.PartialPK("alice", 2)
+	require.ErrorIs(t, err, ErrPartialKeyUnavailable)
+}
+
+func TestMatrixAssembler_Search(t *testing.T) {
+	params := Params{Rows: 4, SubsSize: 2, Blocks: 2, Threshold: 3, Nodes: 7}
+	pieces := func(genKey string) []PMPiece {
+		var ca CA
+		require.NoError(t, ca.InitCAWithParams(params, genKey))
+		distributedCAs, err := ca.SplitDistributedCAs()
+		require.NoError(t, err)
+		pmPieces := make([]PMPiece, len(distributedCAs))
+		for i := range distributedCAs {
+			pmPieces[i], err = distributedCAs[i].ExportPublicMatrixPiece()
+			require.NoError(t, err)
+		}
+		return pmPieces
+	}
+	pmPieces, fakePieces := pieces("gen_key"), pieces("attacker")
+
+	assembler, err := NewMatrixAssembler(params, 4)
+	require.NoError(t, err)
+	// 先到达的三个伪造分片相互一致，之后诚实节点形成更大的一致集合
+	for i := 0; i < 3; i++ {
+		_, err = assembler.Add(fakePieces[i])
+		require.NoError(t, err)
+	}
+	var progress AssemblyProgress
+	for i := 3; i < 7; i++ {
+		progress, err = assembler.Add(pmPieces[i])
+		require.NoError(t, err)
+	}
+	require.Equal(t, 4, progress.Consistent)
+	require.Equal(t, []int64{0, 1, 2}, progress.Disagreeing)
+	require.True(t, progress.Done)
+
+	// 副本多数改变节点选出的分片后重新搜索
+	for i := 0; i < 2; i++ {
+		_, err = assembler.Add(pmPieces[0])
+		require.NoError(t, err)
+	}
+	progress = assembler.Progress()
+	require.Equal(t, 5, progress.Consistent)
+	require.Equal(t, []int64{1, 2}, progress.Disagreeing)
+	require.Equal(t, []int64{0}, progress.Contested)
+	client, err := assembler.Client()
+	require.NoError(t, err)
+	var ca CA
+	require.NoError(t, ca.InitCAWithParams(params, "gen_key"))
+	sk, err := ca.QuerySK("alice")
+	require.NoError(t, err)
+	pk, err := client.QueryPK("alice")
+	require.NoError(t, err)
+	require.Equal(t, 1, pk.Equal(sk.Public().Point))
+
+	// 锚点组合过多的参数被拒绝
+	_, err = NewMatrixAssembler(Params{Rows: 4, SubsSize: 2, Blocks: 2, Threshold: 8, Nodes: 16}, 0)
+	require.ErrorIs(t, err, ErrInvalidParams)
+	// 组合数很少，但每个组合都要检查大量节点
+	_, err = NewMatrixAssembler(Params{Rows: 4, SubsSize: 2, Blocks: 2, Threshold: 1023, Nodes: 1024}, 0)
+	require.ErrorIs(t, err, ErrInvalidParams)
+	require.Equal(t, 20, binomial(20, 19))
+}
+
+func TestCombinations(t *testing.T) {
+	var got [][]int
+	combinations(4, 2, func(picked []int) bool {
+		got = append(got, append([]int(nil), picked...))
+		return len(got) < 5
+	})
+	require.Equal(t, [][]int{{0, 1}, {0, 2}, {0, 3}, {1, 2}, {1, 3}}, got)
+}
@@ -0,0 +1,91 @@
+package cpk
+
+import (
+	"context"
+	"github.com/walegarrett/cpk-algs/base"
+	"github.com/walegarrett/cpk-algs/base/edwards25519"
+)
+
+// SecretMatrixBackend holds the secret elements of a private matrix, or the shares of a
+// distributed CA, and only reveals sums selected by identities and the public matrix
+//
+// 后端根据身份编码自行选取矩阵元素，而不是接受任意的下标，避免前端逐个读出矩阵元素
+type SecretMatrixBackend interface {
+	// Params returns the matrix layout
+	Params() Params
+	// SumElements returns the sum of the secret elements the identity encoding maps to
+	SumElements(ctx context.Context, ident []byte) (*edwards25519.Scalar, error)
+	// PublicMatrix returns every secret element multiplied by the base point
+	PublicMatrix(ctx context.Context) ([]base.Ed25519Point, error)
+}
+
+// MemoryBackend keeps the secret elements in memory
+type MemoryBackend struct {
+	params   Params
+	elements []base.Ed25519Scala
+}
+
+// NewMemoryBackend returns a backend holding a copy of the elements
+func NewMemoryBackend(params Params, elements []base.Ed25519Scala) (*MemoryBackend, error) {
+	if err := params.Validate(); err != nil {
+		return nil, err
+	}
+	if err := checkScalars(elements, params.Size()); err != nil {
+		return nil, err
+	}
+	backend := &MemoryBackend{params: params, elements: make([]base.Ed25519Scala, len(elements))}
+	for i := range elements {
+		backend.elements[i].Scalar = edwards25519.NewScalar().Set(elements[i].Scalar)
+	}
+	return backend, nil
+}
+
+func (backend *MemoryBackend) Params() Params {
+	return backend.params
+}
+
+func (backend *MemoryBackend) SumElements(ctx context.Context, ident []byte) (*edwards25519.Scalar, error) {
+	return sumElements(backend.params, backend.elements, ident)
+}
+
+func (backend *MemoryBackend) PublicMatrix(ctx context.Context) ([]base.Ed25519Point, error) {
+	return publicMatrixOf(ctx, backend.elements)
+}
+
+// sumElements sums the elements selected by the identity encoding
+func sumElements(params Params, elements []base.Ed25519Scala, ident []byte) (*edwards25519.Scalar, error) {
+	if len(elements) != params.Size() {
+		return nil, ErrMatrixNotLoaded
+	}
+	indices, err := params.selectIndices(ident)
+	if err != nil {
+		return nil, err
+	}
+	sum := edwards25519.NewScalar()
+	for _, index := range indices {
+		sum.Add(sum, elements[index].Scalar)
+	}
+	return sum, nil
+}
+
+// NewCAWithBackend returns a CA issuing keys through the backend, the CA never holds the
+// private matrix, so it cannot be serialized or split
+func NewCAWithBackend(backend SecretMatrixBackend) (*CA, error) {
+	if err := backend.Params().Validate(); err != nil {
+		return nil, err
+	}
+	return &CA{params: backend.Params(), backend: backend}, nil
+}
+
+// NewDistributedCAWithBackend returns a distributed CA with the given index whose shares are
+// held by the backend, commitments may be nil
+func NewDistributedCAWithBackend(index int64, backend SecretMatrixBackend, commitments *Commitments) (*DistributedCA, error) {
+	params := backend.Params()
+	if err := params.Validate(); err != nil {
+		return nil, err
+	}
+	if index < 0 || index >= int64(params.Nodes) {
+		return nil, ErrIndexOutOfRange
+	}
+	return &DistributedCA{params: params, backend: backend, commitments: commitments, Index: index}, nil
+}
@@ -0,0 +1,31 @@
+//go:build linux
+
+package cpk
+
+import (
+	"net"
+	"syscall"
+)
+
+// checkPeer checks the user of the peer process with SO_PEERCRED
+func checkPeer(conn *net.UnixConn, uid int) error {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var cred *syscall.Ucred
+	var credErr error
+	err = raw.Control(func(fd uintptr) {
+		cred, credErr = syscall.GetsockoptUcred(int(fd), syscall.SOL_SOCKET, syscall.SO_PEERCRED)
+	})
+	if err != nil {
+		return err
+	}
+	if credErr != nil {
+		return credErr
+	}
+	if int(cred.Uid) != uid {
+		return ErrBackendPeer
+	}
+	return nil
+}
@@ -0,0 +1,428 @@
+package cpk
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"github.com/walegarrett/cpk-algs/base"
+	"github.com/walegarrett/cpk-algs/base/edwards25519"
+	"github.com/walegarrett/cpk-algs/logger"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// backendOp defines the operations of the backend protocol
+type backendOp int32
+
+const (
+	backendOpParams backendOp = iota + 1
+	backendOpSumElements
+	backendOpPublicMatrix
+)
+
+const (
+	// 协议握手标签，每个请求都以该标签开头
+	backendProtocolTag = "cpk-backend-v1"
+	// 请求帧的最大长度，身份编码不会超过该长度
+	maxBackendRequest = 1 << 16
+	// 响应帧除矩阵以外的最大长度
+	maxBackendResponseHeader = 1 << 10
+)
+
+// writeFrame writes a frame prefixed with its length
+func writeFrame(w io.Writer, payload []byte) error {
+	var buf [4]byte
+	binary.LittleEndian.PutUint32(buf[:], uint32(len(payload)))
+	if _, err := w.Write(append(buf[:], payload...)); err != nil {
+		return err
+	}
+	return nil
+}
+
+// readFrame reads a frame no longer than limit
+func readFrame(r io.Reader, limit int) ([]byte, error) {
+	var buf [4]byte
+	if _, err := io.ReadFull(r, buf[:]); err != nil {
+		return nil, err
+	}
+	l := binary.LittleEndian.Uint32(buf[:])
+	if uint64(l) > uint64(limit) {
+		return nil, errors.New("cpk: backend frame too large")
+	}
+	payload := make([]byte, l)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, err
+	}
+	return payload, nil
+}
+
+// ListenBackendUnix listens on the unix socket at path, removing a stale socket file first,
+// only processes of the owner of the process may connect to the socket
+//
+// 套接字在权限为 0700 的临时目录中创建并设为 0600 后才链接到 path，其他用户没有机会在 chmod
+// 之前连接；接受连接时还会检查对端进程的用户
+func ListenBackendUnix(path string) (net.Listener, error) {
+	if info, err := os.Lstat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		if err = os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+	dir, err := os.MkdirTemp(filepath.Dir(path), ".cpk-backend-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	tmp := filepath.Join(dir, "backend.sock")
+	listener, err := net.ListenUnix("unix", &net.UnixAddr{Name: tmp, Net: "unix"})
+	if err != nil {
+		return nil, err
+	}
+	// 关闭时删除的是 path 而不是临时文件
+	listener.SetUnlinkOnClose(false)
+	if err = os.Chmod(tmp, 0600); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	// 与 rename 不同，link 不会覆盖 path 上已有的文件
+	if err = os.Link(tmp, path); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return &unixListener{UnixListener: listener, path: path, uid: os.Getuid()}, nil
+}
+
+// unixListener accepts the connections of the processes of one user and removes the
+// socket file when closed
+type unixListener struct {
+	*net.UnixListener
+	path string
+	uid  int
+	once sync.Once
+}
+
+func (listener *unixListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := listener.AcceptUnix()
+		if err != nil {
+			return nil, err
+		}
+		if err = checkPeer(conn, listener.uid); err != nil {
+			logger.Logger.Debug("backend connection rejected", "err", err)
+			conn.Close()
+			continue
+		}
+		return conn, nil
+	}
+}
+
+func (listener *unixListener) Close() error {
+	err := listener.UnixListener.Close()
+	listener.once.Do(func() {
+		os.Remove(listener.path)
+	})
+	return err
+}
+
+// BackendServer serves a SecretMatrixBackend to the issuing front ends, the secret elements
+// never leave the process of the server
+type BackendServer struct {
+	backend SecretMatrixBackend
+
+	mu        sync.Mutex
+	listeners map[net.Listener]struct{}
+	conns     map[net.Conn]struct{}
+	closed    bool
+	wg        sync.WaitGroup
+}
+
+// NewBackendServer returns a server of the backend
+func NewBackendServer(backend SecretMatrixBackend) *BackendServer {
+	return &BackendServer{
+		backend:   backend,
+		listeners: make(map[net.Listener]struct{}),
+		conns:     make(map[net.Conn]struct{}),
+	}
+}
+
+// Serve accepts connections on the listener until the listener or the server is closed
+func (server *BackendServer) Serve(listener net.Listener) error {
+	server.mu.Lock()
+	if server.closed {
+		server.mu.Unlock()
+		return net.ErrClosed
+	}
+	server.listeners[listener] = struct{}{}
+	server.mu.Unlock()
+	defer func() {
+		server.mu.Lock()
+		delete(server.listeners, listener)
+		server.mu.Unlock()
+	}()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			server.mu.Lock()
+			closed := server.closed
+			server.mu.Unlock()
+			if closed {
+				return net.ErrClosed
+			}
+			return err
+		}
+		server.mu.Lock()
+		if server.closed {
+			server.mu.Unlock()
+			conn.Close()
+			return net.ErrClosed
+		}
+		server.conns[conn] = struct{}{}
+		server.wg.Add(1)
+		server.mu.Unlock()
+		go server.serveConn(conn)
+	}
+}
+
+// Close stops the listeners, closes the connections and waits for the pending requests
+func (server *BackendServer) Close() error {
+	server.mu.Lock()
+	server.closed = true
+	for listener := range server.listeners {
+		listener.Close()
+	}
+	for conn := range server.conns {
+		conn.Close()
+	}
+	server.mu.Unlock()
+	server.wg.Wait()
+	return nil
+}
+
+func (server *BackendServer) serveConn(conn net.Conn) {
+	defer func() {
+		conn.Close()
+		server.mu.Lock()
+		delete(server.conns, conn)
+		server.mu.Unlock()
+		server.wg.Done()
+	}()
+	for {
+		request, err := readFrame(conn, maxBackendRequest)
+		if err != nil {
+			if err != io.EOF {
+				logger.Logger.Debug("backend connection closed", "err", err)
+			}
+			return
+		}
+		response := server.handle(request)
+		if err = writeFrame(conn, response); err != nil {
+			logger.Logger.Debug("backend write response failed", "err", err)
+			return
+		}
+	}
+}
+
+// handle returns the response to the request, the response starts with a flag of success
+// 失败时只返回错误信息，不返回任何矩阵数据
+func (server *BackendServer) handle(request []byte) []byte {
+	var serializer base.Serializer
+	payload, err := server.dispatch(request)
+	if err != nil {
+		serializer.WriteBool(false)
+		serializer.WriteString(err.Error())
+		return serializer
+	}
+	serializer.WriteBool(true)
+	serializer.WriteBytes(payload)
+	return serializer
+}
+
+func (server *BackendServer) dispatch(request []byte) ([]byte, error) {
+	deserializer, err := base.NewDeserializer(request)
+	if err != nil {
+		return nil, err
+	}
+	var tag string
+	if _, err = deserializer.ReadString(&tag); err != nil || tag != backendProtocolTag {
+		return nil, errors.New("unknown protocol")
+	}
+	var op int32
+	if _, err = deserializer.ReadInt32(&op); err != nil {
+		return nil, err
+	}
+	var ident []byte
+	if _, err = deserializer.ReadBytesWithLength(&ident); err != nil {
+		return nil, err
+	}
+	if err = checkConsumed(deserializer); err != nil {
+		return nil, err
+	}
+	var serializer base.Serializer
+	switch backendOp(op) {
+	case backendOpParams:
+		params := server.backend.Params()
+		params.Serialize(&serializer)
+	case backendOpSumElements:
+		sum, err := server.backend.SumElements(context.Background(), ident)
+		if err != nil {
+			return nil, err
+		}
+		serializer.WriteBytes(sum.Bytes())
+	case backendOpPublicMatrix:
+		publicMatrix, err := server.backend.PublicMatrix(context.Background())
+		if err != nil {
+			return nil, err
+		}
+		serializer.WriteInt64(int64(len(publicMatrix)))
+		for index := range publicMatrix {
+			serializer.WriteSerializable(&publicMatrix[index])
+		}
+	default:
+		return nil, errors.New("unknown operation")
+	}
+	return serializer, nil
+}
+
+// RemoteBackend is a SecretMatrixBackend served by a BackendServer over a unix socket
+type RemoteBackend struct {
+	network string
+	address string
+	params  Params
+	dialer  net.Dialer
+}
+
+// DialBackend connects to the backend daemon listening on the unix socket at path and
+// fetches its params, every later operation opens a new connection
+func DialBackend(ctx context.Context, path string) (*RemoteBackend, error) {
+	backend := &RemoteBackend{network: "unix", address: path}
+	response, err := backend.call(ctx, backendOpParams, nil, maxBackendResponseHeader)
+	if err != nil {
+		return nil, err
+	}
+	deserializer, err := base.NewDeserializer(response)
+	if err != nil {
+		return nil, err
+	}
+	if err = backend.params.Deserialize(deserializer); err != nil {
+		return nil, err
+	}
+	if err = checkConsumed(deserializer); err != nil {
+		return nil, err
+	}
+	return backend, nil
+}
+
+func (backend *RemoteBackend) Params() Params {
+	return backend.params
+}
+
+func (backend *RemoteBackend) SumElements(ctx context.Context, ident []byte) (*edwards25519.Scalar, error) {
+	response, err := backend.call(ctx, backendOpSumElements, ident, maxBackendResponseHeader)
+	if err != nil {
+		return nil, err
+	}
+	deserializer, err := base.NewDeserializer(response)
+	if err != nil {
+		return nil, err
+	}
+	sum, err := readScalars(deserializer, 1)
+	if err != nil {
+		return nil, err
+	}
+	if err = checkConsumed(deserializer); err != nil {
+		return nil, err
+	}
+	return sum[0].Scalar, nil
+}
+
+func (backend *RemoteBackend) PublicMatrix(ctx context.Context) ([]base.Ed25519Point, error) {
+	limit := maxBackendResponseHeader + backend.params.Size()*int(new(base.Ed25519Point).SerializedByteSize())
+	response, err := backend.call(ctx, backendOpPublicMatrix, nil, limit)
+	if err != nil {
+		return nil, err
+	}
+	deserializer, err := base.NewDeserializer(response)
+	if err != nil {
+		return nil, err
+	}
+	var l int64
+	if _, err = deserializer.ReadInt64(&l); err != nil {
+		return nil, err
+	}
+	if l != int64(backend.params.Size()) {
+		return nil, &ErrMatrixSizeMismatch{Expected: backend.params.Size(), Actual: int(l)}
+	}
+	publicMatrix, err := readPoints(deserializer, l)
+	if err != nil {
+		return nil, err
+	}
+	if err = checkConsumed(deserializer); err != nil {
+		return nil, err
+	}
+	return publicMatrix, nil
+}
+
+// call sends one request on a new connection and returns the payload of the response
+func (backend *RemoteBackend) call(ctx context.Context, op backendOp, ident []byte, limit int) ([]byte, error) {
+	if len(ident) > maxBackendRequest/2 {
+		return nil, errors.New("cpk: identity too long")
+	}
+	conn, err := backend.dialer.DialContext(ctx, backend.network, backend.address)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	// ctx 取消时通过设置过期的截止时间中断读写
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.SetDeadline(time.Unix(1, 0))
+		case <-stop:
+		}
+	}()
+
+	var request base.Serializer
+	request.WriteString(backendProtocolTag)
+	request.WriteInt32(int32(op))
+	request.WriteBytesWithLength(ident)
+	if err = writeFrame(conn, request); err != nil {
+		return nil, backend.contextErr(ctx, err)
+	}
+	response, err := readFrame(conn, limit)
+	if err != nil {
+		return nil, backend.contextErr(ctx, err)
+	}
+	deserializer, err := base.NewDeserializer(response)
+	if err != nil {
+		return nil, err
+	}
+	var ok bool
+	if _, err = deserializer.ReadBool(&ok); err != nil {
+		return nil, err
+	}
+	if !ok {
+		var message string
+		if _, err = deserializer.ReadString(&message); err != nil {
+			return nil, err
+		}
+		return nil, &ErrRemoteBackend{Message: message}
+	}
+	return response[1:], nil
+}
+
+// contextErr prefers the error of the context over the network error it caused
+func (backend *RemoteBackend) contextErr(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
@@ -0,0 +1,208 @@
+package cpk
+
+import (
+	"context"
+	"github.com/stretchr/testify/require"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestNewCAWithBackend(t *testing.T) {
+	params := Params{Rows: 16, SubsSize: 4, Blocks: 4, Threshold: 2, Nodes: 3}
+	var ca CA
+	require.NoError(t, ca.InitCAWithParams(params, "gen_key"))
+	backend, err := NewMemoryBackend(params, ca.privateMatrix)
+	require.NoError(t, err)
+	_, err = NewMemoryBackend(params, ca.privateMatrix[1:])
+	require.Error(t, err)
+
+	front, err := NewCAWithBackend(backend)
+	require.NoError(t, err)
+	domain := Domain{Namespace: "mail", Version: 1}
+	front, err = front.WithDomain(domain)
+	require.NoError(t, err)
+	sk, err := front.QuerySK("alice")
+	require.NoError(t, err)
+	mailCA, err := ca.WithDomain(domain)
+	require.NoError(t, err)
+	expected, err := mailCA.QuerySK("alice")
+	require.NoError(t, err)
+	require.Equal(t, 1, sk.Scalar.Equal(expected.Scalar))
+
+	client := Client{}
+	require.NoError(t, front.ExportPublicMatrixForClient(&client))
+	mailClient, err := client.WithDomain(domain)
+	require.NoError(t, err)
+	pk, err := mailClient.QueryPK("alice")
+	require.NoError(t, err)
+	require.Equal(t, 1, pk.Equal(sk.Public().Point))
+
+	// 前端不持有私钥矩阵，无法导出或拆分
+	_, err = front.MarshalBinary()
+	require.ErrorIs(t, err, ErrMatrixNotLoaded)
+	_, err = front.SplitDistributedCAs()
+	require.ErrorIs(t, err, ErrMatrixNotLoaded)
+}
+
+func TestNewDistributedCAWithBackend(t *testing.T) {
+	params := Params{Rows: 16, SubsSize: 4, Blocks: 4, Threshold: 2, Nodes: 3}
+	var ca CA
+	require.NoError(t, ca.InitCAWithParams(params, "gen_key"))
+	distributedCAs, err := ca.SplitDistributedCAs()
+	require.NoError(t, err)
+	commitments, err := distributedCAs[0].ExportCommitments()
+	require.NoError(t, err)
+
+	fronts := make([]*DistributedCA, 0, params.Threshold)
+	for _, index := range []int64{2, 0} {
+		backend, err := NewMemoryBackend(params, distributedCAs[index].privateMatrixPiece)
+		require.NoError(t, err)
+		front, err := NewDistributedCAWithBackend(index, backend, commitments)
+		require.NoError(t, err)
+		require.NoError(t, front.VerifyShares())
+		fronts = append(fronts, front)
+	}
+	_, err = NewDistributedCAWithBackend(3, fronts[0].backend, commitments)
+	require.ErrorIs(t, err, ErrIndexOutOfRange)
+	// 分片与承诺不一致
+	wrong, err := NewDistributedCAWithBackend(1, fronts[0].backend, commitments)
+	require.NoError(t, err)
+	var inconsistent *ErrInconsistentPiece
+	require.ErrorAs(t, wrong.VerifyShares(), &inconsistent)
+
+	var skPieces []SKPiece
+	var pmPieces []PMPiece
+	for _, front := range fronts {
+		skPiece, err := front.QuerySK("alice")
+		require.NoError(t, err)
+		skPieces = append(skPieces, skPiece)
+		pmPiece, err := front.ExportPublicMatrixPiece()
+		require.NoError(t, err)
+		pmPieces = append(pmPieces, pmPiece)
+	}
+	client := Client{params: params}
+	require.NoError(t, client.CombinePMPieces(pmPieces))
+	pk, err := client.QueryPK("alice")
+	require.NoError(t, err)
+	_, err = client.CombineSKPieces(skPieces, *pk)
+	require.NoError(t, err)
+}
+
+func TestRemoteBackend(t *testing.T) {
+	params := Params{Rows: 16, SubsSize: 4, Blocks: 4, Threshold: 2, Nodes: 3}
+	var ca CA
+	require.NoError(t, ca.InitCAWithParams(params, "gen_key"))
+	backend, err := NewMemoryBackend(params, ca.privateMatrix)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "backend.sock")
+	listener, err := ListenBackendUnix(path)
+	require.NoError(t, err)
+	// 套接字只有所有者可以连接，临时目录已删除
+	info, err := os.Lstat(path)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	server := NewBackendServer(backend)
+	served := make(chan error, 1)
+	go func() {
+		served <- server.Serve(listener)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	remote, err := DialBackend(ctx, path)
+	require.NoError(t, err)
+	require.Equal(t, params, remote.Params())
+
+	front, err := NewCAWithBackend(remote)
+	require.NoError(t, err)
+	for _, ident := range []string{"alice", "bob", ""} {
+		sk, err := front.QuerySK(ident)
+		require.NoError(t, err)
+		expected, err := ca.QuerySK(ident)
+		require.NoError(t, err)
+		require.Equal(t, 1, sk.Scalar.Equal(expected.Scalar))
+	}
+	client := Client{}
+	require.NoError(t, front.ExportPublicMatrixForClient(&client))
+	expected := Client{}
+	require.NoError(t, ca.ExportPublicMatrixForClient(&expected))
+	fingerprint, err := client.Fingerprint()
+	require.NoError(t, err)
+	expectedFingerprint, err := expected.Fingerprint()
+	require.NoError(t, err)
+	require.Equal(t, expectedFingerprint, fingerprint)
+
+	// 已取消的 ctx 不会发出请求
+	canceled, cancelNow := context.WithCancel(context.Background())
+	cancelNow()
+	_, err = remote.SumElements(canceled, []byte("alice"))
+	require.ErrorIs(t, err, context.Canceled)
+
+	require.NoError(t, server.Close())
+	require.ErrorIs(t, <-served, net.ErrClosed)
+	_, err = remote.SumElements(ctx, []byte("alice"))
+	require.Error(t, err)
+	_, err = os.Lstat(path)
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestListenBackendUnix_RejectsOtherUsers(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("peer credentials are checked on linux only")
+	}
+	params := Params{Rows: 16, SubsSize: 4, Blocks: 4, Threshold: 2, Nodes: 3}
+	var ca CA
+	require.NoError(t, ca.InitCAWithParams(params, "gen_key"))
+	backend, err := NewMemoryBackend(params, ca.privateMatrix)
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "backend.sock")
+	require.NoError(t, os.WriteFile(path, nil, 0600))
+	// path 上已有的普通文件不会被覆盖
+	_, err = ListenBackendUnix(path)
+	require.Error(t, err)
+	require.NoError(t, os.Remove(path))
+
+	listener, err := ListenBackendUnix(path)
+	require.NoError(t, err)
+	// 模拟其他用户的进程：监听者只接受另一个用户
+	listener.(*unixListener).uid = os.Getuid() + 1
+	server := NewBackendServer(backend)
+	defer server.Close()
+	go server.Serve(listener)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, err = DialBackend(ctx, path)
+	require.Error(t, err)
+}
+
+func TestBackendServer_RejectsMalformedRequest(t *testing.T) {
+	params := Params{Rows: 16, SubsSize: 4, Blocks: 4, Threshold: 2, Nodes: 3}
+	var ca CA
+	require.NoError(t, ca.InitCAWithParams(params, "gen_key"))
+	backend, err := NewMemoryBackend(params, ca.privateMatrix)
+	require.NoError(t, err)
+	server := NewBackendServer(backend)
+
+	conn, peer := net.Pipe()
+	server.wg.Add(1)
+	go server.serveConn(peer)
+	defer conn.Close()
+
+	for _, request := range [][]byte{{1, 2, 3}, append([]byte("cpk-backend-v0"), 0)} {
+		require.NoError(t, writeFrame(conn, request))
+		response, err := readFrame(conn, maxBackendResponseHeader)
+		require.NoError(t, err)
+		require.Equal(t, byte(0), response[0])
+	}
+}
@@ -0,0 +1,112 @@
+package cpk
+
+import (
+	"context"
+	"github.com/walegarrett/cpk-algs/base"
+	"github.com/walegarrett/cpk-algs/base/edwards25519"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// parallelFor runs fn for every i in [0, n) on at most GOMAXPROCS goroutines, it stops
+// at the first error or when ctx is done and returns the error of the smallest i
+func parallelFor(ctx context.Context, n int, fn func(i int) error) error {
+	workers := runtime.GOMAXPROCS(0)
+	if workers > n {
+		workers = n
+	}
+	var (
+		next     int64 = -1
+		failed   int32
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+		firstAt  = n
+	)
+	fail := func(i int, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if i < firstAt {
+			firstAt, firstErr = i, err
+		}
+		atomic.StoreInt32(&failed, 1)
+	}
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for atomic.LoadInt32(&failed) == 0 {
+				i := int(atomic.AddInt64(&next, 1))
+				if i >= n {
+					return
+				}
+				if err := ctx.Err(); err != nil {
+					fail(i, err)
+					return
+				}
+				if err := fn(i); err != nil {
+					fail(i, err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return firstErr
+}
+
+// publicMatrixOf multiplies the base point by every scalar of the matrix in parallel
+func publicMatrixOf(ctx context.Context, scalars []base.Ed25519Scala) ([]base.Ed25519Point, error) {
+	points := make([]base.Ed25519Point, len(scalars))
+	err := parallelFor(ctx, len(scalars), func(i int) error {
+		points[i].Point = (&edwards25519.Point{}).ScalarBaseMult(scalars[i].Scalar)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return points, nil
+}
+
+// QuerySKBatch returns the private keys of the identities in the same order
+func (ca *CA) QuerySKBatch(ctx context.Context, idents []string) ([]base.PrivateKey, error) {
+	privateKeys := make([]base.PrivateKey, len(idents))
+	err := parallelFor(ctx, len(idents), func(i int) (err error) {
+		privateKeys[i], err = ca.QuerySK(idents[i])
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+	return privateKeys, nil
+}
+
+// QuerySKBatch returns the private key pieces of the identities in the same order
+func (distributedCA *DistributedCA) QuerySKBatch(ctx context.Context, idents []string) ([]SKPiece, error) {
+	skPieces := make([]SKPiece, len(idents))
+	err := parallelFor(ctx, len(idents), func(i int) (err error) {
+		skPieces[i], err = distributedCA.QuerySK(idents[i])
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+	return skPieces, nil
+}
+
+// QueryPKBatch returns the public keys of the identities in the same order
+func (client *Client) QueryPKBatch(ctx context.Context, idents []string) ([]*base.PublicKey, error) {
+	publicKeys := make([]*base.PublicKey, len(idents))
+	err := parallelFor(ctx, len(idents), func(i int) (err error) {
+		publicKeys[i], err = client.QueryPK(idents[i])
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+	return publicKeys, nil
+}
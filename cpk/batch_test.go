@@ -0,0 +1,66 @@
+package cpk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/require"
+	"sync/atomic"
+	"testing"
+)
+
+func TestQueryBatch(t *testing.T) {
+	var ca CA
+	require.NoError(t, ca.InitCA("gen_key"))
+	var client Client
+	require.NoError(t, ca.ExportPublicMatrixForClient(&client))
+	var distributedCA DistributedCA
+	require.NoError(t, distributedCA.InitDistributedCA(1, "gen_key"))
+
+	idents := make([]string, 100)
+	for i := range idents {
+		idents[i] = fmt.Sprintf("device-%d", i)
+	}
+	ctx := context.Background()
+	privateKeys, err := ca.QuerySKBatch(ctx, idents)
+	require.NoError(t, err)
+	publicKeys, err := client.QueryPKBatch(ctx, idents)
+	require.NoError(t, err)
+	skPieces, err := distributedCA.QuerySKBatch(ctx, idents)
+	require.NoError(t, err)
+	require.Len(t, privateKeys, len(idents))
+	for i, ident := range idents {
+		sk, err := ca.QuerySK(ident)
+		require.NoError(t, err)
+		require.Equal(t, 1, privateKeys[i].Scalar.Equal(sk.Scalar))
+		require.Equal(t, 1, publicKeys[i].Equal(sk.Public().Point))
+		skPiece, err := distributedCA.QuerySK(ident)
+		require.NoError(t, err)
+		require.Equal(t, skPiece, skPieces[i])
+	}
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = ca.QuerySKBatch(canceled, idents)
+	require.ErrorIs(t, err, context.Canceled)
+	_, err = (&Client{}).QueryPKBatch(ctx, idents)
+	require.ErrorIs(t, err, ErrMatrixNotLoaded)
+}
+
+func TestParallelFor(t *testing.T) {
+	var calls int32
+	errBad := errors.New("bad")
+	err := parallelFor(context.Background(), 1000, func(i int) error {
+		atomic.AddInt32(&calls, 1)
+		if i%100 == 7 {
+			return fmt.Errorf("%d: %w", i, errBad)
+		}
+		return nil
+	})
+	require.ErrorIs(t, err, errBad)
+	require.EqualError(t, err, "7: bad")
+	require.Less(t, atomic.LoadInt32(&calls), int32(1000))
+	require.NoError(t, parallelFor(context.Background(), 0, func(i int) error {
+		return errBad
+	}))
+}
@@ -0,0 +1,110 @@
+package cpk
+
+import (
+	"github.com/walegarrett/cpk-algs/base"
+)
+
+// LegacyClient keeps the panicking signatures of Client for callers that have
+// not migrated to the error-returning API yet
+//
+// Deprecated: use the methods of Client and handle the returned errors.
+type LegacyClient struct {
+	*Client
+}
+
+// NewLegacyClient panics when the public matrix is invalid
+//
+// Deprecated: use NewClient.
+func NewLegacyClient(publicMatrix []base.Ed25519Point) LegacyClient {
+	client, err := NewClient(publicMatrix)
+	if err != nil {
+		panic(err)
+	}
+	return LegacyClient{client}
+}
+
+func (client LegacyClient) QueryPK(ident string) *base.PublicKey {
+	publicKey, err := client.Client.QueryPK(ident)
+	if err != nil {
+		panic(err)
+	}
+	return publicKey
+}
+
+func (client LegacyClient) CombineSKPieces(skPieces []SKPiece, myPublicKey base.PublicKey) (bool, base.PrivateKey) {
+	priv, err := client.Client.CombineSKPieces(skPieces, myPublicKey)
+	return err == nil, priv
+}
+
+func (client LegacyClient) CombinePMPieces(pmPieces []PMPiece) {
+	err := client.Client.CombinePMPieces(pmPieces)
+	if err != nil {
+		panic(err)
+	}
+}
+
+func (client LegacyClient) CreatePublicKeyMatrixFromPrivateKeyMatrix(privateKeyMatrix []base.Ed25519Scala) {
+	err := client.Client.CreatePublicKeyMatrixFromPrivateKeyMatrix(privateKeyMatrix)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// LegacyCA keeps the panicking signatures of CA
+//
+// Deprecated: use the methods of CA and handle the returned errors.
+type LegacyCA struct {
+	*CA
+}
+
+func (ca LegacyCA) InitCA(genKey string) {
+	err := ca.CA.InitCA(genKey)
+	if err != nil {
+		panic(err)
+	}
+}
+
+func (ca LegacyCA) QuerySK(ident string) base.PrivateKey {
+	privateKey, err := ca.CA.QuerySK(ident)
+	if err != nil {
+		panic(err)
+	}
+	return privateKey
+}
+
+func (ca LegacyCA) ExportPublicMatrixForClient(client *Client) {
+	err := ca.CA.ExportPublicMatrixForClient(client)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// LegacyDistributedCA keeps the panicking signatures of DistributedCA
+//
+// Deprecated: use the methods of DistributedCA and handle the returned errors.
+type LegacyDistributedCA struct {
+	*DistributedCA
+}
+
+func (distributedCA LegacyDistributedCA) InitDistributedCA(index int64, genKey string) {
+	err := distributedCA.DistributedCA.InitDistributedCA(index, genKey)
+	if err != nil {
+		panic(err)
+	}
+}
+
+func (distributedCA LegacyDistributedCA) QuerySK(ident string) SKPiece {
+	skPiece, err := distributedCA.DistributedCA.QuerySK(ident)
+	if err != nil {
+		panic(err)
+	}
+	return skPiece
+}
+
+func (distributedCA LegacyDistributedCA) ExportPublicMatrixPiece() PMPiece {
+	pmPiece, err := distributedCA.DistributedCA.ExportPublicMatrixPiece()
+	if err != nil {
+		panic(err)
+	}
+	return pmPiece
+}
@@ -2,7 +2,9 @@ package cpk
 
 import (
 	"bytes"
+	"context"
 	"encoding/binary"
+	"fmt"
 	"github.com/walegarrett/cpk-algs/base"
 	"github.com/walegarrett/cpk-algs/base/edwards25519"
 	"golang.org/x/crypto/blake2b"
@@ -59,96 +61,71 @@ func (pmPiece *PMPiece) DeSerialize(deserializer *base.DeSerializer) error {
 	if err != nil {
 		return err
 	}
-	pmPiece.Piece = make([]base.Ed25519Point, l)
-	for i := int64(0); i < l; i++ {
-		_, err = deserializer.ReadSerializable(&(pmPiece.Piece[i]))
-		if err != nil {
-			return err
-		}
-	}
-	return nil
-}
-
-const (
-	// 公钥矩阵行数
-	matrixRows = 32
-	// 公钥矩阵元素数量
-	matrixSize = matrixRows * matrixRows
-	subsSize   = 8
-	// 矩阵分片数量（两个分片组成一个完整的矩阵）
-	piecesCount = 4
-	// 每个分片矩阵的元素数量
-	matrixPieceSize = matrixSize / piecesCount * 2
-)
-
-var subsTable = [8][8]int{
-	{
-		0, 1, 2, 3, 4, 5, 6, 7,
-	},
-	{
-		1, 2, 3, 4, 5, 6, 7, 0,
-	},
-	{
-		2, 3, 4, 5, 6, 7, 0, 1,
-	},
-	{
-		3, 4, 5, 6, 7, 0, 1, 2,
-	},
-	{
-		4, 5, 6, 7, 0, 1, 2, 3,
-	},
-	{
-		5, 6, 7, 0, 1, 2, 3, 4,
-	},
-	{
-		6, 7, 0, 1, 2, 3, 4, 5,
-	},
-	{
-		7, 0, 1, 2, 3, 4, 5, 6,
-	},
+	pmPiece.Piece, err = readPoints(deserializer, l)
+	return err
 }
 
 type Client struct {
-	publicMatrix  []base.Ed25519Point
-	pkQueriesFunc func(key string) interface{}
+	params       Params
+	publicMatrix []base.Ed25519Point
+	// 组合公钥矩阵时使用的各节点分片，用于计算各节点的部分公钥
+	pmPieces map[int64]PMPiece
+	// 固定的根公钥，非空时只接受经根密钥签名的公钥矩阵
+	root *base.PublicKey
+	// 已加载公钥矩阵的签名清单
+	manifest *Manifest
+	// 身份映射的域，区分共用同一矩阵的不同应用
+	domain Domain
+	// 预计算的公钥矩阵，查询公钥时使用混合加法
+	cachedMatrix []edwards25519.AffineCached
+	fingerprint  Fingerprint
+	pkCache      *base.LRU
+	// 除自身矩阵以外的其他矩阵版本，轮换期间同时使用
+	versions *versionSet
 }
 
-// initQueries init the public key query func
-func (client *Client) initQueries() {
-	client.pkQueriesFunc = func(ident string) interface{} {
-		sum := base.NewEd25519Point()
-		hash, err := blake2b.New512(nil)
-		if err != nil {
-			panic(err)
-		}
-		hash.Write([]byte(ident))
-		hs := base.FromHash(hash)
-		for i := 0; i < matrixRows/subsSize; i++ {
-			// 遍历每一个子矩阵
-			// pi和pj用于从从subs_table中选出本次子矩阵的开始行
-			pi := int(hs.ToNextByte() & 7)
-			pj := int(hs.ToNextByte() & 7)
-			// 遍历子矩阵的每一行
-			for j := 0; j < subsSize; j++ {
-				// 在总矩阵中的行数
-				y := subsTable[(pi+j)%8][pj] + 8*i
-				// 在总矩阵中的列数
-				x := int((hs.ToNextByte() & (matrixRows - 1)) % matrixRows)
-				sum.Point.Add(sum.Point, client.publicMatrix[matrixRows*y+x].Point)
-			}
-		}
-		var publicKey base.PublicKey
-		publicKey.Point = sum.Point
-		return publicKey
+// precompute converts the public matrix to the affine cached form used by QueryPK
+func (client *Client) precompute() {
+	client.params = client.params.orDefault()
+	cachedMatrix := make([]edwards25519.AffineCached, len(client.publicMatrix))
+	_ = parallelFor(context.Background(), len(cachedMatrix), func(i int) error {
+		cachedMatrix[i].FromPoint(client.publicMatrix[i].Point)
+		return nil
+	})
+	client.cachedMatrix = cachedMatrix
+	client.fingerprint, _ = MatrixFingerprint(client.params, client.publicMatrix)
+	if client.pkCache != nil {
+		client.pkCache.Purge()
+	}
+	// 版本集合随矩阵一起创建，之后只在其锁的保护下修改，并发的 AddVersion 不会竞争创建
+	if client.versions == nil {
+		client.versions = newVersionSet()
 	}
 }
 
-func NewClient(publicMatrix []base.Ed25519Point) *Client {
+func NewClient(publicMatrix []base.Ed25519Point) (*Client, error) {
+	return NewClientWithParams(DefaultParams(), publicMatrix)
+}
+
+// NewClientWithParams creates a client for a public matrix with the given layout
+func NewClientWithParams(params Params, publicMatrix []base.Ed25519Point) (*Client, error) {
+	if err := params.Validate(); err != nil {
+		return nil, err
+	}
+	if err := checkPoints(publicMatrix, params.Size()); err != nil {
+		return nil, err
+	}
 	var client Client
+	client.params = params
 	client.publicMatrix = make([]base.Ed25519Point, len(publicMatrix))
 	copy(client.publicMatrix, publicMatrix)
-	client.initQueries()
-	return &client
+	client.precompute()
+	return &client, nil
+}
+
+// Params returns the matrix layout of the client
+func (client *Client) Params() Params {
+	return client.params.orDefault()
 }
 
 func (client *Client) QueryPublicKeyMatrix() []base.Ed25519Point {
@@ -156,10 +133,13 @@ func (client *Client) QueryPublicKeyMatrix() []base.Ed25519Point {
 }
 
 func (client *Client) QueryPublicKeyMatrixSize() (rows int, cols int) {
-	return matrixRows, matrixRows
+	params := client.Params()
+	return params.Rows, params.Rows
 }
 
 func (client *Client) Serialize(serializer *base.Serializer) {
+	params := client.Params()
+	params.Serialize(serializer)
 	serializer.WriteInt64(int64(len(client.publicMatrix)))
 	for _, ed25519Point := range client.publicMatrix {
 		serializer.WriteSerializable(&ed25519Point)
@@ -167,168 +147,338 @@ func (client *Client) Serialize(serializer *base.Serializer) {
 }
 
 func (client *Client) Deserialize(deserializer *base.DeSerializer) error {
+	if err := client.requireUnpinned(); err != nil {
+		return err
+	}
+	err := client.params.Deserialize(deserializer)
+	if err != nil {
+		return err
+	}
 	var l int64
-	_, err := deserializer.ReadInt64(&l)
+	_, err = deserializer.ReadInt64(&l)
 	if err != nil {
 		return err
 	}
-	client.publicMatrix = make([]base.Ed25519Point, l)
-	for i := int64(0); i < l; i++ {
-		_, err = deserializer.ReadSerializable(&(client.publicMatrix[i]))
-		if err != nil {
-			return err
-		}
+	if l != int64(client.params.Size()) {
+		return &ErrMatrixSizeMismatch{Expected: client.params.Size(), Actual: int(l)}
 	}
-	client.initQueries()
+	client.cachedMatrix = nil
+	client.pmPieces = nil
+	client.manifest = nil
+	client.publicMatrix, err = readPoints(deserializer, l)
+	if err != nil {
+		return err
+	}
+	client.precompute()
 	return nil
 }
 
-func (client *Client) QueryPK(ident string) *base.PublicKey {
-	res := client.pkQueriesFunc(ident)
-	publicKey, ok := res.(base.PublicKey)
-	if !ok {
-		panic("query pk failed")
+func (client *Client) QueryPK(ident string) (*base.PublicKey, error) {
+	encoded, err := client.domain.plainIdent(ident)
+	if err != nil {
+		return nil, err
+	}
+	return client.queryPK(encoded)
+}
+
+// queryPK returns the public key mapped from the identity encoding
+func (client *Client) queryPK(ident []byte) (*base.PublicKey, error) {
+	if len(client.cachedMatrix) != client.Params().Size() {
+		return nil, ErrMatrixNotLoaded
+	}
+	encoded := client.domain.encodeIdent(ident)
+	if client.pkCache == nil {
+		return client.derivePK(encoded)
+	}
+	switch res := client.pkCache.Query(client.pkCacheKey(encoded)).(type) {
+	case *base.PublicKey:
+		// 返回副本，调用方修改公钥不影响缓存
+		publicKey := base.PublicKey{Point: edwards25519.NewIdentityPoint().Set(res.Point)}
+		return &publicKey, nil
+	case error:
+		return nil, res
+	default:
+		return nil, fmt.Errorf("%w: unexpected cached value %T", ErrInternal, res)
 	}
-	return &publicKey
 }
 
-type void struct{}
+// derivePK sums the matrix elements selected by the domain-encoded identity
+func (client *Client) derivePK(encoded []byte) (*base.PublicKey, error) {
+	params := client.Params()
+	if len(client.cachedMatrix) != params.Size() {
+		return nil, ErrMatrixNotLoaded
+	}
+	indices, err := params.selectIndices(encoded)
+	if err != nil {
+		return nil, err
+	}
+	var publicKey base.PublicKey
+	publicKey.Point = (&edwards25519.Point{}).SumAffineCached(client.cachedMatrix, indices)
+	return &publicKey, nil
+}
 
-// CombineSKPieces combine the sk piece
-// 0 + 2 = sk
-// 1 + 3 = sk
-func (client *Client) CombineSKPieces(skPieces []SKPiece, myPublicKey base.PublicKey) (bool, base.PrivateKey) {
-	candidates := [2]base.Ed25519Scala{}
-	for i := 0; i < 2; i++ {
-		candidates[i] = *base.NewEd25519Scala()
+// CombineSKPieces combine the sk pieces of at least Threshold nodes
+// 使用拉格朗日插值在 x=0 处恢复私钥
+func (client *Client) CombineSKPieces(skPieces []SKPiece, myPublicKey base.PublicKey) (base.PrivateKey, error) {
+	params := client.Params()
+	priv := base.PrivateKey{}
+	if myPublicKey.Point == nil {
+		return priv, fmt.Errorf("%w: public key", ErrKeyNotInitialized)
 	}
-	set := make(map[int]void)
-	// 组合出分片列表中的候选组合
-	for index, skPiece := range skPieces {
-		if _, exist := set[index]; !exist {
-			set[index] = void{}
-			candidates[skPiece.Index&1].Scalar.Add(candidates[skPiece.Index&1].Scalar, skPiece.Secret.Scalar)
+	m := make(map[int64]SKPiece)
+	for _, skPiece := range skPieces {
+		if skPiece.Index < 0 || skPiece.Index >= int64(params.Nodes) {
+			return priv, ErrIndexOutOfRange
 		}
-	}
-	// 遍历每个候选的私钥组合，找到与公钥对应的私钥组合
-	for _, candidate := range candidates {
-		point := edwards25519.Point{}
-		if point.ScalarBaseMult(candidate.Scalar).Equal(myPublicKey.Point) == 1 {
-			priv := base.PrivateKey{}
-			priv.Scalar = candidate.Scalar
-			return true, priv
+		if skPiece.Secret.Scalar == nil {
+			return priv, fmt.Errorf("%w: sk piece %d", ErrKeyNotInitialized, skPiece.Index)
+		}
+		if _, exist := m[skPiece.Index]; !exist {
+			m[skPiece.Index] = skPiece
 		}
 	}
-	priv := base.PrivateKey{}
-	priv.Scalar = candidates[0].Scalar
-	return false, priv
+	if len(m) < params.Threshold {
+		return priv, ErrInsufficientPieces
+	}
+	priv.Scalar = edwards25519.NewScalar()
+	indices := sortedIndices(m)
+	coefficients := lagrangeCoefficients(indices, -1)
+	for i, index := range indices {
+		priv.Scalar.MultiplyAdd(coefficients[i], m[index].Secret.Scalar, priv.Scalar)
+	}
+	point := edwards25519.Point{}
+	if point.ScalarBaseMult(priv.Scalar).Equal(myPublicKey.Point) != 1 {
+		return priv, ErrKeyMismatch
+	}
+	return priv, nil
+}
+
+// CombinePMPieces combine the public matrix from the pieces of at least Threshold nodes
+func (client *Client) CombinePMPieces(pmPieces []PMPiece) error {
+	if err := client.requireUnpinned(); err != nil {
+		return err
+	}
+	params := client.Params()
+	publicMatrix, m, err := combinePMPieces(params, pmPieces)
+	if err != nil {
+		return err
+	}
+	client.params = params
+	client.publicMatrix = publicMatrix
+	client.pmPieces = m
+	client.manifest = nil
+	client.precompute()
+	return nil
 }
 
-// CombinePMPieces combine the public matrix
-func (client *Client) CombinePMPieces(pmPieces []PMPiece) {
-	cnt := [2]int{0, 0}
-	m := make(map[int]PMPiece)
+// combinePMPieces interpolates the public matrix from the pieces and checks the extra pieces
+func combinePMPieces(params Params, pmPieces []PMPiece) ([]base.Ed25519Point, map[int64]PMPiece, error) {
+	m := make(map[int64]PMPiece)
 	for _, pmPiece := range pmPieces {
-		if _, exist := m[int(pmPiece.Index)]; !exist {
-			m[int(pmPiece.Index)] = pmPiece
-			cnt[pmPiece.Index&1]++
+		if pmPiece.Index < 0 || pmPiece.Index >= int64(params.Nodes) {
+			return nil, nil, ErrIndexOutOfRange
+		}
+		if err := checkPoints(pmPiece.Piece, params.Size()); err != nil {
+			return nil, nil, err
+		}
+		if _, exist := m[pmPiece.Index]; !exist {
+			m[pmPiece.Index] = pmPiece
 		}
 	}
-	// 校验是否能组成两个子矩阵
-	if cnt[0] != piecesCount/2 || cnt[0] != cnt[1] {
-		panic("public matrix pieces not enough")
-	}
-
-	client.publicMatrix = nil
-	for i := 0; i < 2; i++ {
-		// 遍历每种组合
-		for j := i; j < piecesCount; j += 2 {
-			// 将0,2或者1,3这两种组合组成完整的矩阵
-			k := 0
-			for _, point := range m[j].Piece {
-				if i == 0 {
-					// 取0,2这种组合
-					client.publicMatrix = append(client.publicMatrix, point)
-				} else {
-					// 校验前一轮的point与当前组合的同一个位置的point是否相同
-					prePoint := client.publicMatrix[matrixPieceSize*(j/2)+k].Point
-					if prePoint.Equal(point.Point) != 1 {
-						panic("not consistent")
-					}
-				}
-				k++
+	if len(m) < params.Threshold {
+		return nil, nil, ErrInsufficientPieces
+	}
+	indices := sortedIndices(m)
+	// 使用前 Threshold 个分片在指数上插值出公钥矩阵
+	anchors := indices[:params.Threshold]
+	coefficients := lagrangeCoefficients(anchors, -1)
+	publicMatrix := interpolatePoints(m, anchors, coefficients, params.Size())
+	// 校验其余分片与插值出的多项式是否一致
+	for _, index := range indices[params.Threshold:] {
+		coefficients = lagrangeCoefficients(anchors, index)
+		expected := interpolatePoints(m, anchors, coefficients, params.Size())
+		for e, point := range m[index].Piece {
+			if expected[e].Equal(point.Point) != 1 {
+				return nil, nil, &ErrInconsistentPiece{Index: index, Position: e}
 			}
 		}
 	}
-	client.initQueries()
+	return publicMatrix, m, nil
 }
 
-func (client *Client) CreatePublicKeyMatrixFromPrivateKeyMatrix(privateKeyMatrix []base.Ed25519Scala) {
-	client.publicMatrix = nil
-	for _, ed25519Scala := range privateKeyMatrix {
-		ed25519Point := base.Ed25519Point{}
-		ed25519Point.Point = (&edwards25519.Point{}).ScalarBaseMult(ed25519Scala.Scalar)
-		client.publicMatrix = append(client.publicMatrix, ed25519Point)
+// interpolatePoints computes sum(coefficients[i] * pieces[indices[i]]) for every element
+func interpolatePoints(pieces map[int64]PMPiece, indices []int64, coefficients []*edwards25519.Scalar, size int) []base.Ed25519Point {
+	points := make([]base.Ed25519Point, size)
+	_ = parallelFor(context.Background(), size, func(e int) error {
+		sum := edwards25519.NewIdentityPoint()
+		for i, index := range indices {
+			sum.Add(sum, (&edwards25519.Point{}).ScalarMult(coefficients[i], pieces[index].Piece[e].Point))
+		}
+		points[e].Point = sum
+		return nil
+	})
+	return points
+}
+
+func (client *Client) CreatePublicKeyMatrixFromPrivateKeyMatrix(privateKeyMatrix []base.Ed25519Scala) error {
+	if err := client.requireUnpinned(); err != nil {
+		return err
+	}
+	params := client.Params()
+	if err := checkScalars(privateKeyMatrix, params.Size()); err != nil {
+		return err
 	}
-	client.initQueries()
+	publicMatrix, err := publicMatrixOf(context.Background(), privateKeyMatrix)
+	if err != nil {
+		return err
+	}
+	client.params = params
+	client.publicMatrix = publicMatrix
+	client.pmPieces = nil
+	client.manifest = nil
+	client.precompute()
+	return nil
+}
+
+// checkPoints checks that the matrix has the expected size and no nil elements
+func checkPoints(points []base.Ed25519Point, size int) error {
+	if len(points) != size {
+		return &ErrMatrixSizeMismatch{Expected: size, Actual: len(points)}
+	}
+	for i := range points {
+		if points[i].Point == nil {
+			return ErrMatrixNotLoaded
+		}
+	}
+	return nil
+}
+
+// checkScalars checks that the matrix has the expected size and no nil elements
+func checkScalars(scalars []base.Ed25519Scala, size int) error {
+	if len(scalars) != size {
+		return &ErrMatrixSizeMismatch{Expected: size, Actual: len(scalars)}
+	}
+	for i := range scalars {
+		if scalars[i].Scalar == nil {
+			return ErrMatrixNotLoaded
+		}
+	}
+	return nil
 }
 
 type CA struct {
+	params        Params
 	privateMatrix []base.Ed25519Scala
+	// 私钥矩阵由外部后端持有时非空
+	backend SecretMatrixBackend
+	domain  Domain
 }
 
-func (ca *CA) InitCA(genKey string) {
+func (ca *CA) InitCA(genKey string) error {
+	return ca.InitCAWithParams(DefaultParams(), genKey)
+}
+
+// InitCAWithParams generates the private matrix with the given layout
+func (ca *CA) InitCAWithParams(params Params, genKey string) error {
+	if err := params.Validate(); err != nil {
+		return err
+	}
+	privateMatrix := make([]base.Ed25519Scala, 0, params.Size())
 	counter := int64(0)
-	for i := 0; i < matrixSize; i++ {
+	for i := 0; i < params.Size(); i++ {
 		hash, err := blake2b.New512([]byte(genKey))
 		if err != nil {
-			panic(err)
+			return err
 		}
 		bytesBuffer := bytes.NewBuffer([]byte{})
 		err = binary.Write(bytesBuffer, binary.LittleEndian, counter)
 		if err != nil {
-			panic(err)
+			return err
 		}
 		hash.Write(bytesBuffer.Bytes())
 
-		ca.privateMatrix = append(ca.privateMatrix, *(base.FromHashToScala(hash)))
+		privateMatrix = append(privateMatrix, *(base.FromHashToScala(hash)))
 		counter++
 	}
+	ca.params = params
+	ca.privateMatrix = privateMatrix
+	ca.backend = nil
+	return nil
+}
+
+// Params returns the matrix layout of the CA
+func (ca *CA) Params() Params {
+	return ca.params.orDefault()
 }
 
 // QuerySK query the user's private key
-func (ca *CA) QuerySK(ident string) base.PrivateKey {
-	sum := base.NewEd25519Scala()
-	hash, err := blake2b.New512(nil)
+func (ca *CA) QuerySK(ident string) (base.PrivateKey, error) {
+	encoded, err := ca.domain.plainIdent(ident)
 	if err != nil {
-		panic(err)
-	}
-	hash.Write([]byte(ident))
-	hs := base.FromHash(hash)
-	for i := 0; i < matrixRows/subsSize; i++ {
-		// 遍历每一个子矩阵
-		// pi和pj用于从从subs_table中选出本次子矩阵的开始行
-		pi := int(hs.ToNextByte() & 7)
-		pj := int(hs.ToNextByte() & 7)
-		// 遍历子矩阵的每一行
-		for j := 0; j < subsSize; j++ {
-			// 在总矩阵中的行数
-			y := subsTable[(pi+j)%8][pj] + 8*i
-			// 在总矩阵中的列数
-			x := int((hs.ToNextByte() & (matrixRows - 1)) % matrixRows)
-			sum.Scalar.Add(sum.Scalar, ca.privateMatrix[matrixRows*y+x].Scalar)
-		}
+		return base.PrivateKey{}, err
 	}
+	return ca.querySK(encoded)
+}
+
+// querySK returns the private key mapped from the identity encoding
+func (ca *CA) querySK(ident []byte) (base.PrivateKey, error) {
 	var privateKey base.PrivateKey
-	privateKey.Scalar = sum.Scalar
-	return privateKey
+	encoded := ca.domain.encodeIdent(ident)
+	var err error
+	if ca.backend != nil {
+		privateKey.Scalar, err = ca.backend.SumElements(context.Background(), encoded)
+	} else {
+		privateKey.Scalar, err = sumElements(ca.Params(), ca.privateMatrix, encoded)
+	}
+	if err != nil {
+		return base.PrivateKey{}, err
+	}
+	return privateKey, nil
 }
 
-func (ca *CA) ExportPublicMatrixForClient(client *Client) {
-	client.CreatePublicKeyMatrixFromPrivateKeyMatrix(ca.privateMatrix)
+func (ca *CA) ExportPublicMatrixForClient(client *Client) error {
+	if ca.backend == nil && len(ca.privateMatrix) != ca.Params().Size() {
+		return ErrMatrixNotLoaded
+	}
+	if err := client.requireUnpinned(); err != nil {
+		return err
+	}
+	if ca.backend != nil {
+		publicMatrix, err := ca.backend.PublicMatrix(context.Background())
+		if err != nil {
+			return err
+		}
+		res, err := NewClientWithParams(ca.Params(), publicMatrix)
+		if err != nil {
+			return err
+		}
+		client.params = res.params
+		client.publicMatrix = res.publicMatrix
+		client.pmPieces = nil
+		client.manifest = nil
+		client.precompute()
+		return nil
+	}
+	// 先在局部变量中计算公钥矩阵，失败时客户端保持原来的参数与矩阵
+	params := ca.Params()
+	if err := checkScalars(ca.privateMatrix, params.Size()); err != nil {
+		return err
+	}
+	publicMatrix, err := publicMatrixOf(context.Background(), ca.privateMatrix)
+	if err != nil {
+		return err
+	}
+	client.params = params
+	client.publicMatrix = publicMatrix
+	client.pmPieces = nil
+	client.manifest = nil
+	client.precompute()
+	return nil
 }
 
 func (ca *CA) Serialize(serializer *base.Serializer) {
+	params := ca.Params()
+	params.Serialize(serializer)
 	serializer.WriteInt64(int64(len(ca.privateMatrix)))
 	for _, ed25519Point := range ca.privateMatrix {
 		serializer.WriteSerializable(&ed25519Point)
@@ -336,119 +486,242 @@ func (ca *CA) Serialize(serializer *base.Serializer) {
 }
 
 func (ca *CA) Deserialize(deserializer *base.DeSerializer) error {
+	err := ca.params.Deserialize(deserializer)
+	if err != nil {
+		return err
+	}
 	var l int64
-	_, err := deserializer.ReadInt64(&l)
+	_, err = deserializer.ReadInt64(&l)
 	if err != nil {
 		return err
 	}
-	ca.privateMatrix = make([]base.Ed25519Scala, l)
-	for i := int64(0); i < l; i++ {
-		_, err = deserializer.ReadSerializable(&(ca.privateMatrix[i]))
-		if err != nil {
-			return err
-		}
+	if l != int64(ca.params.Size()) {
+		return &ErrMatrixSizeMismatch{Expected: ca.params.Size(), Actual: int(l)}
+	}
+	ca.privateMatrix, err = readScalars(deserializer, l)
+	if err != nil {
+		return err
 	}
+	ca.backend = nil
 	return nil
 }
 
+// SplitDistributedCAs shares the private matrix among Nodes distributed CAs, any
+// Threshold of them can issue the private keys
+func (ca *CA) SplitDistributedCAs() ([]DistributedCA, error) {
+	params := ca.Params()
+	if len(ca.privateMatrix) != params.Size() {
+		return nil, ErrMatrixNotLoaded
+	}
+	coefficients := make([][]*edwards25519.Scalar, params.Size())
+	for e := range coefficients {
+		coefficients[e] = make([]*edwards25519.Scalar, params.Threshold)
+		coefficients[e][0] = edwards25519.NewScalar().Set(ca.privateMatrix[e].Scalar)
+		for j := 1; j < params.Threshold; j++ {
+			coefficients[e][j] = base.RandomPrivateKey().Scalar
+		}
+	}
+	distributedCAs, _ := dealShares(params, coefficients)
+	return distributedCAs, nil
+}
+
+// DistributedCA holds a Shamir share of every element of the private matrix
 type DistributedCA struct {
+	params             Params
 	privateMatrixPiece []base.Ed25519Scala
-	Index              int64
+	// 分片由外部后端持有时非空
+	backend     SecretMatrixBackend
+	commitments *Commitments
+	domain      Domain
+	Index       int64
 }
 
-func (distributedCA *DistributedCA) InitDistributedCA(index int64, genKey string) {
-	counter := int64(0)
-	if index >= 2 {
-		counter += matrixPieceSize
+// InitDistributedCA derives the share of the node with the given index from genKey under the
+// default params
+//
+// Deprecated: see InitDistributedCAWithParams.
+func (distributedCA *DistributedCA) InitDistributedCA(index int64, genKey string) error {
+	return distributedCA.InitDistributedCAWithParams(DefaultParams(), index, genKey)
+}
+
+// InitDistributedCAWithParams derives the share of the node with the given index from genKey
+// 所有节点使用同一个 genKey，多项式的常数项与 CA.InitCAWithParams 生成的私钥矩阵相同
+//
+// Every node holds genKey, from which anyone can derive the whole private matrix, so a single
+// compromised node exposes every identity's key and the threshold protects nothing. It only
+// suits tests and the migration of a CA whose genKey is already shared.
+//
+// Deprecated: generate the shares with NewDKGNode, so that no party ever holds the private
+// matrix, or split an existing CA with CA.SplitDistributedCAs and destroy the CA afterwards.
+func (distributedCA *DistributedCA) InitDistributedCAWithParams(params Params, index int64, genKey string) error {
+	if err := params.Validate(); err != nil {
+		return err
 	}
-	for i := 0; i < matrixPieceSize; i++ {
-		hash, err := blake2b.New512([]byte(genKey))
-		if err != nil {
-			panic(err)
+	if index < 0 || index >= int64(params.Nodes) {
+		return ErrIndexOutOfRange
+	}
+	coefficients := make([][]*edwards25519.Scalar, params.Size())
+	for e := range coefficients {
+		coefficients[e] = make([]*edwards25519.Scalar, params.Threshold)
+		for j := 0; j < params.Threshold; j++ {
+			hash, err := blake2b.New512([]byte(genKey))
+			if err != nil {
+				return err
+			}
+			bytesBuffer := bytes.NewBuffer([]byte{})
+			err = binary.Write(bytesBuffer, binary.LittleEndian, int64(e))
+			if err != nil {
+				return err
+			}
+			if j > 0 {
+				// 高次项系数额外写入系数序号
+				err = binary.Write(bytesBuffer, binary.LittleEndian, int64(j))
+				if err != nil {
+					return err
+				}
+			}
+			hash.Write(bytesBuffer.Bytes())
+			coefficients[e][j] = base.FromHashToScala(hash).Scalar
 		}
-		bytesBuffer := bytes.NewBuffer([]byte{})
-		err = binary.Write(bytesBuffer, binary.LittleEndian, counter)
+	}
+	distributedCAs, _ := dealShares(params, coefficients)
+	domain := distributedCA.domain
+	*distributedCA = distributedCAs[index]
+	distributedCA.domain = domain
+	return nil
+}
+
+// Params returns the matrix layout of the distributed CA
+func (distributedCA *DistributedCA) Params() Params {
+	return distributedCA.params.orDefault()
+}
+
+// ExportCommitments returns the Feldman commitments of the private matrix polynomials
+func (distributedCA *DistributedCA) ExportCommitments() (*Commitments, error) {
+	if distributedCA.commitments == nil {
+		return nil, ErrCommitmentsNotLoaded
+	}
+	return distributedCA.commitments, nil
+}
+
+// VerifyShares checks the shares held by the node against the Feldman commitments
+func (distributedCA *DistributedCA) VerifyShares() error {
+	if distributedCA.commitments == nil {
+		return ErrCommitmentsNotLoaded
+	}
+	if distributedCA.backend != nil {
+		// 后端不导出分片，比较分片对应的公钥矩阵与承诺
+		pmPiece, err := distributedCA.ExportPublicMatrixPiece()
 		if err != nil {
-			panic(err)
+			return err
 		}
-		hash.Write(bytesBuffer.Bytes())
-
-		distributedCA.privateMatrixPiece = append(distributedCA.privateMatrixPiece, *(base.FromHashToScala(hash)))
-		counter++
+		return distributedCA.commitments.VerifyPublicShares(distributedCA.Index, pmPiece.Piece)
 	}
-	distributedCA.Index = index
+	return distributedCA.commitments.VerifyShares(distributedCA.Index, distributedCA.privateMatrixPiece)
 }
 
 // QuerySK returns the private key piece
-func (distributedCA *DistributedCA) QuerySK(ident string) SKPiece {
-	sum := base.NewEd25519Scala()
-	hash, err := blake2b.New512(nil)
+func (distributedCA *DistributedCA) QuerySK(ident string) (SKPiece, error) {
+	encoded, err := distributedCA.domain.plainIdent(ident)
 	if err != nil {
-		panic(err)
-	}
-	hash.Write([]byte(ident))
-	hs := base.FromHash(hash)
-	if distributedCA.Index >= 2 {
-		// 对于序号为2,3的节点需要跳过前一个节点占用的元素数量（0,2组成完整的矩阵，1,3也组成完整的矩阵）
-		for i := 0; i < (matrixRows/subsSize/piecesCount*2)*(2+subsSize); i++ {
-			hs.ToNextByte()
-		}
-	}
-	for i := 0; i < matrixRows/subsSize/piecesCount*2; i++ {
-		// 遍历每一个子矩阵
-		// pi和pj用于从从subs_table中选出本次子矩阵的开始行
-		pi := int(hs.ToNextByte() & 7)
-		pj := int(hs.ToNextByte() & 7)
-		// 遍历子矩阵的每一行
-		for j := 0; j < subsSize; j++ {
-			// 在总矩阵中的行数
-			y := subsTable[(pi+j)%8][pj] + 8*i
-			// 在总矩阵中的列数
-			x := int((hs.ToNextByte() & (matrixRows - 1)) % matrixRows)
-			sum.Scalar.Add(sum.Scalar, distributedCA.privateMatrixPiece[matrixRows*y+x].Scalar)
-		}
+		return SKPiece{}, err
 	}
+	return distributedCA.querySK(encoded)
+}
+
+// querySK returns the private key piece mapped from the identity encoding
+func (distributedCA *DistributedCA) querySK(ident []byte) (SKPiece, error) {
 	var skPiece SKPiece
+	encoded := distributedCA.domain.encodeIdent(ident)
+	var sum *edwards25519.Scalar
+	var err error
+	if distributedCA.backend != nil {
+		sum, err = distributedCA.backend.SumElements(context.Background(), encoded)
+	} else {
+		sum, err = sumElements(distributedCA.Params(), distributedCA.privateMatrixPiece, encoded)
+	}
+	if err != nil {
+		return skPiece, err
+	}
 	skPiece.Index = distributedCA.Index
-	skPiece.Secret = *sum
-	return skPiece
+	skPiece.Secret.Scalar = sum
+	return skPiece, nil
 }
 
-func (distributedCA *DistributedCA) ExportPublicMatrixPiece() PMPiece {
+// ExportPublicMatrixPiece returns the commitments to the shares held by the node
+func (distributedCA *DistributedCA) ExportPublicMatrixPiece() (PMPiece, error) {
 	pmPiece := PMPiece{}
-	for _, ed25519Scala := range distributedCA.privateMatrixPiece {
-		ed25519Point := base.Ed25519Point{}
-		ed25519Point.Point = (&edwards25519.Point{}).ScalarBaseMult(ed25519Scala.Scalar)
-		pmPiece.Piece = append(pmPiece.Piece, ed25519Point)
+	var piece []base.Ed25519Point
+	var err error
+	if distributedCA.backend != nil {
+		piece, err = distributedCA.backend.PublicMatrix(context.Background())
+		if err == nil {
+			err = checkPoints(piece, distributedCA.Params().Size())
+		}
+	} else if len(distributedCA.privateMatrixPiece) != distributedCA.Params().Size() {
+		return pmPiece, ErrMatrixNotLoaded
+	} else {
+		piece, err = publicMatrixOf(context.Background(), distributedCA.privateMatrixPiece)
+	}
+	if err != nil {
+		return pmPiece, err
 	}
+	pmPiece.Piece = piece
 	pmPiece.Index = distributedCA.Index
-	return pmPiece
+	return pmPiece, nil
 }
 
 func (distributedCA *DistributedCA) Serialize(serializer *base.Serializer) {
+	params := distributedCA.Params()
+	params.Serialize(serializer)
 	serializer.WriteInt64(int64(len(distributedCA.privateMatrixPiece)))
 	for _, ed25519Point := range distributedCA.privateMatrixPiece {
 		serializer.WriteSerializable(&ed25519Point)
 	}
 	serializer.WriteInt64(distributedCA.Index)
+	serializer.WriteBool(distributedCA.commitments != nil)
+	if distributedCA.commitments != nil {
+		distributedCA.commitments.Serialize(serializer)
+	}
 }
 
 func (distributedCA *DistributedCA) Deserialize(deserializer *base.DeSerializer) error {
+	err := distributedCA.params.Deserialize(deserializer)
+	if err != nil {
+		return err
+	}
 	var l int64
-	_, err := deserializer.ReadInt64(&l)
+	_, err = deserializer.ReadInt64(&l)
 	if err != nil {
 		return err
 	}
-	distributedCA.privateMatrixPiece = make([]base.Ed25519Scala, l)
-	for i := int64(0); i < l; i++ {
-		_, err = deserializer.ReadSerializable(&(distributedCA.privateMatrixPiece[i]))
-		if err != nil {
-			return err
-		}
+	if l != int64(distributedCA.params.Size()) {
+		return &ErrMatrixSizeMismatch{Expected: distributedCA.params.Size(), Actual: int(l)}
 	}
+	distributedCA.privateMatrixPiece, err = readScalars(deserializer, l)
+	if err != nil {
+		return err
+	}
+	distributedCA.backend = nil
 	_, err = deserializer.ReadInt64(&(distributedCA.Index))
 	if err != nil {
 		return err
 	}
+	if distributedCA.Index < 0 || distributedCA.Index >= int64(distributedCA.params.Nodes) {
+		return ErrIndexOutOfRange
+	}
+	var hasCommitments bool
+	_, err = deserializer.ReadBool(&hasCommitments)
+	if err != nil {
+		return err
+	}
+	distributedCA.commitments = nil
+	if hasCommitments {
+		distributedCA.commitments = &Commitments{}
+		err = distributedCA.commitments.Deserialize(deserializer)
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
@@ -2,6 +2,7 @@ package cpk
 
 import (
 	"crypto/rand"
+	"github.com/stretchr/testify/require"
 	"github.com/walegarrett/cpk-algs/base"
 	"github.com/walegarrett/cpk-algs/base/edwards25519"
 	"strconv"
@@ -74,15 +75,11 @@ func TestPMPiece_Serialize(t *testing.T) {
 }
 
 func TestDistributedCA_Deserialize(t *testing.T) {
-	var distributedCAs [piecesCount]DistributedCA
-	genKeys := []string{"gen_key1", "gen_key2"}
-	for i := 0; i < piecesCount; i++ {
-		// 0,1  2,3分别使用一个不同的key用于生成分片私钥矩阵
-		idx := 0
-		if i >= 2 {
-			idx = 1
-		}
-		distributedCAs[i].InitDistributedCA(int64(i), genKeys[idx])
+	var distributedCAs [4]DistributedCA
+	for i := 0; i < len(distributedCAs); i++ {
+		// 所有节点使用同一个key生成各自的私钥矩阵分片
+		err := distributedCAs[i].InitDistributedCA(int64(i), "gen_key")
+		require.NoError(t, err)
 
 		var serializer base.Serializer
 		distributedCAs[i].Serialize(&serializer)
@@ -101,39 +98,41 @@ func TestDistributedCA_Deserialize(t *testing.T) {
 			t.Error("bad serializer index:{}", distributedCA.Index)
 			return
 		}
-		if matrixPieceSize != len(distributedCA.privateMatrixPiece) {
+		if DefaultParams().Size() != len(distributedCA.privateMatrixPiece) {
 			t.Error("bad serialzer private matrix piece:{}", distributedCA.privateMatrixPiece)
 			return
 		}
 	}
 }
 func TestClient_CombineSKPieces(t *testing.T) {
-	var distributedCAs [piecesCount]DistributedCA
-	genKeys := []string{"gen_key1", "gen_key2"}
+	var distributedCAs [4]DistributedCA
 	var pmPieces []PMPiece
-	for i := 0; i < piecesCount; i++ {
-		// 0,1  2,3分别使用一个不同的key用于生成分片私钥矩阵
-		idx := 0
-		if i >= 2 {
-			idx = 1
-		}
-		distributedCAs[i].InitDistributedCA(int64(i), genKeys[idx])
-		pmPieces = append(pmPieces, distributedCAs[i].ExportPublicMatrixPiece())
+	for i := 0; i < len(distributedCAs); i++ {
+		// 所有节点使用同一个key生成各自的私钥矩阵分片
+		err := distributedCAs[i].InitDistributedCA(int64(i), "gen_key")
+		require.NoError(t, err)
+		pmPiece, err := distributedCAs[i].ExportPublicMatrixPiece()
+		require.NoError(t, err)
+		pmPieces = append(pmPieces, pmPiece)
 	}
 	client := Client{}
-	client.CombinePMPieces(pmPieces)
+	err := client.CombinePMPieces(pmPieces)
+	require.NoError(t, err)
 
 	count := 8
 	for count > 0 {
 		var skPieces []SKPiece
 		ident := "ident" + strconv.Itoa(count)
-		publicKey := client.QueryPK(ident)
-		for j := 0; j < piecesCount; j++ {
-			skPieces = append(skPieces, distributedCAs[j].QuerySK(ident))
+		publicKey, err := client.QueryPK(ident)
+		require.NoError(t, err)
+		for j := 0; j < len(distributedCAs); j++ {
+			skPiece, err := distributedCAs[j].QuerySK(ident)
+			require.NoError(t, err)
+			skPieces = append(skPieces, skPiece)
 		}
-		res, privateKey := client.CombineSKPieces(skPieces, *publicKey)
-		if !res {
-			t.Error("combine private key pieces failed")
+		privateKey, err := client.CombineSKPieces(skPieces, *publicKey)
+		if err != nil {
+			t.Error("combine private key pieces failed:", err)
 			return
 		}
 		if publicKey.Point.Equal((&edwards25519.Point{}).ScalarBaseMult(privateKey.Scalar)) != 1 {
@@ -147,18 +146,21 @@ func TestClient_CombineSKPieces(t *testing.T) {
 	for count > 0 {
 		var skPieces []SKPiece
 		ident := "ident" + strconv.Itoa(count)
-		publicKey := client.QueryPK(ident)
-		// ban用于测试某个切片丢失的情况
-		ban := count & 4
-		for j := 0; j < piecesCount; j++ {
-			if j == ban {
+		publicKey, err := client.QueryPK(ident)
+		require.NoError(t, err)
+		// ban用于测试某两个切片丢失的情况
+		ban := count & 3
+		for j := 0; j < len(distributedCAs); j++ {
+			if j == ban || j == (ban+1)%len(distributedCAs) {
 				continue
 			}
-			skPieces = append(skPieces, distributedCAs[j].QuerySK(ident))
+			skPiece, err := distributedCAs[j].QuerySK(ident)
+			require.NoError(t, err)
+			skPieces = append(skPieces, skPiece)
 		}
-		res, privateKey := client.CombineSKPieces(skPieces, *publicKey)
-		if !res {
-			t.Error("combine private key pieces failed")
+		privateKey, err := client.CombineSKPieces(skPieces, *publicKey)
+		if err != nil {
+			t.Error("combine private key pieces failed:", err)
 			return
 		}
 		if publicKey.Point.Equal((&edwards25519.Point{}).ScalarBaseMult(privateKey.Scalar)) != 1 {
@@ -171,11 +173,13 @@ func TestClient_CombineSKPieces(t *testing.T) {
 
 func TestClient_CreatePublicKeyMatrixFromPrivateKeyMatrix(t *testing.T) {
 	var ca CA
-	ca.InitCA("genkey1")
+	require.NoError(t, ca.InitCA("genkey1"))
 	client := Client{}
-	ca.ExportPublicMatrixForClient(&client)
-	sk := ca.QuerySK("id1")
-	pk := client.QueryPK("id1")
+	require.NoError(t, ca.ExportPublicMatrixForClient(&client))
+	sk, err := ca.QuerySK("id1")
+	require.NoError(t, err)
+	pk, err := client.QueryPK("id1")
+	require.NoError(t, err)
 	if pk.Point.Equal((&edwards25519.Point{}).ScalarBaseMult(sk.Scalar)) != 1 {
 		t.Error("sk not corresponding to pk")
 		return
@@ -184,20 +188,60 @@ func TestClient_CreatePublicKeyMatrixFromPrivateKeyMatrix(t *testing.T) {
 
 func TestClient_QueryPK(t *testing.T) {
 	var ca CA
-	ca.InitCA("genkey1")
+	require.NoError(t, ca.InitCA("genkey1"))
 	client := Client{}
-	ca.ExportPublicMatrixForClient(&client)
-	sk := ca.QuerySK("id1")
-	pk := client.QueryPK("id2")
+	require.NoError(t, ca.ExportPublicMatrixForClient(&client))
+	sk, err := ca.QuerySK("id1")
+	require.NoError(t, err)
+	pk, err := client.QueryPK("id2")
+	require.NoError(t, err)
 	if pk.Point.Equal((&edwards25519.Point{}).ScalarBaseMult(sk.Scalar)) != 0 {
 		t.Error("sk corresponding to pk")
 		return
 	}
 
-	sk = ca.QuerySK("id100")
-	pk = client.QueryPK("id100")
+	sk, err = ca.QuerySK("id100")
+	require.NoError(t, err)
+	pk, err = client.QueryPK("id100")
+	require.NoError(t, err)
 	if pk.Point.Equal((&edwards25519.Point{}).ScalarBaseMult(sk.Scalar)) != 1 {
 		t.Error("sk not corresponding to pk")
 		return
 	}
 }
+
+func BenchmarkClient_QueryPK(b *testing.B) {
+	var ca CA
+	require.NoError(b, ca.InitCA("genkey1"))
+	client := Client{}
+	require.NoError(b, ca.ExportPublicMatrixForClient(&client))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := client.QueryPK("id" + strconv.Itoa(i))
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkClient_QueryPKGeneric sums the matrix elements with generic point additions for comparison
+func BenchmarkClient_QueryPKGeneric(b *testing.B) {
+	var ca CA
+	require.NoError(b, ca.InitCA("genkey1"))
+	client := Client{}
+	require.NoError(b, ca.ExportPublicMatrixForClient(&client))
+	params := client.Params()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		indices, err := params.selectIndices([]byte("id" + strconv.Itoa(i)))
+		if err != nil {
+			b.Fatal(err)
+		}
+		sum := edwards25519.NewIdentityPoint()
+		for _, index := range indices {
+			sum.Add(sum, client.publicMatrix[index].Point)
+		}
+	}
+}
@@ -0,0 +1,728 @@
+package cpk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/walegarrett/cpk-algs/base"
+	"github.com/walegarrett/cpk-algs/base/edwards25519"
+	"github.com/walegarrett/cpk-algs/logger"
+	"time"
+)
+
+// DKGMessageType defines the kind of a message of the distributed key generation
+type DKGMessageType int32
+
+const (
+	// DKGCommitments broadcasts the Feldman commitments of the dealer
+	DKGCommitments DKGMessageType = iota + 1
+	// DKGShare sends the shares dealt to one node privately
+	DKGShare
+	// DKGComplaints broadcasts the dealers whose shares do not match their commitments
+	DKGComplaints
+	// DKGJustifications broadcasts the shares a dealer reveals to answer the complaints
+	DKGJustifications
+	// DKGQualified broadcasts the dealers the node qualified
+	DKGQualified
+)
+
+func (messageType DKGMessageType) String() string {
+	switch messageType {
+	case DKGCommitments:
+		return "commitments"
+	case DKGShare:
+		return "share"
+	case DKGComplaints:
+		return "complaints"
+	case DKGJustifications:
+		return "justifications"
+	case DKGQualified:
+		return "qualified"
+	}
+	return fmt.Sprintf("DKGMessageType(%d)", int32(messageType))
+}
+
+// DKGBroadcast is the recipient of a message sent to every other node
+const DKGBroadcast int64 = -1
+
+// DefaultDKGRoundTimeout is the time a node waits for the messages of one round when the
+// RoundTimeout of the node is zero
+const DefaultDKGRoundTimeout = 30 * time.Second
+
+// DKGMessage is one message of the distributed key generation
+type DKGMessage struct {
+	Type DKGMessageType
+	From int64
+	// 接收者序号，DKGBroadcast 表示广播
+	To      int64
+	Payload []byte
+}
+
+func (msg *DKGMessage) Serialize(serializer *base.Serializer) {
+	serializer.WriteInt32(int32(msg.Type))
+	serializer.WriteInt64(msg.From)
+	serializer.WriteInt64(msg.To)
+	serializer.WriteBytesWithLength(msg.Payload)
+}
+
+func (msg *DKGMessage) Deserialize(deserializer *base.DeSerializer) error {
+	var messageType int32
+	_, err := deserializer.ReadInt32(&messageType)
+	if err != nil {
+		return err
+	}
+	msg.Type = DKGMessageType(messageType)
+	_, err = deserializer.ReadInt64(&(msg.From))
+	if err != nil {
+		return err
+	}
+	_, err = deserializer.ReadInt64(&(msg.To))
+	if err != nil {
+		return err
+	}
+	_, err = deserializer.ReadBytesWithLength(&(msg.Payload))
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// DKGTransport delivers the messages between the nodes, broadcasts must reach every
+// node unchanged and private messages must be confidential and authenticated
+type DKGTransport interface {
+	// Send delivers the message to msg.To, or to every other node for DKGBroadcast
+	Send(ctx context.Context, msg DKGMessage) error
+	// Receive returns the next message sent to the node
+	Receive(ctx context.Context) (DKGMessage, error)
+}
+
+// DKGRoundCloser is implemented by the transports that know when no more messages of a
+// round will arrive, the nodes then end the round without waiting for its deadline
+type DKGRoundCloser interface {
+	// RoundClosed returns a channel closed once the round of the message type is over
+	RoundClosed(messageType DKGMessageType) <-chan struct{}
+}
+
+// sharingSession runs the rounds shared by the key generation and the resharing: every
+// dealer shares one polynomial per matrix element among the receivers, the receivers
+// complain about bad shares and the dealers answer the complaints publicly
+//
+// 协议分为五轮：广播承诺并私发分片、广播投诉、发起者公开被投诉的分片、广播合格发起者集合、合并合格发起者的分片。
+// 每轮的期限由各端点自行计时，临近期限到达的消息可能使各端点的合格集合不同，此时协议失败
+type sharingSession struct {
+	// RoundTimeout bounds the wait for the messages of each round, the nodes silent until
+	// the deadline are treated as faulty, DefaultDKGRoundTimeout if zero
+	RoundTimeout time.Duration
+	// 新的矩阵布局，序号小于 params.Nodes 的端点接收分片
+	params    Params
+	endpoints int
+	index     int64
+	// 本端点作为发起者时各元素多项式的常数项，nil 表示不作为发起者
+	secrets []*edwards25519.Scalar
+	// 检查发起者承诺的常数项，nil 表示接受任意常数项
+	checkDealer func(dealer int64, commitments *Commitments) bool
+	// 第 d 个发起者的承诺与发给本节点的分片，nil 表示未收到有效内容
+	commitments []*Commitments
+	shares      [][]base.Ed25519Scala
+	// 每个发起者收到的投诉者序号，升序
+	complaints   map[int64][]int64
+	disqualified map[int64]bool
+	// 本端点作为发起者的多项式系数，完成后清除
+	coefficients [][]*edwards25519.Scalar
+	inbox        []DKGMessage
+}
+
+// Qualified returns the dealers whose shares were accepted by every honest node
+func (session *sharingSession) Qualified() []int64 {
+	var qualified []int64
+	for dealer := int64(0); dealer < int64(len(session.commitments)); dealer++ {
+		if !session.disqualified[dealer] && session.commitments[dealer] != nil {
+			qualified = append(qualified, dealer)
+		}
+	}
+	return qualified
+}
+
+// receiver reports whether the endpoint holds a share after the session
+func (session *sharingSession) receiver() bool {
+	return session.index < int64(session.params.Nodes)
+}
+
+// run executes the rounds with the other endpoints over the transport
+func (session *sharingSession) run(ctx context.Context, transport DKGTransport) error {
+	session.commitments = make([]*Commitments, session.endpoints)
+	session.shares = make([][]base.Ed25519Scala, session.endpoints)
+	session.complaints = make(map[int64][]int64)
+	session.disqualified = make(map[int64]bool)
+	session.inbox = nil
+
+	others := make([]int64, 0, session.endpoints-1)
+	for endpoint := int64(0); endpoint < int64(session.endpoints); endpoint++ {
+		if endpoint != session.index {
+			others = append(others, endpoint)
+		}
+	}
+	if err := session.deal(ctx, transport); err != nil {
+		return err
+	}
+	missing, err := session.collect(ctx, transport, DKGCommitments, others, session.receiveCommitments)
+	if err != nil {
+		return err
+	}
+	// 未按时广播承诺的发起者不合格，其分片缺失时不必再等待
+	for _, dealer := range missing {
+		session.disqualified[dealer] = true
+	}
+	if session.receiver() {
+		var dealers []int64
+		for _, dealer := range session.Qualified() {
+			if dealer != session.index {
+				dealers = append(dealers, dealer)
+			}
+		}
+		// 未按时收到的分片在投诉轮中被投诉
+		if _, err = session.collect(ctx, transport, DKGShare, dealers, session.receiveShare); err != nil {
+			return err
+		}
+	}
+	if err = session.complain(ctx, transport); err != nil {
+		return err
+	}
+	// 未按时广播投诉的节点视为没有投诉
+	if _, err = session.collect(ctx, transport, DKGComplaints, others, session.receiveComplaints); err != nil {
+		return err
+	}
+	if err = session.justify(ctx, transport); err != nil {
+		return err
+	}
+	missing, err = session.collect(ctx, transport, DKGJustifications, others, session.receiveJustifications)
+	if err != nil {
+		return err
+	}
+	// 被投诉却未按时公开分片的发起者不合格
+	for _, dealer := range missing {
+		if len(session.complaints[dealer]) > 0 {
+			session.disqualified[dealer] = true
+		}
+	}
+	// 其他节点对本端点使用相同的规则
+	if len(session.complaints[session.index]) >= session.params.Threshold {
+		session.disqualified[session.index] = true
+	}
+	return session.agree(ctx, transport, others)
+}
+
+// agree broadcasts the qualified dealers of the endpoint and checks that every qualified
+// dealer qualified the same dealers, ErrDKGFailed if not or if a qualified dealer is silent
+func (session *sharingSession) agree(ctx context.Context, transport DKGTransport, others []int64) error {
+	qualified := session.Qualified()
+	var serializer base.Serializer
+	writeIndices(&serializer, qualified)
+	err := transport.Send(ctx, DKGMessage{Type: DKGQualified, From: session.index, To: DKGBroadcast, Payload: serializer})
+	if err != nil {
+		return err
+	}
+	agreed := true
+	missing, err := session.collect(ctx, transport, DKGQualified, others, func(msg DKGMessage) {
+		// 不合格的发起者的集合与本端点的结果无关
+		if !containsIndex(qualified, msg.From) {
+			return
+		}
+		var dealers []int64
+		err := unmarshalPayload(msg.Payload, func(deserializer *base.DeSerializer) (err error) {
+			dealers, err = readIndices(deserializer, session.endpoints)
+			return
+		})
+		if err != nil || !equalIndices(dealers, qualified) {
+			logger.Logger.Debug("dkg qualified dealers disagree", "from", msg.From)
+			agreed = false
+		}
+	})
+	if err != nil {
+		return err
+	}
+	// 无法确认未按时广播集合的合格发起者与本端点一致
+	for _, dealer := range missing {
+		if containsIndex(qualified, dealer) {
+			agreed = false
+		}
+	}
+	if !agreed {
+		return ErrDKGFailed
+	}
+	return nil
+}
+
+// wipe drops the polynomials and the shares of the session
+func (session *sharingSession) wipe() {
+	session.secrets = nil
+	session.coefficients = nil
+	session.shares = nil
+	session.inbox = nil
+}
+
+// deal broadcasts the commitments of the dealer and sends the shares to the receivers,
+// an endpoint that is not a dealer broadcasts empty commitments
+func (session *sharingSession) deal(ctx context.Context, transport DKGTransport) error {
+	if session.secrets == nil {
+		return transport.Send(ctx, DKGMessage{Type: DKGCommitments, From: session.index, To: DKGBroadcast, Payload: []byte{}})
+	}
+	params := session.params
+	session.coefficients = make([][]*edwards25519.Scalar, params.Size())
+	for e := range session.coefficients {
+		session.coefficients[e] = make([]*edwards25519.Scalar, params.Threshold)
+		session.coefficients[e][0] = edwards25519.NewScalar().Set(session.secrets[e])
+		for j := 1; j < params.Threshold; j++ {
+			session.coefficients[e][j] = base.RandomPrivateKey().Scalar
+		}
+	}
+	distributedCAs, commitments := dealShares(params, session.coefficients)
+	session.commitments[session.index] = commitments
+	if session.receiver() {
+		session.shares[session.index] = distributedCAs[session.index].privateMatrixPiece
+	}
+
+	var serializer base.Serializer
+	commitments.Serialize(&serializer)
+	err := transport.Send(ctx, DKGMessage{Type: DKGCommitments, From: session.index, To: DKGBroadcast, Payload: serializer})
+	if err != nil {
+		return err
+	}
+	for j := range distributedCAs {
+		if int64(j) == session.index {
+			continue
+		}
+		err = transport.Send(ctx, DKGMessage{Type: DKGShare, From: session.index, To: int64(j), Payload: serializeScalars(distributedCAs[j].privateMatrixPiece)})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// collect receives one message of the type from every sender until the round deadline and
+// returns the senders whose messages are missing, messages of the later rounds are kept for later
+func (session *sharingSession) collect(ctx context.Context, transport DKGTransport, messageType DKGMessageType, senders []int64, handle func(DKGMessage)) ([]int64, error) {
+	timeout := session.RoundTimeout
+	if timeout <= 0 {
+		timeout = DefaultDKGRoundTimeout
+	}
+	roundCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	if closer, ok := transport.(DKGRoundCloser); ok {
+		closed := closer.RoundClosed(messageType)
+		go func() {
+			select {
+			case <-closed:
+				cancel()
+			case <-roundCtx.Done():
+			}
+		}()
+	}
+	received := make(map[int64]bool)
+	accept := func(msg DKGMessage) {
+		if !containsIndex(senders, msg.From) || received[msg.From] {
+			logger.Logger.Debug("dkg unexpected message", "type", msg.Type, "from", msg.From)
+			return
+		}
+		received[msg.From] = true
+		handle(msg)
+	}
+	pending := session.inbox[:0]
+	for _, msg := range session.inbox {
+		if msg.Type == messageType {
+			accept(msg)
+		} else {
+			pending = append(pending, msg)
+		}
+	}
+	session.inbox = pending
+	for len(received) < len(senders) {
+		msg, err := transport.Receive(roundCtx)
+		if err != nil {
+			// 整个协议被取消时返回错误，只是本轮超时则继续下一轮
+			if ctx.Err() != nil || roundCtx.Err() == nil {
+				return nil, err
+			}
+			break
+		}
+		if msg.From < 0 || msg.From >= int64(session.endpoints) || msg.From == session.index {
+			logger.Logger.Debug("dkg message from unknown node", "from", msg.From)
+			continue
+		}
+		if (msg.Type == DKGShare) != (msg.To == session.index) {
+			logger.Logger.Debug("dkg message with wrong recipient", "type", msg.Type, "from", msg.From)
+			continue
+		}
+		switch {
+		case msg.Type == messageType:
+			accept(msg)
+		case msg.Type > messageType && msg.Type <= DKGQualified:
+			session.inbox = append(session.inbox, msg)
+		default:
+			logger.Logger.Debug("dkg unexpected message", "type", msg.Type, "from", msg.From)
+		}
+	}
+	var missing []int64
+	for _, sender := range senders {
+		if !received[sender] {
+			logger.Logger.Debug("dkg message missing", "type", messageType, "from", sender)
+			missing = append(missing, sender)
+		}
+	}
+	return missing, nil
+}
+
+func (session *sharingSession) receiveCommitments(msg DKGMessage) {
+	if len(msg.Payload) == 0 {
+		return
+	}
+	commitments := &Commitments{}
+	err := unmarshalPayload(msg.Payload, commitments.Deserialize)
+	// 广播内容对所有节点相同，所有节点都会取消该发起者的资格
+	if err != nil || commitments.Threshold != session.params.Threshold || commitments.Size() != session.params.Size() {
+		session.disqualified[msg.From] = true
+		return
+	}
+	if session.checkDealer != nil && !session.checkDealer(msg.From, commitments) {
+		session.disqualified[msg.From] = true
+		return
+	}
+	session.commitments[msg.From] = commitments
+}
+
+func (session *sharingSession) receiveShare(msg DKGMessage) {
+	var shares []base.Ed25519Scala
+	err := unmarshalPayload(msg.Payload, func(deserializer *base.DeSerializer) (err error) {
+		shares, err = deserializeScalars(deserializer)
+		return
+	})
+	if err != nil {
+		return
+	}
+	session.shares[msg.From] = shares
+}
+
+// complain broadcasts the dealers whose shares are missing or do not match their commitments
+func (session *sharingSession) complain(ctx context.Context, transport DKGTransport) error {
+	var dealers []int64
+	if session.receiver() {
+		for _, dealer := range session.Qualified() {
+			if dealer == session.index {
+				continue
+			}
+			if session.shares[dealer] == nil || session.commitments[dealer].VerifyShares(session.index, session.shares[dealer]) != nil {
+				session.shares[dealer] = nil
+				dealers = append(dealers, dealer)
+				session.complaints[dealer] = insertIndex(session.complaints[dealer], session.index)
+			}
+		}
+	}
+	var serializer base.Serializer
+	writeIndices(&serializer, dealers)
+	return transport.Send(ctx, DKGMessage{Type: DKGComplaints, From: session.index, To: DKGBroadcast, Payload: serializer})
+}
+
+func (session *sharingSession) receiveComplaints(msg DKGMessage) {
+	var dealers []int64
+	err := unmarshalPayload(msg.Payload, func(deserializer *base.DeSerializer) (err error) {
+		dealers, err = readIndices(deserializer, session.endpoints)
+		return
+	})
+	// 只有接收分片的端点可以投诉，无法解析的投诉被忽略
+	if err != nil || msg.From >= int64(session.params.Nodes) {
+		logger.Logger.Debug("dkg malformed complaints", "from", msg.From)
+		return
+	}
+	for _, dealer := range dealers {
+		if dealer < 0 || dealer >= int64(session.endpoints) || dealer == msg.From {
+			continue
+		}
+		session.complaints[dealer] = insertIndex(session.complaints[dealer], msg.From)
+	}
+}
+
+// justify reveals the shares dealt to the nodes complaining about this dealer
+func (session *sharingSession) justify(ctx context.Context, transport DKGTransport) error {
+	var accusers []int64
+	if session.coefficients != nil {
+		accusers = session.complaints[session.index]
+	}
+	var serializer base.Serializer
+	serializer.WriteInt64(int64(len(accusers)))
+	for _, accuser := range accusers {
+		x := shareX(accuser)
+		shares := make([]base.Ed25519Scala, len(session.coefficients))
+		for e := range session.coefficients {
+			shares[e].Scalar = evalPolynomial(session.coefficients[e], x)
+		}
+		serializer.WriteInt64(accuser)
+		serializer.WriteBytes(serializeScalars(shares))
+	}
+	return transport.Send(ctx, DKGMessage{Type: DKGJustifications, From: session.index, To: DKGBroadcast, Payload: serializer})
+}
+
+func (session *sharingSession) receiveJustifications(msg DKGMessage) {
+	dealer := msg.From
+	if session.disqualified[dealer] || session.commitments[dealer] == nil {
+		return
+	}
+	revealed := make(map[int64][]base.Ed25519Scala)
+	err := unmarshalPayload(msg.Payload, func(deserializer *base.DeSerializer) error {
+		var l int64
+		_, err := deserializer.ReadInt64(&l)
+		if err != nil {
+			return err
+		}
+		if l < 0 || l > int64(session.endpoints) {
+			return errors.New("cpk: bad justifications count")
+		}
+		for i := int64(0); i < l; i++ {
+			var accuser int64
+			_, err = deserializer.ReadInt64(&accuser)
+			if err != nil {
+				return err
+			}
+			revealed[accuser], err = deserializeScalars(deserializer)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		session.disqualified[dealer] = true
+		return
+	}
+	accusers := session.complaints[dealer]
+	// 被过多节点投诉的发起者公开的分片足以恢复其多项式，直接取消资格
+	if len(accusers) >= session.params.Threshold {
+		session.disqualified[dealer] = true
+		return
+	}
+	for _, accuser := range accusers {
+		shares, ok := revealed[accuser]
+		if !ok || session.commitments[dealer].VerifyShares(accuser, shares) != nil {
+			session.disqualified[dealer] = true
+			return
+		}
+		if accuser == session.index {
+			session.shares[dealer] = shares
+		}
+	}
+}
+
+// combine returns the distributed CA holding the weighted sum of the shares of the
+// dealers, nil weights sum the shares, endpoints that receive no share return nil
+func (session *sharingSession) combine(dealers []int64, weights []*edwards25519.Scalar) (*DistributedCA, error) {
+	if !session.receiver() {
+		return nil, nil
+	}
+	params := session.params
+	commitments := &Commitments{Threshold: params.Threshold, Points: make([]base.Ed25519Point, params.Size()*params.Threshold)}
+	piece := make([]base.Ed25519Scala, params.Size())
+	for e := range piece {
+		piece[e].Scalar = edwards25519.NewScalar()
+	}
+	scalars := make([]*edwards25519.Scalar, len(dealers))
+	for d, dealer := range dealers {
+		if session.shares[dealer] == nil {
+			return nil, ErrDKGFailed
+		}
+		scalars[d] = scalarFromInt(1)
+		if weights != nil {
+			scalars[d] = weights[d]
+		}
+		for e := range piece {
+			piece[e].Scalar.MultiplyAdd(scalars[d], session.shares[dealer][e].Scalar, piece[e].Scalar)
+		}
+	}
+	// 承诺是公开的，逐个位置并行地用变时多标量乘法计算 Σ w_d·C_d
+	err := parallelFor(context.Background(), len(commitments.Points), func(i int) error {
+		points := make([]*edwards25519.Point, len(dealers))
+		for d, dealer := range dealers {
+			points[d] = session.commitments[dealer].Points[i].Point
+		}
+		commitments.Points[i].Point = (&edwards25519.Point{}).VarTimeMultiScalarMult(scalars, points)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	distributedCA := &DistributedCA{params: params, privateMatrixPiece: piece, commitments: commitments, Index: session.index}
+	if err := distributedCA.VerifyShares(); err != nil {
+		return nil, err
+	}
+	return distributedCA, nil
+}
+
+// DKGNode runs the distributed key generation for one node, every node deals a random
+// matrix as in Pedersen's protocol and the private matrix is the sum of the qualified
+// dealers' matrices, so no party ever learns it
+type DKGNode struct {
+	sharingSession
+}
+
+// NewDKGNode returns the node with the given index of a distributed key generation
+func NewDKGNode(params Params, index int64) (*DKGNode, error) {
+	if err := params.Validate(); err != nil {
+		return nil, err
+	}
+	if index < 0 || index >= int64(params.Nodes) {
+		return nil, ErrIndexOutOfRange
+	}
+	return &DKGNode{sharingSession{params: params, endpoints: params.Nodes, index: index}}, nil
+}
+
+// Run executes the protocol with the other nodes over the transport and returns the
+// distributed CA holding the share of the jointly generated private matrix
+func (node *DKGNode) Run(ctx context.Context, transport DKGTransport) (*DistributedCA, error) {
+	defer node.wipe()
+	node.secrets = make([]*edwards25519.Scalar, node.params.Size())
+	for e := range node.secrets {
+		node.secrets[e] = base.RandomPrivateKey().Scalar
+	}
+	if err := node.run(ctx, transport); err != nil {
+		return nil, err
+	}
+	// 合格发起者少于门限时，少于门限的节点即可知道私钥矩阵
+	qualified := node.Qualified()
+	if len(qualified) < node.params.Threshold {
+		return nil, ErrDKGFailed
+	}
+	return node.combine(qualified, nil)
+}
+
+// serializeScalars writes the scalars prefixed with their count
+func serializeScalars(scalars []base.Ed25519Scala) []byte {
+	var serializer base.Serializer
+	serializer.WriteInt64(int64(len(scalars)))
+	for index := range scalars {
+		serializer.WriteSerializable(&scalars[index])
+	}
+	return serializer
+}
+
+func deserializeScalars(deserializer *base.DeSerializer) ([]base.Ed25519Scala, error) {
+	var l int64
+	_, err := deserializer.ReadInt64(&l)
+	if err != nil {
+		return nil, err
+	}
+	return readScalars(deserializer, l)
+}
+
+// writeIndices writes the node indices prefixed with their count
+func writeIndices(serializer *base.Serializer, indices []int64) {
+	serializer.WriteInt64(int64(len(indices)))
+	for _, index := range indices {
+		serializer.WriteInt64(index)
+	}
+}
+
+// readIndices reads at most max node indices written by writeIndices
+func readIndices(deserializer *base.DeSerializer, max int) ([]int64, error) {
+	var l int64
+	_, err := deserializer.ReadInt64(&l)
+	if err != nil {
+		return nil, err
+	}
+	if l < 0 || l > int64(max) {
+		return nil, errors.New("cpk: bad indices count")
+	}
+	indices := make([]int64, l)
+	for i := range indices {
+		_, err = deserializer.ReadInt64(&indices[i])
+		if err != nil {
+			return nil, err
+		}
+	}
+	return indices, nil
+}
+
+// equalIndices reports whether the two lists hold the same indices in the same order
+func equalIndices(a, b []int64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// unmarshalPayload decodes the whole payload with the deserialize function
+func unmarshalPayload(payload []byte, deserialize func(*base.DeSerializer) error) error {
+	deserializer, err := base.NewDeserializer(payload)
+	if err != nil {
+		return err
+	}
+	if err = deserialize(deserializer); err != nil {
+		return err
+	}
+	return checkConsumed(deserializer)
+}
+
+// localDKGTransport delivers the messages between the nodes of one process
+type localDKGTransport struct {
+	index int64
+	// 每条消息都经过序列化，节点之间不共享内存
+	inboxes []chan []byte
+}
+
+// NewLocalDKGTransports returns connected in-process transports for the nodes
+func NewLocalDKGTransports(nodes int) []DKGTransport {
+	inboxes := make([]chan []byte, nodes)
+	for i := range inboxes {
+		// 每个节点在五轮中每轮最多从其他节点各收到一条消息
+		inboxes[i] = make(chan []byte, 5*nodes)
+	}
+	transports := make([]DKGTransport, nodes)
+	for i := range transports {
+		transports[i] = &localDKGTransport{index: int64(i), inboxes: inboxes}
+	}
+	return transports
+}
+
+func (transport *localDKGTransport) Send(ctx context.Context, msg DKGMessage) error {
+	msg.From = transport.index
+	var serializer base.Serializer
+	msg.Serialize(&serializer)
+	if msg.To != DKGBroadcast {
+		if msg.To < 0 || msg.To >= int64(len(transport.inboxes)) {
+			return ErrIndexOutOfRange
+		}
+		return transport.deliver(ctx, msg.To, serializer)
+	}
+	for to := range transport.inboxes {
+		if int64(to) == transport.index {
+			continue
+		}
+		if err := transport.deliver(ctx, int64(to), serializer); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (transport *localDKGTransport) deliver(ctx context.Context, to int64, data []byte) error {
+	select {
+	case transport.inboxes[to] <- append([]byte(nil), data...):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (transport *localDKGTransport) Receive(ctx context.Context) (DKGMessage, error) {
+	var msg DKGMessage
+	select {
+	case data := <-transport.inboxes[transport.index]:
+		err := unmarshalPayload(data, msg.Deserialize)
+		return msg, err
+	case <-ctx.Done():
+		return msg, ctx.Err()
+	}
+}
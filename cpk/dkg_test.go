@@ -0,0 +1,317 @@
+package cpk
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/walegarrett/cpk-algs/base"
+	"sync"
+	"testing"
+	"time"
+)
+
+// tamperingTransport corrupts the messages of the given types sent by the node
+type tamperingTransport struct {
+	DKGTransport
+	types map[DKGMessageType]bool
+	to    int64
+}
+
+func (transport *tamperingTransport) Send(ctx context.Context, msg DKGMessage) error {
+	if transport.types[msg.Type] && (msg.To == transport.to || msg.Type != DKGShare) {
+		var scalars []byte
+		if msg.Type == DKGShare {
+			scalars = msg.Payload
+		} else if len(msg.Payload) > 16+32 {
+			// 篡改公开的第一个分片
+			scalars = msg.Payload[16:]
+		}
+		if len(scalars) > 8 {
+			scalars = append([]byte(nil), scalars...)
+			scalars[8] ^= 1
+			msg.Payload = append(append([]byte(nil), msg.Payload[:len(msg.Payload)-len(scalars)]...), scalars...)
+		}
+	}
+	return transport.DKGTransport.Send(ctx, msg)
+}
+
+// runDKG runs the key generation over the transports returned by wrap, the sorted nodes in faulty may fail
+func runDKG(t *testing.T, params Params, wrap func(index int64, transport DKGTransport) DKGTransport, faulty ...int64) ([]*DistributedCA, []*DKGNode) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	transports := NewLocalDKGTransports(params.Nodes)
+	nodes := make([]*DKGNode, params.Nodes)
+	distributedCAs := make([]*DistributedCA, params.Nodes)
+	var wg sync.WaitGroup
+	for i := range nodes {
+		node, err := NewDKGNode(params, int64(i))
+		require.NoError(t, err)
+		nodes[i] = node
+		transport := transports[i]
+		if wrap != nil {
+			transport = wrap(int64(i), transport)
+		}
+		wg.Add(1)
+		go func(i int, transport DKGTransport) {
+			defer wg.Done()
+			distributedCA, err := nodes[i].Run(ctx, transport)
+			if !containsIndex(faulty, int64(i)) {
+				assert.NoError(t, err)
+			}
+			distributedCAs[i] = distributedCA
+		}(i, transport)
+	}
+	wg.Wait()
+	for i := range distributedCAs {
+		if !containsIndex(faulty, int64(i)) {
+			require.NotNil(t, distributedCAs[i])
+		}
+	}
+	return distributedCAs, nodes
+}
+
+// checkDKGResult checks the results of the honest nodes
+func checkDKGResult(t *testing.T, params Params, distributedCAs []*DistributedCA, honest []int) {
+	commitments, err := distributedCAs[honest[0]].ExportCommitments()
+	require.NoError(t, err)
+	var expectedCommitments base.Serializer
+	commitments.Serialize(&expectedCommitments)
+	for _, node := range honest {
+		require.NoError(t, distributedCAs[node].VerifyShares())
+		other, err := distributedCAs[node].ExportCommitments()
+		require.NoError(t, err)
+		var serializer base.Serializer
+		other.Serialize(&serializer)
+		require.Equal(t, expectedCommitments, serializer)
+	}
+
+	var pmPieces []PMPiece
+	var skPieces []SKPiece
+	for _, node := range []int{honest[len(honest)-1], honest[0]} {
+		pmPiece, err := distributedCAs[node].ExportPublicMatrixPiece()
+		require.NoError(t, err)
+		pmPieces = append(pmPieces, pmPiece)
+		skPiece, err := distributedCAs[node].QuerySK("alice")
+		require.NoError(t, err)
+		skPieces = append(skPieces, skPiece)
+	}
+	client := Client{params: params}
+	require.NoError(t, client.CombinePMPieces(pmPieces))
+	published, err := NewClientWithParams(params, commitments.PublicMatrix())
+	require.NoError(t, err)
+	fingerprint, err := client.Fingerprint()
+	require.NoError(t, err)
+	expected, err := published.Fingerprint()
+	require.NoError(t, err)
+	require.Equal(t, expected, fingerprint)
+
+	pk, err := published.QueryPK("alice")
+	require.NoError(t, err)
+	_, err = client.CombineSKPieces(skPieces, *pk)
+	require.NoError(t, err)
+}
+
+func TestDKGNode_Run(t *testing.T) {
+	params := Params{Rows: 16, SubsSize: 4, Blocks: 4, Threshold: 2, Nodes: 4}
+	_, err := NewDKGNode(params, 4)
+	require.ErrorIs(t, err, ErrIndexOutOfRange)
+
+	distributedCAs, nodes := runDKG(t, params, nil)
+	checkDKGResult(t, params, distributedCAs, []int{0, 1, 2, 3})
+	for _, node := range nodes {
+		require.Equal(t, []int64{0, 1, 2, 3}, node.Qualified())
+	}
+}
+
+func TestDKGNode_RunWithComplaints(t *testing.T) {
+	params := Params{Rows: 16, SubsSize: 4, Blocks: 4, Threshold: 2, Nodes: 4}
+
+	// 节点 2 发给节点 0 的分片错误，公开的分片正确，仍然合格
+	distributedCAs, nodes := runDKG(t, params, func(index int64, transport DKGTransport) DKGTransport {
+		if index != 2 {
+			return transport
+		}
+		return &tamperingTransport{DKGTransport: transport, types: map[DKGMessageType]bool{DKGShare: true}, to: 0}
+	})
+	checkDKGResult(t, params, distributedCAs, []int{0, 1, 2, 3})
+	for _, node := range nodes {
+		require.Equal(t, []int64{0, 1, 2, 3}, node.Qualified())
+	}
+
+	// 节点 1 公开的分片同样错误，被其他所有节点取消资格，节点 1 自己的合格集合与其他节点不同而失败
+	distributedCAs, nodes = runDKG(t, params, func(index int64, transport DKGTransport) DKGTransport {
+		if index != 1 {
+			return transport
+		}
+		return &tamperingTransport{DKGTransport: transport, types: map[DKGMessageType]bool{DKGShare: true, DKGJustifications: true}, to: 3}
+	}, 1)
+	require.Nil(t, distributedCAs[1])
+	checkDKGResult(t, params, distributedCAs, []int{0, 2, 3})
+	for _, node := range []int{0, 2, 3} {
+		require.Equal(t, []int64{0, 2, 3}, nodes[node].Qualified())
+	}
+}
+
+// qualifiedTransport broadcasts the given dealers as the qualified dealers of the node
+type qualifiedTransport struct {
+	DKGTransport
+	dealers []int64
+}
+
+func (transport *qualifiedTransport) Send(ctx context.Context, msg DKGMessage) error {
+	if msg.Type == DKGQualified {
+		var serializer base.Serializer
+		writeIndices(&serializer, transport.dealers)
+		msg.Payload = serializer
+	}
+	return transport.DKGTransport.Send(ctx, msg)
+}
+
+func TestDKGNode_RunWithDisagreement(t *testing.T) {
+	params := Params{Rows: 16, SubsSize: 4, Blocks: 4, Threshold: 2, Nodes: 4}
+
+	// 节点 2 声称没有收到节点 3 的承诺，其他节点无法确认合格集合一致而失败
+	distributedCAs, _ := runDKG(t, params, func(index int64, transport DKGTransport) DKGTransport {
+		if index != 2 {
+			return transport
+		}
+		return &qualifiedTransport{DKGTransport: transport, dealers: []int64{0, 1, 2}}
+	}, 0, 1, 2, 3)
+	for _, node := range []int{0, 1, 3} {
+		require.Nil(t, distributedCAs[node])
+	}
+}
+
+// droppingTransport drops the messages of the node except those of the given types
+type droppingTransport struct {
+	DKGTransport
+	types map[DKGMessageType]bool
+}
+
+func (transport *droppingTransport) Send(ctx context.Context, msg DKGMessage) error {
+	if !transport.types[msg.Type] {
+		return nil
+	}
+	return transport.DKGTransport.Send(ctx, msg)
+}
+
+// roundClosingTransport closes each round once the node has received the expected number
+// of messages of the round, so that the rounds end without waiting for the deadline
+type roundClosingTransport struct {
+	DKGTransport
+	mu       sync.Mutex
+	expected map[DKGMessageType]int
+	received map[DKGMessageType]int
+	closed   map[DKGMessageType]chan struct{}
+}
+
+func newRoundClosingTransport(transport DKGTransport, expected map[DKGMessageType]int) *roundClosingTransport {
+	return &roundClosingTransport{
+		DKGTransport: transport,
+		expected:     expected,
+		received:     make(map[DKGMessageType]int),
+		closed:       make(map[DKGMessageType]chan struct{}),
+	}
+}
+
+// round returns the channel of the round, the caller must hold the lock
+func (transport *roundClosingTransport) round(messageType DKGMessageType) chan struct{} {
+	closed, ok := transport.closed[messageType]
+	if !ok {
+		closed = make(chan struct{})
+		transport.closed[messageType] = closed
+		if transport.received[messageType] >= transport.expected[messageType] {
+			close(closed)
+		}
+	}
+	return closed
+}
+
+func (transport *roundClosingTransport) RoundClosed(messageType DKGMessageType) <-chan struct{} {
+	transport.mu.Lock()
+	defer transport.mu.Unlock()
+	return transport.round(messageType)
+}
+
+func (transport *roundClosingTransport) Receive(ctx context.Context) (DKGMessage, error) {
+	msg, err := transport.DKGTransport.Receive(ctx)
+	if err != nil {
+		return msg, err
+	}
+	transport.mu.Lock()
+	defer transport.mu.Unlock()
+	closed := transport.round(msg.Type)
+	transport.received[msg.Type]++
+	if transport.received[msg.Type] == transport.expected[msg.Type] {
+		close(closed)
+	}
+	return msg, nil
+}
+
+func TestDKGNode_RunWithSilentDealer(t *testing.T) {
+	params := Params{Rows: 16, SubsSize: 4, Blocks: 4, Threshold: 2, Nodes: 4}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	honest := []int{0, 1, 2}
+	types := []DKGMessageType{DKGCommitments, DKGShare, DKGComplaints, DKGJustifications, DKGQualified}
+	// 节点 3 完全不在线，或者只广播承诺而不发送分片与公开的分片。
+	// 诚实节点收到其他诚实节点的消息后结束每一轮，与计时无关
+	for _, silent := range []map[DKGMessageType]bool{nil, {DKGCommitments: true}} {
+		expected := make(map[DKGMessageType]int)
+		for _, messageType := range types {
+			expected[messageType] = len(honest) - 1
+			if silent[messageType] {
+				expected[messageType]++
+			}
+		}
+		transports := NewLocalDKGTransports(params.Nodes)
+		nodes := make([]*DKGNode, params.Nodes)
+		distributedCAs := make([]*DistributedCA, params.Nodes)
+		var wg sync.WaitGroup
+		for i := range nodes {
+			if i == 3 && silent == nil {
+				continue
+			}
+			node, err := NewDKGNode(params, int64(i))
+			require.NoError(t, err)
+			nodes[i] = node
+			transport := DKGTransport(newRoundClosingTransport(transports[i], expected))
+			if i == 3 {
+				transport = &droppingTransport{DKGTransport: transports[i], types: silent}
+			}
+			wg.Add(1)
+			go func(i int, transport DKGTransport) {
+				defer wg.Done()
+				distributedCA, err := nodes[i].Run(ctx, transport)
+				if i != 3 {
+					assert.NoError(t, err)
+				}
+				distributedCAs[i] = distributedCA
+			}(i, transport)
+		}
+		wg.Wait()
+		for _, i := range honest {
+			require.NotNil(t, distributedCAs[i])
+			require.Equal(t, []int64{0, 1, 2}, nodes[i].Qualified())
+		}
+		checkDKGResult(t, params, distributedCAs, honest)
+	}
+
+	// 合格的发起者少于门限时失败
+	node, err := NewDKGNode(params, 0)
+	require.NoError(t, err)
+	_, err = node.Run(ctx, newRoundClosingTransport(NewLocalDKGTransports(params.Nodes)[0], nil))
+	require.ErrorIs(t, err, ErrDKGFailed)
+}
+
+func TestDKGNode_RunCanceled(t *testing.T) {
+	params := Params{Rows: 16, SubsSize: 4, Blocks: 4, Threshold: 2, Nodes: 3}
+	transports := NewLocalDKGTransports(params.Nodes)
+	node, err := NewDKGNode(params, 0)
+	require.NoError(t, err)
+	// 其他节点不在线
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = node.Run(ctx, transports[0])
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+}
@@ -0,0 +1,124 @@
+package cpk
+
+import (
+	"bytes"
+	"github.com/walegarrett/cpk-algs/base"
+)
+
+// 身份映射域的域标签
+const domainTag = "cpk-domain-v1"
+
+// Domain separates the identity mapping of the applications sharing one matrix, the
+// zero Domain keeps the original mapping of the plain ident
+type Domain struct {
+	// 租户或应用的命名空间
+	Namespace string
+	// 映射版本，修改后同一身份映射到新的密钥
+	Version int32
+}
+
+// Validate checks that a non-zero domain has a namespace and a positive mapping version
+func (domain Domain) Validate() error {
+	if domain == (Domain{}) {
+		return nil
+	}
+	if domain.Namespace == "" || domain.Version <= 0 {
+		return ErrInvalidDomain
+	}
+	return nil
+}
+
+// reservedPrefix returns the start of every encoding tagged with the tag
+func reservedPrefix(tag string) []byte {
+	var serializer base.Serializer
+	serializer.WriteString(tag)
+	return serializer
+}
+
+var (
+	// 身份域编码的开头，默认域中以此开头的身份会与某个域中的身份碰撞
+	domainIdentPrefix = reservedPrefix(domainTag)
+	// 周期身份编码的开头，任何域中以此开头的身份都会与同一域中的周期身份碰撞
+	epochIdentPrefix = reservedPrefix(epochIdentTag)
+)
+
+// plainIdent returns the encoding of a plain identity, it rejects the identities that could
+// equal the encoding of an identity within a domain or of an epoch identity
+func (domain Domain) plainIdent(ident string) ([]byte, error) {
+	if bytes.HasPrefix([]byte(ident), epochIdentPrefix) {
+		return nil, ErrReservedIdent
+	}
+	if domain == (Domain{}) && bytes.HasPrefix([]byte(ident), domainIdentPrefix) {
+		return nil, ErrReservedIdent
+	}
+	return []byte(ident), nil
+}
+
+// encodeIdent returns the identity encoding mixed with the domain before it is hashed
+func (domain Domain) encodeIdent(ident []byte) []byte {
+	if domain == (Domain{}) {
+		return ident
+	}
+	var serializer base.Serializer
+	serializer.WriteString(domainTag)
+	serializer.WriteString(domain.Namespace)
+	serializer.WriteInt32(domain.Version)
+	serializer.WriteBytesWithLength(ident)
+	return serializer
+}
+
+// Domain returns the identity domain of the CA
+func (ca *CA) Domain() Domain {
+	return ca.domain
+}
+
+// WithDomain returns a CA sharing the private matrix that maps identities within the domain
+func (ca *CA) WithDomain(domain Domain) (*CA, error) {
+	if err := domain.Validate(); err != nil {
+		return nil, err
+	}
+	res := *ca
+	res.domain = domain
+	return &res, nil
+}
+
+// Domain returns the identity domain of the distributed CA
+func (distributedCA *DistributedCA) Domain() Domain {
+	return distributedCA.domain
+}
+
+// WithDomain returns a distributed CA sharing the matrix shares that maps identities within the domain
+func (distributedCA *DistributedCA) WithDomain(domain Domain) (*DistributedCA, error) {
+	if err := domain.Validate(); err != nil {
+		return nil, err
+	}
+	res := *distributedCA
+	res.domain = domain
+	return &res, nil
+}
+
+// Domain returns the identity domain of the client
+func (client *Client) Domain() Domain {
+	return client.domain
+}
+
+// WithDomain returns a client sharing the public matrix that maps identities within the domain
+func (client *Client) WithDomain(domain Domain) (*Client, error) {
+	if err := domain.Validate(); err != nil {
+		return nil, err
+	}
+	res := *client
+	res.domain = domain
+	if client.versions != nil {
+		versions, err := client.versions.withDomain(domain)
+		if err != nil {
+			return nil, err
+		}
+		res.versions = versions
+	}
+	if client.pkCache != nil {
+		// 缓存的查询函数绑定了原客户端，副本使用独立的缓存
+		res.pkCache = base.NewLRU(client.pkCache.Capacity(), res.cachedQuery)
+	}
+	return &res, nil
+}
@@ -0,0 +1,104 @@
+package cpk
+
+import (
+	"github.com/stretchr/testify/require"
+	"github.com/walegarrett/cpk-algs/base"
+	"testing"
+)
+
+func TestDomain(t *testing.T) {
+	var ca CA
+	require.NoError(t, ca.InitCA("gen_key"))
+	var client Client
+	require.NoError(t, ca.ExportPublicMatrixForClient(&client))
+
+	mail := Domain{Namespace: "mail", Version: 1}
+	mailCA, err := ca.WithDomain(mail)
+	require.NoError(t, err)
+	mailClient, err := client.WithDomain(mail)
+	require.NoError(t, err)
+	require.Equal(t, mail, mailClient.Domain())
+	require.Equal(t, Domain{}, client.Domain())
+
+	sk, err := ca.QuerySK("alice")
+	require.NoError(t, err)
+	mailSK, err := mailCA.QuerySK("alice")
+	require.NoError(t, err)
+	require.NotEqual(t, 1, sk.Scalar.Equal(mailSK.Scalar))
+	pk, err := mailClient.QueryPK("alice")
+	require.NoError(t, err)
+	require.Equal(t, 1, pk.Equal(mailSK.Public().Point))
+	pk, err = client.QueryPK("alice")
+	require.NoError(t, err)
+	require.Equal(t, 1, pk.Equal(sk.Public().Point))
+
+	// 映射版本与命名空间都参与哈希
+	for _, other := range []Domain{{Namespace: "mail", Version: 2}, {Namespace: "chat", Version: 1}} {
+		otherCA, err := ca.WithDomain(other)
+		require.NoError(t, err)
+		otherSK, err := otherCA.QuerySK("alice")
+		require.NoError(t, err)
+		require.NotEqual(t, 1, otherSK.Scalar.Equal(mailSK.Scalar))
+	}
+
+	_, err = ca.WithDomain(Domain{Namespace: "mail"})
+	require.ErrorIs(t, err, ErrInvalidDomain)
+	_, err = client.WithDomain(Domain{Version: 1})
+	require.ErrorIs(t, err, ErrInvalidDomain)
+
+	// 分布式节点与客户端在同一域内组合出相同的私钥
+	var skPieces []SKPiece
+	for i := 0; i < 2; i++ {
+		var distributedCA DistributedCA
+		require.NoError(t, distributedCA.InitDistributedCA(int64(i), "gen_key"))
+		mailDistributedCA, err := distributedCA.WithDomain(mail)
+		require.NoError(t, err)
+		skPiece, err := mailDistributedCA.QuerySKAt("alice", Epoch{Granularity: EpochDay, Number: 1})
+		require.NoError(t, err)
+		skPieces = append(skPieces, skPiece)
+	}
+	epochSK, err := mailCA.QuerySKAt("alice", Epoch{Granularity: EpochDay, Number: 1})
+	require.NoError(t, err)
+	pk, err = mailClient.QueryPKAt("alice", Epoch{Granularity: EpochDay, Number: 1})
+	require.NoError(t, err)
+	combined, err := mailClient.CombineSKPieces(skPieces, *pk)
+	require.NoError(t, err)
+	require.Equal(t, 1, combined.Scalar.Equal(epochSK.Scalar))
+}
+
+func TestDomain_ReservedIdent(t *testing.T) {
+	var ca CA
+	require.NoError(t, ca.InitCA("gen_key"))
+	var client Client
+	require.NoError(t, ca.ExportPublicMatrixForClient(&client))
+	mail := Domain{Namespace: "mail", Version: 1}
+	mailCA, err := ca.WithDomain(mail)
+	require.NoError(t, err)
+
+	// 默认域中等于域编码的身份会得到域中 alice 的私钥，必须拒绝
+	encoded := string(mail.encodeIdent([]byte("alice")))
+	_, err = ca.QuerySK(encoded)
+	require.ErrorIs(t, err, ErrReservedIdent)
+	_, err = client.QueryPK(encoded)
+	require.ErrorIs(t, err, ErrReservedIdent)
+	_, err = client.PartialPK(encoded, 0)
+	require.ErrorIs(t, err, ErrReservedIdent)
+
+	var distributedCA DistributedCA
+	require.NoError(t, distributedCA.InitDistributedCA(0, "gen_key"))
+	_, err = distributedCA.QuerySK(encoded)
+	require.ErrorIs(t, err, ErrReservedIdent)
+	enrollKey := base.RandomPrivateKey()
+	_, err = distributedCA.SealSK(encoded, enrollKey.Public())
+	require.ErrorIs(t, err, ErrReservedIdent)
+
+	// 域中的身份与默认域中的普通身份不受影响
+	_, err = mailCA.QuerySK("alice")
+	require.NoError(t, err)
+	mailDistributedCA, err := distributedCA.WithDomain(mail)
+	require.NoError(t, err)
+	_, err = mailDistributedCA.QuerySK(encoded)
+	require.NoError(t, err)
+	_, err = ca.QuerySK("alice")
+	require.NoError(t, err)
+}
@@ -0,0 +1,382 @@
+package cpk
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"github.com/walegarrett/cpk-algs/base"
+	"github.com/walegarrett/cpk-algs/base/edwards25519"
+	"strconv"
+	"strings"
+)
+
+// PEM 块类型，块内容为 MarshalBinary 的容器格式（公钥为32字节编码）
+const (
+	PEMPublicMatrix  = "CPK PUBLIC MATRIX"
+	PEMPrivateMatrix = "CPK PRIVATE MATRIX"
+	PEMMatrixShare   = "CPK MATRIX SHARE"
+	PEMPMPiece       = "CPK PM PIECE"
+	PEMSKPiece       = "CPK SK PIECE"
+	PEMPublicKey     = "CPK PUBLIC KEY"
+)
+
+// encodePEM armors the data, the headers are informational and not trusted on decoding
+func encodePEM(blockType string, headers map[string]string, data []byte) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: blockType, Headers: headers, Bytes: data})
+}
+
+// decodePEM returns the content of the first PEM block, which must have the given type
+func decodePEM(text []byte, blockType string) ([]byte, error) {
+	block, _ := pem.Decode(text)
+	if block == nil {
+		return nil, fmt.Errorf("%w: no PEM block", ErrInvalidFormat)
+	}
+	if block.Type != blockType {
+		return nil, fmt.Errorf("%w: PEM block %q, expected %q", ErrInvalidFormat, block.Type, blockType)
+	}
+	return block.Bytes, nil
+}
+
+// paramsHeaders describes the layout in the PEM headers for inspection by eye
+func paramsHeaders(params Params) map[string]string {
+	return map[string]string{
+		"Rows":      strconv.Itoa(params.Rows),
+		"Threshold": fmt.Sprintf("%d/%d", params.Threshold, params.Nodes),
+	}
+}
+
+// EncodePublicKeyPEM armors the public key
+func EncodePublicKeyPEM(publicKey base.PublicKey) ([]byte, error) {
+	if publicKey.Point == nil {
+		return nil, ErrInvalidPoint
+	}
+	return encodePEM(PEMPublicKey, nil, publicKey.Bytes()), nil
+}
+
+// DecodePublicKeyPEM decodes a public key armored by EncodePublicKeyPEM
+func DecodePublicKeyPEM(text []byte) (*base.PublicKey, error) {
+	data, err := decodePEM(text, PEMPublicKey)
+	if err != nil {
+		return nil, err
+	}
+	deserializer, err := base.NewDeserializer(data)
+	if err != nil {
+		return nil, err
+	}
+	var point base.Ed25519Point
+	if err = readPoint(deserializer, &point); err != nil {
+		return nil, err
+	}
+	if err = checkConsumed(deserializer); err != nil {
+		return nil, err
+	}
+	return &base.PublicKey{Point: point.Point}, nil
+}
+
+// MarshalText returns the fingerprint in hex
+func (fingerprint Fingerprint) MarshalText() ([]byte, error) {
+	return []byte(hex.EncodeToString(fingerprint[:])), nil
+}
+
+// UnmarshalText decodes a hex fingerprint, the spaces of String are ignored
+func (fingerprint *Fingerprint) UnmarshalText(text []byte) error {
+	buf, err := hex.DecodeString(strings.ReplaceAll(string(text), " ", ""))
+	if err != nil {
+		return err
+	}
+	if len(buf) != len(fingerprint) {
+		return fmt.Errorf("%w: bad fingerprint length", ErrInvalidFormat)
+	}
+	copy(fingerprint[:], buf)
+	return nil
+}
+
+// checkMatrixPoints rejects identity elements of a decoded matrix
+func checkMatrixPoints(points []base.Ed25519Point) error {
+	identity := edwards25519.NewIdentityPoint()
+	for i := range points {
+		if points[i].Point == nil || points[i].Equal(identity) == 1 {
+			return ErrInvalidPoint
+		}
+	}
+	return nil
+}
+
+// MarshalText returns the public matrix armored in PEM
+func (client Client) MarshalText() ([]byte, error) {
+	data, err := client.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	headers := paramsHeaders(client.Params())
+	headers["Fingerprint"] = client.fingerprint.String()
+	return encodePEM(PEMPublicMatrix, headers, data), nil
+}
+
+// UnmarshalText decodes a public matrix armored in PEM
+func (client *Client) UnmarshalText(text []byte) error {
+	data, err := decodePEM(text, PEMPublicMatrix)
+	if err != nil {
+		return err
+	}
+	return client.UnmarshalBinary(data)
+}
+
+type clientJSON struct {
+	Params      Params              `json:"params"`
+	Fingerprint Fingerprint         `json:"fingerprint"`
+	Matrix      []base.Ed25519Point `json:"matrix"`
+}
+
+func (client Client) MarshalJSON() ([]byte, error) {
+	if len(client.cachedMatrix) != client.Params().Size() {
+		return nil, ErrMatrixNotLoaded
+	}
+	return json.Marshal(clientJSON{
+		Params:      client.Params(),
+		Fingerprint: client.fingerprint,
+		Matrix:      client.publicMatrix,
+	})
+}
+
+// UnmarshalJSON decodes the public matrix and checks it against the fingerprint
+func (client *Client) UnmarshalJSON(data []byte) error {
+	if err := client.requireUnpinned(); err != nil {
+		return err
+	}
+	var decoded clientJSON
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+	if err := checkMatrixPoints(decoded.Matrix); err != nil {
+		return err
+	}
+	fingerprint, err := MatrixFingerprint(decoded.Params, decoded.Matrix)
+	if err != nil {
+		return err
+	}
+	if fingerprint != decoded.Fingerprint {
+		return ErrFingerprintMismatch
+	}
+	client.params = decoded.Params
+	client.publicMatrix = decoded.Matrix
+	client.pmPieces = nil
+	client.manifest = nil
+	client.precompute()
+	return nil
+}
+
+// MarshalText returns the private matrix armored in PEM
+func (ca CA) MarshalText() ([]byte, error) {
+	data, err := ca.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	return encodePEM(PEMPrivateMatrix, paramsHeaders(ca.Params()), data), nil
+}
+
+// UnmarshalText decodes a private matrix armored in PEM
+func (ca *CA) UnmarshalText(text []byte) error {
+	data, err := decodePEM(text, PEMPrivateMatrix)
+	if err != nil {
+		return err
+	}
+	return ca.UnmarshalBinary(data)
+}
+
+type caJSON struct {
+	Params Params              `json:"params"`
+	Matrix []base.Ed25519Scala `json:"matrix"`
+}
+
+func (ca CA) MarshalJSON() ([]byte, error) {
+	if len(ca.privateMatrix) != ca.Params().Size() {
+		return nil, ErrMatrixNotLoaded
+	}
+	return json.Marshal(caJSON{Params: ca.Params(), Matrix: ca.privateMatrix})
+}
+
+func (ca *CA) UnmarshalJSON(data []byte) error {
+	var decoded caJSON
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+	if err := decoded.Params.Validate(); err != nil {
+		return err
+	}
+	if err := checkScalars(decoded.Matrix, decoded.Params.Size()); err != nil {
+		return err
+	}
+	ca.params = decoded.Params
+	ca.privateMatrix = decoded.Matrix
+	ca.backend = nil
+	return nil
+}
+
+// MarshalText returns the matrix shares of the node armored in PEM
+func (distributedCA DistributedCA) MarshalText() ([]byte, error) {
+	data, err := distributedCA.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	headers := paramsHeaders(distributedCA.Params())
+	headers["Index"] = strconv.FormatInt(distributedCA.Index, 10)
+	return encodePEM(PEMMatrixShare, headers, data), nil
+}
+
+// UnmarshalText decodes the matrix shares of a node armored in PEM
+func (distributedCA *DistributedCA) UnmarshalText(text []byte) error {
+	data, err := decodePEM(text, PEMMatrixShare)
+	if err != nil {
+		return err
+	}
+	return distributedCA.UnmarshalBinary(data)
+}
+
+type commitmentsJSON struct {
+	Threshold int                 `json:"threshold"`
+	Points    []base.Ed25519Point `json:"points"`
+}
+
+type distributedCAJSON struct {
+	Params      Params              `json:"params"`
+	Index       int64               `json:"index"`
+	Shares      []base.Ed25519Scala `json:"shares"`
+	Commitments *commitmentsJSON    `json:"commitments,omitempty"`
+}
+
+func (distributedCA DistributedCA) MarshalJSON() ([]byte, error) {
+	if len(distributedCA.privateMatrixPiece) != distributedCA.Params().Size() {
+		return nil, ErrMatrixNotLoaded
+	}
+	encoded := distributedCAJSON{
+		Params: distributedCA.Params(),
+		Index:  distributedCA.Index,
+		Shares: distributedCA.privateMatrixPiece,
+	}
+	if distributedCA.commitments != nil {
+		encoded.Commitments = &commitmentsJSON{
+			Threshold: distributedCA.commitments.Threshold,
+			Points:    distributedCA.commitments.Points,
+		}
+	}
+	return json.Marshal(encoded)
+}
+
+func (distributedCA *DistributedCA) UnmarshalJSON(data []byte) error {
+	var decoded distributedCAJSON
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+	if err := decoded.Params.Validate(); err != nil {
+		return err
+	}
+	if err := checkScalars(decoded.Shares, decoded.Params.Size()); err != nil {
+		return err
+	}
+	if decoded.Index < 0 || decoded.Index >= int64(decoded.Params.Nodes) {
+		return ErrIndexOutOfRange
+	}
+	var commitments *Commitments
+	if decoded.Commitments != nil {
+		commitments = &Commitments{Threshold: decoded.Commitments.Threshold, Points: decoded.Commitments.Points}
+		if commitments.Threshold != decoded.Params.Threshold || commitments.Size() != decoded.Params.Size() ||
+			len(commitments.Points) != commitments.Size()*commitments.Threshold {
+			return fmt.Errorf("%w: bad commitments size", ErrInvalidFormat)
+		}
+		if err := checkMatrixPoints(commitments.Points); err != nil {
+			return err
+		}
+	}
+	distributedCA.params = decoded.Params
+	distributedCA.Index = decoded.Index
+	distributedCA.privateMatrixPiece = decoded.Shares
+	distributedCA.backend = nil
+	distributedCA.commitments = commitments
+	return nil
+}
+
+// MarshalText returns the piece armored in PEM
+func (pmPiece PMPiece) MarshalText() ([]byte, error) {
+	data, err := pmPiece.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	headers := map[string]string{"Index": strconv.FormatInt(pmPiece.Index, 10)}
+	return encodePEM(PEMPMPiece, headers, data), nil
+}
+
+// UnmarshalText decodes a piece armored in PEM
+func (pmPiece *PMPiece) UnmarshalText(text []byte) error {
+	data, err := decodePEM(text, PEMPMPiece)
+	if err != nil {
+		return err
+	}
+	return pmPiece.UnmarshalBinary(data)
+}
+
+type pmPieceJSON struct {
+	Index int64               `json:"index"`
+	Piece []base.Ed25519Point `json:"piece"`
+}
+
+func (pmPiece PMPiece) MarshalJSON() ([]byte, error) {
+	if err := checkPoints(pmPiece.Piece, len(pmPiece.Piece)); err != nil {
+		return nil, err
+	}
+	return json.Marshal(pmPieceJSON{Index: pmPiece.Index, Piece: pmPiece.Piece})
+}
+
+func (pmPiece *PMPiece) UnmarshalJSON(data []byte) error {
+	var decoded pmPieceJSON
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+	if err := checkMatrixPoints(decoded.Piece); err != nil {
+		return err
+	}
+	pmPiece.Index = decoded.Index
+	pmPiece.Piece = decoded.Piece
+	return nil
+}
+
+// MarshalText returns the piece armored in PEM
+func (skPiece SKPiece) MarshalText() ([]byte, error) {
+	data, err := skPiece.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	headers := map[string]string{"Index": strconv.FormatInt(skPiece.Index, 10)}
+	return encodePEM(PEMSKPiece, headers, data), nil
+}
+
+// UnmarshalText decodes a piece armored in PEM
+func (skPiece *SKPiece) UnmarshalText(text []byte) error {
+	data, err := decodePEM(text, PEMSKPiece)
+	if err != nil {
+		return err
+	}
+	return skPiece.UnmarshalBinary(data)
+}
+
+type skPieceJSON struct {
+	Index  int64             `json:"index"`
+	Secret base.Ed25519Scala `json:"secret"`
+}
+
+func (skPiece SKPiece) MarshalJSON() ([]byte, error) {
+	return json.Marshal(skPieceJSON{Index: skPiece.Index, Secret: skPiece.Secret})
+}
+
+func (skPiece *SKPiece) UnmarshalJSON(data []byte) error {
+	var decoded skPieceJSON
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+	if decoded.Secret.Scalar == nil {
+		return fmt.Errorf("%w: missing secret", ErrInvalidFormat)
+	}
+	*skPiece = SKPiece(decoded)
+	return nil
+}
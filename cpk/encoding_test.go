@@ -0,0 +1,148 @@
+package cpk
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/require"
+	"github.com/walegarrett/cpk-algs/base"
+	"strings"
+	"testing"
+)
+
+func TestPEM(t *testing.T) {
+	params := Params{Rows: 16, SubsSize: 4, Blocks: 4, Threshold: 2, Nodes: 3}
+	var ca CA
+	require.NoError(t, ca.InitCAWithParams(params, "gen_key"))
+	var client Client
+	require.NoError(t, ca.ExportPublicMatrixForClient(&client))
+	expected, err := ca.QuerySK("alice")
+	require.NoError(t, err)
+
+	text, err := client.MarshalText()
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(string(text), "-----BEGIN CPK PUBLIC MATRIX-----"))
+	require.Contains(t, string(text), client.fingerprint.String())
+	var loaded Client
+	require.NoError(t, loaded.UnmarshalText(text))
+	pk, err := loaded.QueryPK("alice")
+	require.NoError(t, err)
+	require.Equal(t, 1, pk.Equal(expected.Public().Point))
+
+	text, err = ca.MarshalText()
+	require.NoError(t, err)
+	var loadedCA CA
+	require.NoError(t, loadedCA.UnmarshalText(text))
+	// 块类型不同的 PEM 被拒绝
+	require.ErrorIs(t, loaded.UnmarshalText(text), ErrInvalidFormat)
+
+	distributedCAs, err := ca.SplitDistributedCAs()
+	require.NoError(t, err)
+	text, err = distributedCAs[1].MarshalText()
+	require.NoError(t, err)
+	var distributedCA DistributedCA
+	require.NoError(t, distributedCA.UnmarshalText(text))
+	require.NoError(t, distributedCA.VerifyShares())
+
+	pmPiece, err := distributedCA.ExportPublicMatrixPiece()
+	require.NoError(t, err)
+	text, err = pmPiece.MarshalText()
+	require.NoError(t, err)
+	var loadedPMPiece PMPiece
+	require.NoError(t, loadedPMPiece.UnmarshalText(text))
+	require.Equal(t, int64(1), loadedPMPiece.Index)
+
+	skPiece, err := distributedCA.QuerySK("alice")
+	require.NoError(t, err)
+	text, err = skPiece.MarshalText()
+	require.NoError(t, err)
+	var loadedSKPiece SKPiece
+	require.NoError(t, loadedSKPiece.UnmarshalText(text))
+	require.Equal(t, skPiece, loadedSKPiece)
+
+	text, err = EncodePublicKeyPEM(*pk)
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(string(text), "-----BEGIN CPK PUBLIC KEY-----"))
+	decoded, err := DecodePublicKeyPEM(text)
+	require.NoError(t, err)
+	require.Equal(t, 1, decoded.Equal(pk.Point))
+	_, err = DecodePublicKeyPEM([]byte("not pem"))
+	require.ErrorIs(t, err, ErrInvalidFormat)
+}
+
+func TestJSON(t *testing.T) {
+	params := Params{Rows: 16, SubsSize: 4, Blocks: 4, Threshold: 2, Nodes: 3}
+	var ca CA
+	require.NoError(t, ca.InitCAWithParams(params, "gen_key"))
+	var client Client
+	require.NoError(t, ca.ExportPublicMatrixForClient(&client))
+	expected, err := ca.QuerySK("alice")
+	require.NoError(t, err)
+
+	encoded, err := json.Marshal(client)
+	require.NoError(t, err)
+	require.Contains(t, string(encoded), `"params":{"rows":16,"subsSize":4,"blocks":4,"threshold":2,"nodes":3}`)
+	var loaded Client
+	require.NoError(t, json.Unmarshal(encoded, &loaded))
+	pk, err := loaded.QueryPK("alice")
+	require.NoError(t, err)
+	require.Equal(t, 1, pk.Equal(expected.Public().Point))
+	// 指纹与矩阵不一致
+	fingerprintText, err := client.fingerprint.MarshalText()
+	require.NoError(t, err)
+	var swapped Fingerprint
+	swapped[0] = 1
+	swappedText, err := swapped.MarshalText()
+	require.NoError(t, err)
+	other := strings.Replace(string(encoded), string(fingerprintText), string(swappedText), 1)
+	require.ErrorIs(t, json.Unmarshal([]byte(other), &loaded), ErrFingerprintMismatch)
+	var fingerprint Fingerprint
+	require.NoError(t, fingerprint.UnmarshalText([]byte(client.fingerprint.String())))
+	require.Equal(t, client.fingerprint, fingerprint)
+
+	encoded, err = json.Marshal(&ca)
+	require.NoError(t, err)
+	var loadedCA CA
+	require.NoError(t, json.Unmarshal(encoded, &loadedCA))
+	sk, err := loadedCA.QuerySK("alice")
+	require.NoError(t, err)
+	require.Equal(t, 1, sk.Scalar.Equal(expected.Scalar))
+
+	distributedCAs, err := ca.SplitDistributedCAs()
+	require.NoError(t, err)
+	encoded, err = json.Marshal(distributedCAs[2])
+	require.NoError(t, err)
+	var distributedCA DistributedCA
+	require.NoError(t, json.Unmarshal(encoded, &distributedCA))
+	require.Equal(t, int64(2), distributedCA.Index)
+	require.NoError(t, distributedCA.VerifyShares())
+
+	pmPiece, err := distributedCA.ExportPublicMatrixPiece()
+	require.NoError(t, err)
+	skPiece, err := distributedCA.QuerySK("alice")
+	require.NoError(t, err)
+	encoded, err = json.Marshal(struct {
+		PMPieces []PMPiece `json:"pmPieces"`
+		SKPieces []SKPiece `json:"skPieces"`
+	}{[]PMPiece{pmPiece}, []SKPiece{skPiece}})
+	require.NoError(t, err)
+	var pieces struct {
+		PMPieces []PMPiece `json:"pmPieces"`
+		SKPieces []SKPiece `json:"skPieces"`
+	}
+	require.NoError(t, json.Unmarshal(encoded, &pieces))
+	require.Equal(t, skPiece, pieces.SKPieces[0])
+	require.Equal(t, pmPiece.Index, pieces.PMPieces[0].Index)
+	require.Equal(t, 1, pieces.PMPieces[0].Piece[7].Equal(pmPiece.Piece[7].Point))
+
+	identity, err := json.Marshal(base.NewEd25519Point())
+	require.NoError(t, err)
+	require.ErrorIs(t, json.Unmarshal([]byte(`{"index":0,"piece":[`+string(identity)+`]}`), &pmPiece), ErrInvalidPoint)
+
+	root := base.RandomPrivateKey()
+	manifest, err := ca.ExportManifest(&root, 3)
+	require.NoError(t, err)
+	encoded, err = json.Marshal(manifest)
+	require.NoError(t, err)
+	var decodedManifest Manifest
+	require.NoError(t, json.Unmarshal(encoded, &decodedManifest))
+	require.NoError(t, decodedManifest.Check(root.Public(), client.QueryPublicKeyMatrix()))
+}
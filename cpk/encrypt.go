@@ -0,0 +1,161 @@
+package cpk
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/walegarrett/cpk-algs/base"
+	"golang.org/x/crypto/blake2b"
+)
+
+// 身份加密的密文格式
+// magic(4) | version(int32) | fingerprint(32) | domain | ident | sent(32) | secretbox(nonce | box)
+// 密钥由密钥交换结果、整个头部、接收者公钥与关联数据派生，篡改头部或关联数据都会导致解密失败
+const (
+	ciphertextMagic = "CPKE"
+	// CiphertextVersion is the version of the ciphertext written by Encrypt
+	CiphertextVersion = 1
+	// 身份加密密钥派生的域标签
+	encryptTag = "cpk-encrypt-v1"
+	// 密钥交换发送的临时公钥长度
+	sentSize = 32
+)
+
+// Recipient describes the recipient a ciphertext was encrypted to
+type Recipient struct {
+	// 加密时使用的矩阵版本
+	Fingerprint Fingerprint
+	Domain      Domain
+	Ident       string
+}
+
+// serializeHeader writes the header of a ciphertext
+func (recipient *Recipient) serializeHeader(serializer *base.Serializer, sent []byte) {
+	serializer.WriteBytes([]byte(ciphertextMagic))
+	serializer.WriteInt32(CiphertextVersion)
+	serializer.WriteBytes(recipient.Fingerprint[:])
+	serializer.WriteString(recipient.Domain.Namespace)
+	serializer.WriteInt32(recipient.Domain.Version)
+	serializer.WriteString(recipient.Ident)
+	serializer.WriteBytes(sent)
+}
+
+// readHeader reads the header of a ciphertext and returns the recipient, the sent point and the box
+func readHeader(ciphertext []byte) (recipient Recipient, sent []byte, box []byte, err error) {
+	if !bytes.HasPrefix(ciphertext, []byte(ciphertextMagic)) {
+		err = fmt.Errorf("%w: bad magic", ErrInvalidFormat)
+		return
+	}
+	deserializer, err := base.NewDeserializer(ciphertext[len(ciphertextMagic):])
+	if err != nil {
+		return
+	}
+	var version int32
+	if _, err = deserializer.ReadInt32(&version); err != nil {
+		err = fmt.Errorf("%w: %v", ErrInvalidFormat, err)
+		return
+	}
+	if version != CiphertextVersion {
+		err = fmt.Errorf("%w: unsupported ciphertext version %d", ErrInvalidFormat, version)
+		return
+	}
+	if _, err = deserializer.ReadBytes(recipient.Fingerprint[:], uint64(len(recipient.Fingerprint))); err != nil {
+		err = fmt.Errorf("%w: %v", ErrInvalidFormat, err)
+		return
+	}
+	if _, err = deserializer.ReadString(&recipient.Domain.Namespace); err != nil {
+		err = fmt.Errorf("%w: %v", ErrInvalidFormat, err)
+		return
+	}
+	if _, err = deserializer.ReadInt32(&recipient.Domain.Version); err != nil {
+		err = fmt.Errorf("%w: %v", ErrInvalidFormat, err)
+		return
+	}
+	if err = recipient.Domain.Validate(); err != nil {
+		return
+	}
+	if _, err = deserializer.ReadString(&recipient.Ident); err != nil {
+		err = fmt.Errorf("%w: %v", ErrInvalidFormat, err)
+		return
+	}
+	sent = make([]byte, sentSize)
+	if _, err = deserializer.ReadBytes(sent, sentSize); err != nil {
+		err = fmt.Errorf("%w: %v", ErrInvalidFormat, err)
+		return
+	}
+	box = ciphertext[len(ciphertext)-int(deserializer.Remaining()):]
+	return
+}
+
+// encryptKey derives the secretbox key bound to the header, the recipient's key and the associated data
+func encryptKey(kx [64]byte, header []byte, recipientKey *base.PublicKey, aad []byte) (key base.Cipher, err error) {
+	hash, err := blake2b.New256(kx[:])
+	if err != nil {
+		return
+	}
+	var serializer base.Serializer
+	serializer.WriteString(encryptTag)
+	serializer.WriteBytesWithLength(header)
+	serializer.WriteBytesWithLength(recipientKey.Bytes())
+	serializer.WriteBytesWithLength(aad)
+	hash.Write(serializer)
+	copy(key[:], hash.Sum(nil))
+	return
+}
+
+// Encrypt encrypts the plaintext to the identity under the primary matrix of the client, the
+// associated data is authenticated but not included in the ciphertext
+func Encrypt(client *Client, ident string, plaintext, aad []byte) ([]byte, error) {
+	publicKey, err := client.QueryPK(ident)
+	if err != nil {
+		return nil, err
+	}
+	fingerprint, err := client.Fingerprint()
+	if err != nil {
+		return nil, err
+	}
+	sent, kx, err := publicKey.KxSend()
+	if err != nil {
+		return nil, ErrInvalidPoint
+	}
+	recipient := Recipient{Fingerprint: fingerprint, Domain: client.Domain(), Ident: ident}
+	var serializer base.Serializer
+	recipient.serializeHeader(&serializer, sent)
+	key, err := encryptKey(kx, serializer, publicKey, aad)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(serializer), key.Cipher(plaintext)...), nil
+}
+
+// ReadRecipient returns the recipient of the ciphertext without decrypting it, so that the
+// recipient can pick the private key of the identity and the matrix version
+func ReadRecipient(ciphertext []byte) (Recipient, error) {
+	recipient, _, _, err := readHeader(ciphertext)
+	return recipient, err
+}
+
+// Decrypt decrypts a ciphertext of Encrypt with the recipient's private key and the same
+// associated data
+func Decrypt(priv *base.PrivateKey, ciphertext, aad []byte) ([]byte, error) {
+	if priv == nil || priv.Scalar == nil {
+		return nil, ErrDecryptFailed
+	}
+	_, sent, box, err := readHeader(ciphertext)
+	if err != nil {
+		return nil, err
+	}
+	kx, err := priv.KxReceive(sent)
+	if err != nil {
+		return nil, ErrDecryptFailed
+	}
+	publicKey := priv.Public()
+	key, err := encryptKey(kx, ciphertext[:len(ciphertext)-len(box)], &publicKey, aad)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := key.Decipher(box)
+	if err != nil {
+		return nil, ErrDecryptFailed
+	}
+	return plaintext, nil
+}
@@ -0,0 +1,119 @@
+package cpk
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestEncrypt(t *testing.T) {
+	params := Params{Rows: 16, SubsSize: 4, Blocks: 4, Threshold: 2, Nodes: 3}
+	var ca CA
+	require.NoError(t, ca.InitCAWithParams(params, "gen_key"))
+	client := Client{}
+	require.NoError(t, ca.ExportPublicMatrixForClient(&client))
+	alice, err := ca.QuerySK("alice")
+	require.NoError(t, err)
+	bob, err := ca.QuerySK("bob")
+	require.NoError(t, err)
+
+	plaintext := []byte("hello alice")
+	aad := []byte("mail-id:42")
+	ciphertext, err := Encrypt(&client, "alice", plaintext, aad)
+	require.NoError(t, err)
+	decrypted, err := Decrypt(&alice, ciphertext, aad)
+	require.NoError(t, err)
+	require.Equal(t, plaintext, decrypted)
+	// 每次加密使用新的临时密钥
+	again, err := Encrypt(&client, "alice", plaintext, aad)
+	require.NoError(t, err)
+	require.NotEqual(t, ciphertext, again)
+	empty, err := Encrypt(&client, "alice", nil, nil)
+	require.NoError(t, err)
+	decrypted, err = Decrypt(&alice, empty, nil)
+	require.NoError(t, err)
+	require.Empty(t, decrypted)
+
+	fingerprint, err := client.Fingerprint()
+	require.NoError(t, err)
+	recipient, err := ReadRecipient(ciphertext)
+	require.NoError(t, err)
+	require.Equal(t, Recipient{Fingerprint: fingerprint, Ident: "alice"}, recipient)
+
+	_, err = Decrypt(&bob, ciphertext, aad)
+	require.ErrorIs(t, err, ErrDecryptFailed)
+	_, err = Decrypt(&alice, ciphertext, []byte("mail-id:43"))
+	require.ErrorIs(t, err, ErrDecryptFailed)
+	_, err = Decrypt(&alice, ciphertext, nil)
+	require.ErrorIs(t, err, ErrDecryptFailed)
+	_, err = Decrypt(nil, ciphertext, aad)
+	require.ErrorIs(t, err, ErrDecryptFailed)
+
+	// 头部的每个字节都参与密钥派生
+	headerSize := len(ciphertextMagic) + 4 + len(fingerprint) + 8 + 4 + 8 + len("alice") + sentSize
+	for i := 0; i < headerSize; i++ {
+		tampered := append([]byte(nil), ciphertext...)
+		tampered[i] ^= 1
+		_, err = Decrypt(&alice, tampered, aad)
+		require.Error(t, err, "byte %d", i)
+	}
+	_, err = Decrypt(&alice, ciphertext[:headerSize+10], aad)
+	require.ErrorIs(t, err, ErrDecryptFailed)
+	_, err = Decrypt(&alice, ciphertext[:headerSize-1], aad)
+	require.ErrorIs(t, err, ErrInvalidFormat)
+	unsupported := append([]byte(nil), ciphertext...)
+	unsupported[len(ciphertextMagic)] = 2
+	_, err = ReadRecipient(unsupported)
+	require.ErrorIs(t, err, ErrInvalidFormat)
+
+	_, err = Encrypt(&Client{params: params}, "alice", plaintext, aad)
+	require.ErrorIs(t, err, ErrMatrixNotLoaded)
+}
+
+func TestEncrypt_DomainAndVersion(t *testing.T) {
+	params := Params{Rows: 16, SubsSize: 4, Blocks: 4, Threshold: 2, Nodes: 3}
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var oldCA, newCA CA
+	require.NoError(t, oldCA.InitCAWithParams(params, "old_key"))
+	require.NoError(t, newCA.InitCAWithParams(params, "new_key"))
+	var rotating RotatingCA
+	oldVersion, err := rotating.AddVersion(&oldCA, MatrixWindow{NotBefore: start, NotAfter: start.AddDate(0, 0, 20)})
+	require.NoError(t, err)
+	newVersion, err := rotating.AddVersion(&newCA, MatrixWindow{NotBefore: start.AddDate(0, 0, 10)})
+	require.NoError(t, err)
+	client, err := rotating.ExportClient()
+	require.NoError(t, err)
+
+	// 发送方加密到主版本，接收方按密文中的版本与域挑选私钥
+	domain := Domain{Namespace: "mail", Version: 1}
+	mailClient, err := client.WithDomain(domain)
+	require.NoError(t, err)
+	ciphertext, err := Encrypt(mailClient, "alice", []byte("hello"), nil)
+	require.NoError(t, err)
+	recipient, err := ReadRecipient(ciphertext)
+	require.NoError(t, err)
+	require.Equal(t, domain, recipient.Domain)
+	fingerprint, err := mailClient.Fingerprint()
+	require.NoError(t, err)
+	require.Equal(t, fingerprint, recipient.Fingerprint)
+
+	cas := map[Fingerprint]*CA{oldVersion: &oldCA, newVersion: &newCA}
+	for version, ca := range cas {
+		mailCA, err := ca.WithDomain(recipient.Domain)
+		require.NoError(t, err)
+		key, err := mailCA.QuerySK(recipient.Ident)
+		require.NoError(t, err)
+		decrypted, err := Decrypt(&key, ciphertext, nil)
+		if version != recipient.Fingerprint {
+			require.ErrorIs(t, err, ErrDecryptFailed)
+			continue
+		}
+		require.NoError(t, err)
+		require.Equal(t, []byte("hello"), decrypted)
+		// 域外的同名身份无法解密
+		key, err = ca.QuerySK(recipient.Ident)
+		require.NoError(t, err)
+		_, err = Decrypt(&key, ciphertext, nil)
+		require.ErrorIs(t, err, ErrDecryptFailed)
+	}
+}
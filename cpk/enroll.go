@@ -0,0 +1,169 @@
+package cpk
+
+import (
+	"github.com/walegarrett/cpk-algs/base"
+	"golang.org/x/crypto/blake2b"
+)
+
+// 密钥分片加密的域标签
+const sealSKTag = "cpk-seal-sk-v1"
+
+// SealedSKPiece defines a private key Piece encrypted to the user's ephemeral enrollment key
+type SealedSKPiece struct {
+	// Index of sk Piece
+	Index int64
+	// 节点密钥交换发送的临时公钥
+	Sent []byte
+	// 加密后的 SKPiece
+	Box []byte
+}
+
+func (sealed *SealedSKPiece) Serialize(serializer *base.Serializer) {
+	serializer.WriteInt64(sealed.Index)
+	serializer.WriteBytesWithLength(sealed.Sent)
+	serializer.WriteBytesWithLength(sealed.Box)
+}
+
+func (sealed *SealedSKPiece) DeSerialize(deserializer *base.DeSerializer) error {
+	_, err := deserializer.ReadInt64(&(sealed.Index))
+	if err != nil {
+		return err
+	}
+	_, err = deserializer.ReadBytesWithLength(&(sealed.Sent))
+	if err != nil {
+		return err
+	}
+	_, err = deserializer.ReadBytesWithLength(&(sealed.Box))
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// sealKey derives the secretbox key bound to the identity and the node index
+func sealKey(kx [64]byte, sent []byte, enrollKey *base.PublicKey, ident []byte, index int64) (key base.Cipher, err error) {
+	hash, err := blake2b.New256(kx[:])
+	if err != nil {
+		return
+	}
+	var serializer base.Serializer
+	serializer.WriteString(sealSKTag)
+	serializer.WriteBytesWithLength(ident)
+	serializer.WriteInt64(index)
+	serializer.WriteBytesWithLength(sent)
+	serializer.WriteBytesWithLength(enrollKey.Bytes())
+	hash.Write(serializer)
+	copy(key[:], hash.Sum(nil))
+	return
+}
+
+// SealSK returns the private key piece of the user encrypted to the enrollment key
+func (distributedCA *DistributedCA) SealSK(ident string, enrollKey base.PublicKey) (SealedSKPiece, error) {
+	encoded, err := distributedCA.domain.plainIdent(ident)
+	if err != nil {
+		return SealedSKPiece{}, err
+	}
+	return distributedCA.sealSK(encoded, enrollKey)
+}
+
+// SealSKAt returns the private key piece of the user's epoch key encrypted to the enrollment key
+func (distributedCA *DistributedCA) SealSKAt(ident string, epoch Epoch, enrollKey base.PublicKey) (SealedSKPiece, error) {
+	encoded, err := epoch.encodeIdent(ident)
+	if err != nil {
+		return SealedSKPiece{}, err
+	}
+	return distributedCA.sealSK(encoded, enrollKey)
+}
+
+func (distributedCA *DistributedCA) sealSK(ident []byte, enrollKey base.PublicKey) (SealedSKPiece, error) {
+	var sealed SealedSKPiece
+	if enrollKey.Point == nil {
+		return sealed, ErrInvalidEnrollKey
+	}
+	skPiece, err := distributedCA.querySK(ident)
+	if err != nil {
+		return sealed, err
+	}
+	sent, kx, err := enrollKey.KxSend()
+	if err != nil {
+		return sealed, ErrInvalidEnrollKey
+	}
+	key, err := sealKey(kx, sent, &enrollKey, ident, skPiece.Index)
+	if err != nil {
+		return sealed, err
+	}
+	var serializer base.Serializer
+	skPiece.Serialize(&serializer)
+	sealed.Index = skPiece.Index
+	sealed.Sent = sent
+	sealed.Box = key.Cipher(serializer)
+	return sealed, nil
+}
+
+// OpenSKPieces decrypts the sealed private key pieces with the ephemeral enrollment key
+func OpenSKPieces(ident string, enrollKey *base.PrivateKey, sealedPieces []SealedSKPiece) ([]SKPiece, error) {
+	return openSKPieces([]byte(ident), enrollKey, sealedPieces)
+}
+
+func openSKPieces(ident []byte, enrollKey *base.PrivateKey, sealedPieces []SealedSKPiece) ([]SKPiece, error) {
+	if enrollKey == nil || enrollKey.Scalar == nil {
+		return nil, ErrInvalidEnrollKey
+	}
+	publicKey := enrollKey.Public()
+	skPieces := make([]SKPiece, 0, len(sealedPieces))
+	for _, sealed := range sealedPieces {
+		kx, err := enrollKey.KxReceive(sealed.Sent)
+		if err != nil {
+			return nil, &ErrOpenSealedPiece{Index: sealed.Index}
+		}
+		key, err := sealKey(kx, sealed.Sent, &publicKey, ident, sealed.Index)
+		if err != nil {
+			return nil, err
+		}
+		message, err := key.Decipher(sealed.Box)
+		if err != nil {
+			return nil, &ErrOpenSealedPiece{Index: sealed.Index}
+		}
+		deserializer, err := base.NewDeserializer(message)
+		if err != nil {
+			return nil, &ErrOpenSealedPiece{Index: sealed.Index}
+		}
+		var skPiece SKPiece
+		err = skPiece.DeSerialize(deserializer)
+		if err != nil || skPiece.Index != sealed.Index {
+			return nil, &ErrOpenSealedPiece{Index: sealed.Index}
+		}
+		skPieces = append(skPieces, skPiece)
+	}
+	return skPieces, nil
+}
+
+// OpenAndCombineSKPieces decrypts the sealed pieces and combines them into the user's private key
+func (client *Client) OpenAndCombineSKPieces(ident string, enrollKey *base.PrivateKey, sealedPieces []SealedSKPiece) (base.PrivateKey, error) {
+	publicKey, err := client.QueryPK(ident)
+	if err != nil {
+		return base.PrivateKey{}, err
+	}
+	skPieces, err := OpenSKPieces(ident, enrollKey, sealedPieces)
+	if err != nil {
+		return base.PrivateKey{}, err
+	}
+	return client.CombineSKPieces(skPieces, *publicKey)
+}
+
+// OpenAndCombineSKPiecesAt decrypts the sealed pieces and combines them into the user's epoch key
+func (client *Client) OpenAndCombineSKPiecesAt(ident string, epoch Epoch, enrollKey *base.PrivateKey, sealedPieces []SealedSKPiece) (base.PrivateKey, error) {
+	encoded, err := epoch.encodeIdent(ident)
+	if err != nil {
+		return base.PrivateKey{}, err
+	}
+	publicKey, err := client.queryPK(encoded)
+	if err != nil {
+		return base.PrivateKey{}, err
+	}
+	skPieces, err := openSKPieces(encoded, enrollKey, sealedPieces)
+	if err != nil {
+		return base.PrivateKey{}, err
+	}
+	return client.CombineSKPieces(skPieces, *publicKey)
+}
@@ -0,0 +1,86 @@
+package cpk
+
+import (
+	"github.com/stretchr/testify/require"
+	"github.com/walegarrett/cpk-algs/base"
+	"testing"
+)
+
+func TestSealedSKPiece_Serialize(t *testing.T) {
+	sealed := SealedSKPiece{Index: 3, Sent: []byte("sent"), Box: []byte("box")}
+	var serializer base.Serializer
+	sealed.Serialize(&serializer)
+	deserializer, err := base.NewDeserializer(serializer)
+	require.NoError(t, err)
+	var sealed2 SealedSKPiece
+	require.NoError(t, sealed2.DeSerialize(deserializer))
+	require.Equal(t, sealed, sealed2)
+}
+
+func TestClient_OpenAndCombineSKPieces(t *testing.T) {
+	var ca CA
+	require.NoError(t, ca.InitCA("genkey1"))
+	distributedCAs, err := ca.SplitDistributedCAs()
+	require.NoError(t, err)
+	client := Client{}
+	require.NoError(t, ca.ExportPublicMatrixForClient(&client))
+
+	enrollKey := base.RandomPrivateKey()
+	var sealedPieces []SealedSKPiece
+	for i := range distributedCAs[1:3] {
+		sealed, err := distributedCAs[i+1].SealSK("alice", enrollKey.Public())
+		require.NoError(t, err)
+		sealedPieces = append(sealedPieces, sealed)
+	}
+	priv, err := client.OpenAndCombineSKPieces("alice", &enrollKey, sealedPieces)
+	require.NoError(t, err)
+	sk, err := ca.QuerySK("alice")
+	require.NoError(t, err)
+	require.Equal(t, 1, priv.Scalar.Equal(sk.Scalar))
+
+	// 密文绑定了身份、节点序号与接收方的临时密钥
+	_, err = client.OpenAndCombineSKPieces("bob", &enrollKey, sealedPieces)
+	var openErr *ErrOpenSealedPiece
+	require.ErrorAs(t, err, &openErr)
+	require.Equal(t, int64(1), openErr.Index)
+
+	otherKey := base.RandomPrivateKey()
+	_, err = client.OpenAndCombineSKPieces("alice", &otherKey, sealedPieces)
+	require.ErrorAs(t, err, &openErr)
+
+	swapped := sealedPieces[1]
+	swapped.Index = 0
+	_, err = client.OpenAndCombineSKPieces("alice", &enrollKey, []SealedSKPiece{sealedPieces[0], swapped})
+	require.ErrorAs(t, err, &openErr)
+	require.Equal(t, int64(0), openErr.Index)
+
+	_, err = distributedCAs[0].SealSK("alice", base.PublicKey{})
+	require.ErrorIs(t, err, ErrInvalidEnrollKey)
+}
+
+func TestClient_OpenAndCombineSKPiecesAt(t *testing.T) {
+	var ca CA
+	require.NoError(t, ca.InitCA("genkey1"))
+	distributedCAs, err := ca.SplitDistributedCAs()
+	require.NoError(t, err)
+	client := Client{}
+	require.NoError(t, ca.ExportPublicMatrixForClient(&client))
+
+	epoch := Epoch{Granularity: EpochMonth, Number: 650}
+	enrollKey := base.RandomPrivateKey()
+	var sealedPieces []SealedSKPiece
+	for i := range distributedCAs {
+		sealed, err := distributedCAs[i].SealSKAt("alice", epoch, enrollKey.Public())
+		require.NoError(t, err)
+		sealedPieces = append(sealedPieces, sealed)
+	}
+	priv, err := client.OpenAndCombineSKPiecesAt("alice", epoch, &enrollKey, sealedPieces)
+	require.NoError(t, err)
+	sk, err := ca.QuerySKAt("alice", epoch)
+	require.NoError(t, err)
+	require.Equal(t, 1, priv.Scalar.Equal(sk.Scalar))
+
+	_, err = client.OpenAndCombineSKPiecesAt("alice", epoch.Next(), &enrollKey, sealedPieces)
+	var openErr *ErrOpenSealedPiece
+	require.ErrorAs(t, err, &openErr)
+}
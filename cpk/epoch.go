@@ -0,0 +1,220 @@
+package cpk
+
+import (
+	"fmt"
+	"github.com/walegarrett/cpk-algs/base"
+	"time"
+)
+
+// EpochGranularity defines the length of the validity period of an identity key
+type EpochGranularity int32
+
+const (
+	EpochDay EpochGranularity = iota + 1
+	EpochWeek
+	EpochMonth
+)
+
+const (
+	// 身份与周期编码的域标签
+	epochIdentTag = "cpk-epoch-ident-v1"
+	secondsPerDay = 24 * 60 * 60
+	// 1970-01-01 是星期四，按周划分时以星期一作为一周的开始
+	weekDayOffset = 3
+)
+
+func (granularity EpochGranularity) String() string {
+	switch granularity {
+	case EpochDay:
+		return "day"
+	case EpochWeek:
+		return "week"
+	case EpochMonth:
+		return "month"
+	}
+	return fmt.Sprintf("EpochGranularity(%d)", int32(granularity))
+}
+
+func (granularity EpochGranularity) valid() bool {
+	return granularity >= EpochDay && granularity <= EpochMonth
+}
+
+// Epoch identifies one validity period, Number counts the periods since 1970-01 in UTC
+type Epoch struct {
+	Granularity EpochGranularity
+	Number      int64
+}
+
+// EpochAt returns the epoch of the given granularity containing t
+func EpochAt(t time.Time, granularity EpochGranularity) (Epoch, error) {
+	t = t.UTC()
+	epoch := Epoch{Granularity: granularity}
+	switch granularity {
+	case EpochDay:
+		epoch.Number = floorDiv(t.Unix(), secondsPerDay)
+	case EpochWeek:
+		epoch.Number = floorDiv(floorDiv(t.Unix(), secondsPerDay)+weekDayOffset, 7)
+	case EpochMonth:
+		epoch.Number = int64(t.Year()-1970)*12 + int64(t.Month()-1)
+	default:
+		return epoch, ErrInvalidEpoch
+	}
+	return epoch, nil
+}
+
+func floorDiv(a, b int64) int64 {
+	q := a / b
+	if a%b != 0 && (a < 0) != (b < 0) {
+		q--
+	}
+	return q
+}
+
+// Start returns the first instant of the epoch
+func (epoch Epoch) Start() time.Time {
+	switch epoch.Granularity {
+	case EpochDay:
+		return time.Unix(epoch.Number*secondsPerDay, 0).UTC()
+	case EpochWeek:
+		return time.Unix((epoch.Number*7-weekDayOffset)*secondsPerDay, 0).UTC()
+	case EpochMonth:
+		year := floorDiv(epoch.Number, 12)
+		month := epoch.Number - year*12
+		return time.Date(1970+int(year), time.Month(month+1), 1, 0, 0, 0, 0, time.UTC)
+	}
+	return time.Time{}
+}
+
+// End returns the first instant after the epoch
+func (epoch Epoch) End() time.Time {
+	return epoch.Next().Start()
+}
+
+// Next returns the epoch following this one
+func (epoch Epoch) Next() Epoch {
+	return Epoch{Granularity: epoch.Granularity, Number: epoch.Number + 1}
+}
+
+// Prev returns the epoch preceding this one
+func (epoch Epoch) Prev() Epoch {
+	return Epoch{Granularity: epoch.Granularity, Number: epoch.Number - 1}
+}
+
+func (epoch Epoch) String() string {
+	return fmt.Sprintf("%s:%d", epoch.Granularity, epoch.Number)
+}
+
+// encodeIdent returns the canonical encoding of (ident, epoch) fed into the matrix mapping
+func (epoch Epoch) encodeIdent(ident string) ([]byte, error) {
+	if !epoch.Granularity.valid() {
+		return nil, ErrInvalidEpoch
+	}
+	var serializer base.Serializer
+	serializer.WriteString(epochIdentTag)
+	serializer.WriteString(ident)
+	serializer.WriteInt32(int32(epoch.Granularity))
+	serializer.WriteInt64(epoch.Number)
+	return serializer, nil
+}
+
+// EpochPolicy configures the epoch granularity and the accepted clock skew of verifiers
+type EpochPolicy struct {
+	Granularity EpochGranularity
+	// 验证时允许的时钟偏差
+	Skew time.Duration
+}
+
+// EpochsAround returns the epochs overlapping [t-Skew, t+Skew], the epoch containing t first
+func (policy EpochPolicy) EpochsAround(t time.Time) ([]Epoch, error) {
+	current, err := EpochAt(t, policy.Granularity)
+	if err != nil {
+		return nil, err
+	}
+	first, err := EpochAt(t.Add(-policy.Skew), policy.Granularity)
+	if err != nil {
+		return nil, err
+	}
+	last, err := EpochAt(t.Add(policy.Skew), policy.Granularity)
+	if err != nil {
+		return nil, err
+	}
+	epochs := []Epoch{current}
+	for epoch := first; epoch.Number <= last.Number; epoch = epoch.Next() {
+		if epoch != current {
+			epochs = append(epochs, epoch)
+		}
+	}
+	return epochs, nil
+}
+
+// EpochPublicKey is the public key of an identity in one epoch
+type EpochPublicKey struct {
+	Epoch     Epoch
+	PublicKey *base.PublicKey
+}
+
+// QuerySKAt query the user's private key valid in the epoch
+func (ca *CA) QuerySKAt(ident string, epoch Epoch) (base.PrivateKey, error) {
+	encoded, err := epoch.encodeIdent(ident)
+	if err != nil {
+		return base.PrivateKey{}, err
+	}
+	return ca.querySK(encoded)
+}
+
+// QuerySKAt returns the private key piece of the user's key valid in the epoch
+func (distributedCA *DistributedCA) QuerySKAt(ident string, epoch Epoch) (SKPiece, error) {
+	encoded, err := epoch.encodeIdent(ident)
+	if err != nil {
+		return SKPiece{}, err
+	}
+	return distributedCA.querySK(encoded)
+}
+
+// QueryPKAt returns the user's public key valid in the epoch
+func (client *Client) QueryPKAt(ident string, epoch Epoch) (*base.PublicKey, error) {
+	encoded, err := epoch.encodeIdent(ident)
+	if err != nil {
+		return nil, err
+	}
+	return client.queryPK(encoded)
+}
+
+// QueryPKWindow returns the user's public keys of the previous, current and next epoch around t
+func (client *Client) QueryPKWindow(ident string, t time.Time, granularity EpochGranularity) ([]EpochPublicKey, error) {
+	current, err := EpochAt(t, granularity)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]EpochPublicKey, 0, 3)
+	for _, epoch := range []Epoch{current.Prev(), current, current.Next()} {
+		publicKey, err := client.QueryPKAt(ident, epoch)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, EpochPublicKey{Epoch: epoch, PublicKey: publicKey})
+	}
+	return keys, nil
+}
+
+// VerifyAt verifies a signature made with an epoch key of the user, accepting every
+// epoch within the clock skew of the policy around t, and returns the matched epoch
+func (client *Client) VerifyAt(ident string, m []byte, sig *base.Signature, t time.Time, policy EpochPolicy) (Epoch, error) {
+	if sig == nil {
+		return Epoch{}, ErrInvalidSignature
+	}
+	epochs, err := policy.EpochsAround(t)
+	if err != nil {
+		return Epoch{}, err
+	}
+	for _, epoch := range epochs {
+		publicKey, err := client.QueryPKAt(ident, epoch)
+		if err != nil {
+			return Epoch{}, err
+		}
+		if publicKey.Verify(m, sig) {
+			return epoch, nil
+		}
+	}
+	return Epoch{}, ErrInvalidSignature
+}
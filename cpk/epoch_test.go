@@ -0,0 +1,138 @@
+package cpk
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestEpochAt(t *testing.T) {
+	// 2024-02-29 12:00 UTC 是星期四
+	now := time.Date(2024, 2, 29, 12, 0, 0, 0, time.UTC)
+	for _, c := range []struct {
+		granularity EpochGranularity
+		start       time.Time
+		end         time.Time
+	}{
+		{EpochDay, time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC), time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{EpochWeek, time.Date(2024, 2, 26, 0, 0, 0, 0, time.UTC), time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC)},
+		{EpochMonth, time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC), time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)},
+	} {
+		epoch, err := EpochAt(now, c.granularity)
+		require.NoError(t, err)
+		require.Equal(t, c.start, epoch.Start(), c.granularity.String())
+		require.Equal(t, c.end, epoch.End(), c.granularity.String())
+		again, err := EpochAt(epoch.Start(), c.granularity)
+		require.NoError(t, err)
+		require.Equal(t, epoch, again)
+		require.Equal(t, epoch.Prev().End(), epoch.Start())
+	}
+
+	before, err := EpochAt(time.Date(1969, 12, 31, 23, 0, 0, 0, time.UTC), EpochDay)
+	require.NoError(t, err)
+	require.Equal(t, int64(-1), before.Number)
+	_, err = EpochAt(now, EpochGranularity(9))
+	require.ErrorIs(t, err, ErrInvalidEpoch)
+}
+
+func TestEpochPolicy_EpochsAround(t *testing.T) {
+	policy := EpochPolicy{Granularity: EpochDay, Skew: 10 * time.Minute}
+	epochs, err := policy.EpochsAround(time.Date(2024, 2, 29, 12, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	require.Len(t, epochs, 1)
+
+	epochs, err = policy.EpochsAround(time.Date(2024, 2, 29, 0, 5, 0, 0, time.UTC))
+	require.NoError(t, err)
+	require.Len(t, epochs, 2)
+	require.Equal(t, epochs[0].Prev(), epochs[1])
+}
+
+func TestClient_QueryPKAt(t *testing.T) {
+	var ca CA
+	require.NoError(t, ca.InitCA("genkey1"))
+	client := Client{}
+	require.NoError(t, ca.ExportPublicMatrixForClient(&client))
+
+	now := time.Date(2024, 2, 29, 23, 58, 0, 0, time.UTC)
+	keys, err := client.QueryPKWindow("alice", now, EpochDay)
+	require.NoError(t, err)
+	require.Len(t, keys, 3)
+	require.Equal(t, keys[1].Epoch.Prev(), keys[0].Epoch)
+	require.Equal(t, keys[1].Epoch.Next(), keys[2].Epoch)
+	for _, key := range keys {
+		sk, err := ca.QuerySKAt("alice", key.Epoch)
+		require.NoError(t, err)
+		require.Equal(t, 1, key.PublicKey.Equal(sk.Public().Point))
+	}
+	// 不同周期、不同周期粒度以及不带周期的密钥互不相同
+	require.Equal(t, 0, keys[0].PublicKey.Equal(keys[1].PublicKey.Point))
+	plain, err := client.QueryPK("alice")
+	require.NoError(t, err)
+	require.Equal(t, 0, plain.Equal(keys[1].PublicKey.Point))
+	month, err := client.QueryPKAt("alice", Epoch{Granularity: EpochMonth, Number: keys[1].Epoch.Number})
+	require.NoError(t, err)
+	require.Equal(t, 0, month.Equal(keys[1].PublicKey.Point))
+
+	// 使用当天的密钥签名，在跨天的时钟偏差内仍可验证
+	sk, err := ca.QuerySKAt("alice", keys[1].Epoch)
+	require.NoError(t, err)
+	sig := sk.Sign([]byte("message"))
+	policy := EpochPolicy{Granularity: EpochDay, Skew: 5 * time.Minute}
+	epoch, err := client.VerifyAt("alice", []byte("message"), sig, now, policy)
+	require.NoError(t, err)
+	require.Equal(t, keys[1].Epoch, epoch)
+	epoch, err = client.VerifyAt("alice", []byte("message"), sig, now.Add(4*time.Minute), policy)
+	require.NoError(t, err)
+	require.Equal(t, keys[1].Epoch, epoch)
+	_, err = client.VerifyAt("alice", []byte("message"), sig, now.Add(10*time.Minute), policy)
+	require.ErrorIs(t, err, ErrInvalidSignature)
+	_, err = client.VerifyAt("bob", []byte("message"), sig, now, policy)
+	require.ErrorIs(t, err, ErrInvalidSignature)
+}
+
+func TestEpoch_ReservedIdent(t *testing.T) {
+	var ca CA
+	require.NoError(t, ca.InitCA("genkey1"))
+	client := Client{}
+	require.NoError(t, ca.ExportPublicMatrixForClient(&client))
+	epoch := Epoch{Granularity: EpochDay, Number: 19782}
+
+	// 等于周期编码的普通身份会得到 alice 当天的私钥，在任何域中都必须拒绝
+	encoded, err := epoch.encodeIdent("alice")
+	require.NoError(t, err)
+	_, err = ca.QuerySK(string(encoded))
+	require.ErrorIs(t, err, ErrReservedIdent)
+	_, err = client.QueryPK(string(encoded))
+	require.ErrorIs(t, err, ErrReservedIdent)
+	mailCA, err := ca.WithDomain(Domain{Namespace: "mail", Version: 1})
+	require.NoError(t, err)
+	_, err = mailCA.QuerySK(string(encoded))
+	require.ErrorIs(t, err, ErrReservedIdent)
+
+	// 周期身份本身不受影响
+	sk, err := ca.QuerySKAt("alice", epoch)
+	require.NoError(t, err)
+	pk, err := client.QueryPKAt("alice", epoch)
+	require.NoError(t, err)
+	require.Equal(t, 1, pk.Equal(sk.Public().Point))
+}
+
+func TestDistributedCA_QuerySKAt(t *testing.T) {
+	var ca CA
+	require.NoError(t, ca.InitCA("genkey1"))
+	distributedCAs, err := ca.SplitDistributedCAs()
+	require.NoError(t, err)
+	epoch := Epoch{Granularity: EpochWeek, Number: 2800}
+	var skPieces []SKPiece
+	for i := range distributedCAs[:2] {
+		skPiece, err := distributedCAs[i].QuerySKAt("alice", epoch)
+		require.NoError(t, err)
+		skPieces = append(skPieces, skPiece)
+	}
+	client := Client{}
+	require.NoError(t, ca.ExportPublicMatrixForClient(&client))
+	pk, err := client.QueryPKAt("alice", epoch)
+	require.NoError(t, err)
+	_, err = client.CombineSKPieces(skPieces, *pk)
+	require.NoError(t, err)
+}
@@ -0,0 +1,116 @@
+package cpk
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrInvalidParams is wrapped by every error describing a bad matrix layout
+	ErrInvalidParams = errors.New("cpk: invalid params")
+	// ErrInsufficientPieces is returned when fewer than Threshold distinct pieces are given
+	ErrInsufficientPieces = errors.New("cpk: pieces not enough")
+	// ErrMatrixNotLoaded is returned when the matrix of a CA, DistributedCA or Client is empty
+	ErrMatrixNotLoaded = errors.New("cpk: matrix not loaded")
+	// ErrCommitmentsNotLoaded is returned when a DistributedCA holds no Feldman commitments
+	ErrCommitmentsNotLoaded = errors.New("cpk: commitments not loaded")
+	// ErrKeyMismatch is returned when the combined private key does not match the public key
+	ErrKeyMismatch = errors.New("cpk: combined private key not match public key")
+	// ErrIndexOutOfRange is returned for a node index outside [0, Nodes)
+	ErrIndexOutOfRange = errors.New("cpk: node index out of range")
+	// ErrInvalidEpoch is returned for an epoch with an unknown granularity
+	ErrInvalidEpoch = errors.New("cpk: invalid epoch")
+	// ErrInvalidSignature is returned when a signature does not verify
+	ErrInvalidSignature = errors.New("cpk: invalid signature")
+	// ErrPartialKeyUnavailable is returned when the client holds no PMPiece of the node
+	ErrPartialKeyUnavailable = errors.New("cpk: partial public key unavailable")
+	// ErrRootNotPinned is returned when a signed matrix is loaded into a client without a pinned root
+	ErrRootNotPinned = errors.New("cpk: root public key not pinned")
+	// ErrManifestRequired is returned when an unsigned matrix is loaded into a client with a pinned root
+	ErrManifestRequired = errors.New("cpk: matrix manifest required")
+	// ErrInvalidManifest is returned when the manifest signature does not verify against the root
+	ErrInvalidManifest = errors.New("cpk: invalid matrix manifest")
+	// ErrFingerprintMismatch is returned when the matrix does not match the fingerprint of its manifest
+	ErrFingerprintMismatch = errors.New("cpk: matrix fingerprint mismatch")
+	// ErrInvalidDomain is returned for a domain with an empty namespace or a bad mapping version
+	ErrInvalidDomain = errors.New("cpk: invalid identity domain")
+	// ErrInvalidFormat is wrapped by every error describing a malformed container
+	ErrInvalidFormat = errors.New("cpk: invalid file format")
+	// ErrChecksumMismatch is returned when the checksum of a container does not match its content
+	ErrChecksumMismatch = errors.New("cpk: checksum mismatch")
+	// ErrInvalidPoint is returned for an identity point or a non-canonical point encoding
+	ErrInvalidPoint = errors.New("cpk: invalid point")
+	// ErrLegacyLayout is returned for the replicated distributed CA layout of the first releases
+	ErrLegacyLayout = errors.New("cpk: legacy layout cannot be migrated")
+	// ErrWrongPassphrase is returned when a keystore cannot be opened with the passphrase
+	ErrWrongPassphrase = errors.New("cpk: wrong passphrase")
+	// ErrInvalidEnrollKey is returned for an enrollment key that cannot be used for key exchange
+	ErrInvalidEnrollKey = errors.New("cpk: invalid enrollment key")
+	// ErrDKGFailed is returned when the distributed key generation ends without enough qualified dealers
+	ErrDKGFailed = errors.New("cpk: distributed key generation failed")
+	// ErrUnknownVersion is returned for a matrix version the client or CA does not hold
+	ErrUnknownVersion = errors.New("cpk: unknown matrix version")
+	// ErrVersionNotValid is returned when no matrix version is valid at the given time
+	ErrVersionNotValid = errors.New("cpk: matrix version not valid")
+	// ErrVersionMismatch is returned when a key exchange was made with another matrix version
+	ErrVersionMismatch = errors.New("cpk: matrix version mismatch")
+	// ErrDecryptFailed is returned when a ciphertext cannot be decrypted with the key and the associated data
+	ErrDecryptFailed = errors.New("cpk: decryption failed")
+	// ErrKeyNotInitialized is returned when a key or a piece passed in has no value
+	ErrKeyNotInitialized = errors.New("cpk: key not initialized")
+	// ErrInternal reports a broken internal invariant
+	ErrInternal = errors.New("cpk: internal error")
+	// ErrBackendPeer is returned when a process of another user connects to the backend socket
+	ErrBackendPeer = errors.New("cpk: backend peer belongs to another user")
+	// ErrReservedIdent is returned for a plain identity starting with a reserved encoding tag
+	ErrReservedIdent = errors.New("cpk: identity starts with a reserved encoding")
+)
+
+// ErrInconsistentPiece reports the element of a piece that does not match the other pieces
+type ErrInconsistentPiece struct {
+	// 分片所属节点序号
+	Index int64
+	// 不一致的元素在矩阵中的位置
+	Position int
+}
+
+func (e *ErrInconsistentPiece) Error() string {
+	return fmt.Sprintf("cpk: piece %d not consistent at position %d", e.Index, e.Position)
+}
+
+// ErrMatrixSizeMismatch reports a matrix or piece whose element count does not match the params
+type ErrMatrixSizeMismatch struct {
+	Expected int
+	Actual   int
+}
+
+func (e *ErrMatrixSizeMismatch) Error() string {
+	return fmt.Sprintf("cpk: matrix size %d not match expected %d", e.Actual, e.Expected)
+}
+
+// ErrOpenSealedPiece reports a sealed sk piece that cannot be decrypted or is not bound to the identity
+type ErrOpenSealedPiece struct {
+	Index int64
+}
+
+func (e *ErrOpenSealedPiece) Error() string {
+	return fmt.Sprintf("cpk: cannot open sealed sk piece %d", e.Index)
+}
+
+// ErrFaultyPiece reports an sk piece that does not match the partial public key of its node
+type ErrFaultyPiece struct {
+	Index int64
+}
+
+func (e *ErrFaultyPiece) Error() string {
+	return fmt.Sprintf("cpk: sk piece %d not match partial public key", e.Index)
+}
+
+// ErrRemoteBackend reports an error returned by the backend daemon
+type ErrRemoteBackend struct {
+	Message string
+}
+
+func (e *ErrRemoteBackend) Error() string {
+	return "cpk: remote backend: " + e.Message
+}
@@ -0,0 +1,127 @@
+package cpk
+
+import (
+	"github.com/stretchr/testify/require"
+	"github.com/walegarrett/cpk-algs/base"
+	"testing"
+)
+
+func TestClient_Errors(t *testing.T) {
+	client := Client{}
+	_, err := client.QueryPK("id1")
+	require.ErrorIs(t, err, ErrMatrixNotLoaded)
+
+	_, err = NewClient(make([]base.Ed25519Point, 3))
+	var sizeMismatch *ErrMatrixSizeMismatch
+	require.ErrorAs(t, err, &sizeMismatch)
+	require.Equal(t, DefaultParams().Size(), sizeMismatch.Expected)
+	require.Equal(t, 3, sizeMismatch.Actual)
+
+	var ca CA
+	_, err = ca.QuerySK("id1")
+	require.ErrorIs(t, err, ErrMatrixNotLoaded)
+	require.ErrorIs(t, ca.ExportPublicMatrixForClient(&client), ErrMatrixNotLoaded)
+	require.ErrorIs(t, ca.InitCAWithParams(Params{Rows: 30, SubsSize: 8, Blocks: 4, Threshold: 2, Nodes: 4}, "genkey1"), ErrInvalidParams)
+
+	var distributedCA DistributedCA
+	_, err = distributedCA.QuerySK("id1")
+	require.ErrorIs(t, err, ErrMatrixNotLoaded)
+	require.ErrorIs(t, distributedCA.InitDistributedCA(4, "gen_key"), ErrIndexOutOfRange)
+
+	// 导出失败时客户端保持原来的参数与矩阵
+	require.NoError(t, ca.InitCA("genkey1"))
+	var loaded Client
+	require.NoError(t, ca.ExportPublicMatrixForClient(&loaded))
+	fingerprint, err := loaded.Fingerprint()
+	require.NoError(t, err)
+	var broken CA
+	require.NoError(t, broken.InitCAWithParams(Params{Rows: 8, SubsSize: 4, Blocks: 2, Threshold: 2, Nodes: 3}, "genkey1"))
+	broken.privateMatrix[0].Scalar = nil
+	require.ErrorIs(t, broken.ExportPublicMatrixForClient(&loaded), ErrMatrixNotLoaded)
+	require.Equal(t, DefaultParams(), loaded.Params())
+	unchanged, err := loaded.Fingerprint()
+	require.NoError(t, err)
+	require.Equal(t, fingerprint, unchanged)
+}
+
+func TestClient_CombinePMPiecesErrors(t *testing.T) {
+	params := Params{Rows: 8, SubsSize: 4, Blocks: 2, Threshold: 2, Nodes: 3}
+	var ca CA
+	require.NoError(t, ca.InitCAWithParams(params, "genkey1"))
+	distributedCAs, err := ca.SplitDistributedCAs()
+	require.NoError(t, err)
+	pmPieces := make([]PMPiece, len(distributedCAs))
+	for i := range distributedCAs {
+		pmPieces[i], err = distributedCAs[i].ExportPublicMatrixPiece()
+		require.NoError(t, err)
+	}
+
+	client := Client{params: params}
+	require.ErrorIs(t, client.CombinePMPieces(pmPieces[:1]), ErrInsufficientPieces)
+	require.ErrorIs(t, client.CombinePMPieces([]PMPiece{pmPieces[0], pmPieces[0]}), ErrInsufficientPieces)
+	require.ErrorIs(t, client.CombinePMPieces([]PMPiece{{Index: 5, Piece: pmPieces[0].Piece}}), ErrIndexOutOfRange)
+
+	var sizeMismatch *ErrMatrixSizeMismatch
+	short := PMPiece{Index: 1, Piece: pmPieces[1].Piece[:10]}
+	require.ErrorAs(t, client.CombinePMPieces([]PMPiece{pmPieces[0], short}), &sizeMismatch)
+
+	// 第三个分片的第5个元素被替换
+	tampered := PMPiece{Index: 2, Piece: append([]base.Ed25519Point{}, pmPieces[2].Piece...)}
+	tampered.Piece[5] = pmPieces[2].Piece[6]
+	var inconsistent *ErrInconsistentPiece
+	require.ErrorAs(t, client.CombinePMPieces([]PMPiece{pmPieces[0], pmPieces[1], tampered}), &inconsistent)
+	require.Equal(t, int64(2), inconsistent.Index)
+	require.Equal(t, 5, inconsistent.Position)
+	_, err = client.QueryPK("id1")
+	require.ErrorIs(t, err, ErrMatrixNotLoaded)
+
+	require.NoError(t, client.CombinePMPieces(pmPieces))
+	pk, err := client.QueryPK("id1")
+	require.NoError(t, err)
+	skPiece, err := distributedCAs[0].QuerySK("id1")
+	require.NoError(t, err)
+	_, err = client.CombineSKPieces([]SKPiece{skPiece}, *pk)
+	require.ErrorIs(t, err, ErrInsufficientPieces)
+	_, err = client.CombineSKPieces([]SKPiece{skPiece, {Index: 1, Secret: skPiece.Secret}}, *pk)
+	require.ErrorIs(t, err, ErrKeyMismatch)
+	_, err = client.CombineSKPieces([]SKPiece{skPiece, {Index: 1}}, *pk)
+	require.ErrorIs(t, err, ErrKeyNotInitialized)
+	_, err = client.CombineSKPieces([]SKPiece{skPiece}, base.PublicKey{})
+	require.ErrorIs(t, err, ErrKeyNotInitialized)
+
+	// 缓存中的值类型错误时返回内部错误而不是崩溃
+	client.pkCache = base.NewLRU(1, func(string) interface{} {
+		return 42
+	})
+	_, err = client.QueryPK("id1")
+	require.ErrorIs(t, err, ErrInternal)
+}
+
+func TestCommitments_DeserializeErrors(t *testing.T) {
+	for _, c := range [][2]int64{{0, 4}, {-1, 4}, {3, 4}} {
+		var serializer base.Serializer
+		serializer.WriteInt64(c[0])
+		serializer.WriteInt64(c[1])
+		deserializer, err := base.NewDeserializer(serializer)
+		require.NoError(t, err)
+		var commitments Commitments
+		require.ErrorIs(t, commitments.Deserialize(deserializer), ErrInvalidFormat)
+	}
+}
+
+func TestLegacyClient(t *testing.T) {
+	var ca CA
+	LegacyCA{&ca}.InitCA("genkey1")
+	client := LegacyClient{&Client{}}
+	LegacyCA{&ca}.ExportPublicMatrixForClient(client.Client)
+	sk := LegacyCA{&ca}.QuerySK("id1")
+	pk := client.QueryPK("id1")
+	require.Equal(t, 1, pk.Equal(sk.Public().Point))
+
+	require.Panics(t, func() {
+		LegacyClient{&Client{}}.QueryPK("id1")
+	})
+	require.Panics(t, func() {
+		LegacyClient{&Client{}}.CombinePMPieces(nil)
+	})
+}
@@ -0,0 +1,449 @@
+package cpk
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"fmt"
+	"github.com/walegarrett/cpk-algs/base"
+	"github.com/walegarrett/cpk-algs/base/edwards25519"
+	"golang.org/x/crypto/blake2b"
+)
+
+// 文件格式
+// magic(4) | version(int32) | object type(int32) | params(5 x int64) | payload length(int64) | payload | checksum(32)
+// checksum 为之前所有字节的 BLAKE2b-256 摘要
+const (
+	fileMagic = "CPK\x1a"
+	// FormatVersion is the version of the container written by MarshalBinary
+	FormatVersion = 1
+	// 头部长度：magic、版本、对象类型、参数块与载荷长度
+	headerSize = 4 + 4 + 4 + 5*8 + 8
+)
+
+// ObjectType identifies the object stored in a container
+type ObjectType int32
+
+const (
+	ObjectCA ObjectType = iota + 1
+	ObjectDistributedCA
+	ObjectClient
+	ObjectPMPiece
+	ObjectSKPiece
+	ObjectKeystore
+)
+
+func (objectType ObjectType) String() string {
+	switch objectType {
+	case ObjectCA:
+		return "ca"
+	case ObjectDistributedCA:
+		return "distributed-ca"
+	case ObjectClient:
+		return "client"
+	case ObjectPMPiece:
+		return "pm-piece"
+	case ObjectSKPiece:
+		return "sk-piece"
+	case ObjectKeystore:
+		return "keystore"
+	}
+	return fmt.Sprintf("ObjectType(%d)", int32(objectType))
+}
+
+// Header is the self-describing part of a container
+type Header struct {
+	Version    int32
+	ObjectType ObjectType
+	// 矩阵布局，分片对象不依赖布局时为零值
+	Params Params
+}
+
+// sealContainer wraps the payload into a container with the header and the checksum
+func sealContainer(header Header, payload []byte) []byte {
+	var serializer base.Serializer
+	serializer.WriteBytes([]byte(fileMagic))
+	serializer.WriteInt32(header.Version)
+	serializer.WriteInt32(int32(header.ObjectType))
+	header.Params.Serialize(&serializer)
+	serializer.WriteBytesWithLength(payload)
+	checksum := blake2b.Sum256(serializer)
+	serializer.WriteBytes(checksum[:])
+	return serializer
+}
+
+// isContainer reports whether data starts with the container magic
+func isContainer(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(fileMagic))
+}
+
+// ReadHeader checks the container and returns its header without decoding the payload
+func ReadHeader(data []byte) (Header, error) {
+	header, _, err := openContainer(data)
+	return header, err
+}
+
+// openContainer checks the magic, the version and the checksum and returns the header and the payload
+func openContainer(data []byte) (Header, []byte, error) {
+	var header Header
+	if !isContainer(data) {
+		return header, nil, fmt.Errorf("%w: bad magic", ErrInvalidFormat)
+	}
+	if len(data) < headerSize+blake2b.Size256 {
+		return header, nil, fmt.Errorf("%w: truncated container", ErrInvalidFormat)
+	}
+	body, checksum := data[:len(data)-blake2b.Size256], data[len(data)-blake2b.Size256:]
+	sum := blake2b.Sum256(body)
+	if subtle.ConstantTimeCompare(sum[:], checksum) != 1 {
+		return header, nil, ErrChecksumMismatch
+	}
+	deserializer, err := base.NewDeserializer(body[len(fileMagic):])
+	if err != nil {
+		return header, nil, err
+	}
+	var objectType int32
+	if _, err = deserializer.ReadInt32(&header.Version); err != nil {
+		return header, nil, err
+	}
+	if header.Version != FormatVersion {
+		return header, nil, fmt.Errorf("%w: unsupported version %d", ErrInvalidFormat, header.Version)
+	}
+	if _, err = deserializer.ReadInt32(&objectType); err != nil {
+		return header, nil, err
+	}
+	header.ObjectType = ObjectType(objectType)
+	var fields [5]int64
+	for i := range fields {
+		if _, err = deserializer.ReadInt64(&fields[i]); err != nil {
+			return header, nil, err
+		}
+	}
+	header.Params = Params{
+		Rows:      int(fields[0]),
+		SubsSize:  int(fields[1]),
+		Blocks:    int(fields[2]),
+		Threshold: int(fields[3]),
+		Nodes:     int(fields[4]),
+	}
+	if header.Params != (Params{}) {
+		if err = header.Params.Validate(); err != nil {
+			return header, nil, err
+		}
+	}
+	var l int64
+	if _, err = deserializer.ReadLength(&l); err != nil || uint64(l) != deserializer.Remaining() {
+		return header, nil, fmt.Errorf("%w: bad payload length", ErrInvalidFormat)
+	}
+	return header, body[headerSize:], nil
+}
+
+// openObject opens the container and checks that it holds the object type
+func openObject(data []byte, objectType ObjectType) (Header, *base.DeSerializer, error) {
+	header, payload, err := openContainer(data)
+	if err != nil {
+		return header, nil, err
+	}
+	if header.ObjectType != objectType {
+		return header, nil, fmt.Errorf("%w: object type %s, expected %s", ErrInvalidFormat, header.ObjectType, objectType)
+	}
+	deserializer, err := base.NewDeserializer(payload)
+	if err != nil {
+		return header, nil, err
+	}
+	return header, deserializer, nil
+}
+
+// checkConsumed rejects trailing bytes after the decoded object
+func checkConsumed(deserializer *base.DeSerializer) error {
+	if deserializer.Remaining() != 0 {
+		return fmt.Errorf("%w: trailing bytes", ErrInvalidFormat)
+	}
+	return nil
+}
+
+// readPoint reads a point and rejects the identity and non-canonical encodings
+func readPoint(deserializer *base.DeSerializer, point *base.Ed25519Point) error {
+	var buf [32]byte
+	_, err := deserializer.ReadBytes(buf[:], uint64(len(buf)))
+	if err != nil {
+		return err
+	}
+	p, err := (&edwards25519.Point{}).SetBytes(buf[:])
+	if err != nil {
+		return ErrInvalidPoint
+	}
+	if !bytes.Equal(p.Bytes(), buf[:]) || p.Equal(edwards25519.NewIdentityPoint()) == 1 {
+		return ErrInvalidPoint
+	}
+	point.Point = p
+	return nil
+}
+
+// readPoints reads l validated points, l is checked against the remaining bytes before allocating
+func readPoints(deserializer *base.DeSerializer, l int64) ([]base.Ed25519Point, error) {
+	if l < 0 || uint64(l) > deserializer.Remaining()/32 {
+		return nil, fmt.Errorf("%w: bad element count %d", ErrInvalidFormat, l)
+	}
+	points := make([]base.Ed25519Point, l)
+	for i := range points {
+		if err := readPoint(deserializer, &points[i]); err != nil {
+			return nil, err
+		}
+	}
+	return points, nil
+}
+
+// readScalars reads l canonical scalars, l is checked against the remaining bytes before allocating
+func readScalars(deserializer *base.DeSerializer, l int64) ([]base.Ed25519Scala, error) {
+	if l < 0 || uint64(l) > deserializer.Remaining()/32 {
+		return nil, fmt.Errorf("%w: bad element count %d", ErrInvalidFormat, l)
+	}
+	scalars := make([]base.Ed25519Scala, l)
+	for i := range scalars {
+		if _, err := deserializer.ReadSerializable(&scalars[i]); err != nil {
+			return nil, err
+		}
+	}
+	return scalars, nil
+}
+
+// isBaselineMatrix reports whether data is the headerless layout of the first releases, an
+// int64 length followed by the elements of the default 32x32 matrix
+func isBaselineMatrix(data []byte) bool {
+	size := DefaultParams().Size()
+	if len(data) != 8+size*32 {
+		return false
+	}
+	deserializer, err := base.NewDeserializer(data)
+	if err != nil {
+		return false
+	}
+	var l int64
+	_, err = deserializer.ReadInt64(&l)
+	return err == nil && l == int64(size)
+}
+
+// withDefaultParams prefixes the baseline layout with the default params block so that the
+// current Deserialize can read it
+func withDefaultParams(data []byte) []byte {
+	var serializer base.Serializer
+	params := DefaultParams()
+	params.Serialize(&serializer)
+	serializer.WriteBytes(data)
+	return serializer
+}
+
+// MarshalBinary encodes the CA into a container
+func (ca *CA) MarshalBinary() ([]byte, error) {
+	if len(ca.privateMatrix) != ca.Params().Size() {
+		return nil, ErrMatrixNotLoaded
+	}
+	var serializer base.Serializer
+	ca.Serialize(&serializer)
+	return sealContainer(Header{Version: FormatVersion, ObjectType: ObjectCA, Params: ca.Params()}, serializer), nil
+}
+
+// UnmarshalBinary decodes a container, or a headerless file of the previous layouts
+func (ca *CA) UnmarshalBinary(data []byte) error {
+	if !isContainer(data) {
+		if isBaselineMatrix(data) {
+			data = withDefaultParams(data)
+		}
+		return unmarshalLegacy(data, ca.Deserialize)
+	}
+	header, deserializer, err := openObject(data, ObjectCA)
+	if err != nil {
+		return err
+	}
+	var res CA
+	if err = res.Deserialize(deserializer); err != nil {
+		return err
+	}
+	if err = checkHeaderParams(header, res.params); err != nil {
+		return err
+	}
+	if err = checkConsumed(deserializer); err != nil {
+		return err
+	}
+	ca.params, ca.privateMatrix, ca.backend = res.params, res.privateMatrix, nil
+	return nil
+}
+
+// MarshalBinary encodes the distributed CA into a container
+func (distributedCA *DistributedCA) MarshalBinary() ([]byte, error) {
+	if len(distributedCA.privateMatrixPiece) != distributedCA.Params().Size() {
+		return nil, ErrMatrixNotLoaded
+	}
+	var serializer base.Serializer
+	distributedCA.Serialize(&serializer)
+	header := Header{Version: FormatVersion, ObjectType: ObjectDistributedCA, Params: distributedCA.Params()}
+	return sealContainer(header, serializer), nil
+}
+
+// UnmarshalBinary decodes a container, or a headerless file of the previous layout,
+// the replicated pieces of the first releases cannot be converted to shares
+func (distributedCA *DistributedCA) UnmarshalBinary(data []byte) error {
+	if !isContainer(data) {
+		if isBaselinePiece(data) {
+			return ErrLegacyLayout
+		}
+		return unmarshalLegacy(data, distributedCA.Deserialize)
+	}
+	header, deserializer, err := openObject(data, ObjectDistributedCA)
+	if err != nil {
+		return err
+	}
+	var res DistributedCA
+	if err = res.Deserialize(deserializer); err != nil {
+		return err
+	}
+	if err = checkHeaderParams(header, res.params); err != nil {
+		return err
+	}
+	if err = checkConsumed(deserializer); err != nil {
+		return err
+	}
+	distributedCA.params = res.params
+	distributedCA.privateMatrixPiece = res.privateMatrixPiece
+	distributedCA.backend = nil
+	distributedCA.commitments = res.commitments
+	distributedCA.Index = res.Index
+	return nil
+}
+
+// isBaselinePiece reports whether data is the replicated distributed CA layout of the first releases
+func isBaselinePiece(data []byte) bool {
+	size := DefaultParams().Size() / 2
+	if len(data) != 8+size*32+8 {
+		return false
+	}
+	deserializer, err := base.NewDeserializer(data)
+	if err != nil {
+		return false
+	}
+	var l int64
+	_, err = deserializer.ReadInt64(&l)
+	return err == nil && l == int64(size)
+}
+
+// MarshalBinary encodes the public matrix of the client into a container
+func (client *Client) MarshalBinary() ([]byte, error) {
+	if len(client.publicMatrix) != client.Params().Size() {
+		return nil, ErrMatrixNotLoaded
+	}
+	var serializer base.Serializer
+	client.Serialize(&serializer)
+	return sealContainer(Header{Version: FormatVersion, ObjectType: ObjectClient, Params: client.Params()}, serializer), nil
+}
+
+// UnmarshalBinary decodes a container, or a headerless file of the previous layouts
+func (client *Client) UnmarshalBinary(data []byte) error {
+	if err := client.requireUnpinned(); err != nil {
+		return err
+	}
+	if !isContainer(data) {
+		if isBaselineMatrix(data) {
+			data = withDefaultParams(data)
+		}
+		return unmarshalLegacy(data, client.Deserialize)
+	}
+	header, deserializer, err := openObject(data, ObjectClient)
+	if err != nil {
+		return err
+	}
+	var res Client
+	if err = res.Deserialize(deserializer); err != nil {
+		return err
+	}
+	if err = checkHeaderParams(header, res.params); err != nil {
+		return err
+	}
+	if err = checkConsumed(deserializer); err != nil {
+		return err
+	}
+	client.params = res.params
+	client.publicMatrix = res.publicMatrix
+	client.pmPieces = nil
+	client.manifest = nil
+	client.precompute()
+	return nil
+}
+
+// MarshalBinary encodes the piece into a container
+func (pmPiece *PMPiece) MarshalBinary() ([]byte, error) {
+	if err := checkPoints(pmPiece.Piece, len(pmPiece.Piece)); err != nil {
+		return nil, err
+	}
+	var serializer base.Serializer
+	pmPiece.Serialize(&serializer)
+	return sealContainer(Header{Version: FormatVersion, ObjectType: ObjectPMPiece}, serializer), nil
+}
+
+// UnmarshalBinary decodes a container, or a headerless piece
+func (pmPiece *PMPiece) UnmarshalBinary(data []byte) error {
+	if !isContainer(data) {
+		return unmarshalLegacy(data, pmPiece.DeSerialize)
+	}
+	_, deserializer, err := openObject(data, ObjectPMPiece)
+	if err != nil {
+		return err
+	}
+	var res PMPiece
+	if err = res.DeSerialize(deserializer); err != nil {
+		return err
+	}
+	if err = checkConsumed(deserializer); err != nil {
+		return err
+	}
+	*pmPiece = res
+	return nil
+}
+
+// MarshalBinary encodes the piece into a container
+func (skPiece *SKPiece) MarshalBinary() ([]byte, error) {
+	if skPiece.Secret.Scalar == nil {
+		return nil, ErrMatrixNotLoaded
+	}
+	var serializer base.Serializer
+	skPiece.Serialize(&serializer)
+	return sealContainer(Header{Version: FormatVersion, ObjectType: ObjectSKPiece}, serializer), nil
+}
+
+// UnmarshalBinary decodes a container, or a headerless piece
+func (skPiece *SKPiece) UnmarshalBinary(data []byte) error {
+	if !isContainer(data) {
+		return unmarshalLegacy(data, skPiece.DeSerialize)
+	}
+	_, deserializer, err := openObject(data, ObjectSKPiece)
+	if err != nil {
+		return err
+	}
+	var res SKPiece
+	if err = res.DeSerialize(deserializer); err != nil {
+		return err
+	}
+	if err = checkConsumed(deserializer); err != nil {
+		return err
+	}
+	*skPiece = res
+	return nil
+}
+
+// checkHeaderParams checks that the params block of the header matches the payload
+func checkHeaderParams(header Header, params Params) error {
+	if header.Params != params {
+		return fmt.Errorf("%w: header params not match payload", ErrInvalidFormat)
+	}
+	return nil
+}
+
+// unmarshalLegacy decodes a headerless file with the Deserialize method of the object
+func unmarshalLegacy(data []byte, deserialize func(*base.DeSerializer) error) error {
+	deserializer, err := base.NewDeserializer(data)
+	if err != nil {
+		return err
+	}
+	if err = deserialize(deserializer); err != nil {
+		return err
+	}
+	return checkConsumed(deserializer)
+}
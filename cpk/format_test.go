@@ -0,0 +1,181 @@
+package cpk
+
+import (
+	"encoding/hex"
+	"github.com/stretchr/testify/require"
+	"github.com/walegarrett/cpk-algs/base"
+	"golang.org/x/crypto/blake2b"
+	"testing"
+)
+
+func TestMarshalBinary(t *testing.T) {
+	params := Params{Rows: 16, SubsSize: 4, Blocks: 4, Threshold: 2, Nodes: 3}
+	var ca CA
+	require.NoError(t, ca.InitCAWithParams(params, "gen_key"))
+	data, err := ca.MarshalBinary()
+	require.NoError(t, err)
+	header, err := ReadHeader(data)
+	require.NoError(t, err)
+	require.Equal(t, Header{Version: FormatVersion, ObjectType: ObjectCA, Params: params}, header)
+	var loadedCA CA
+	require.NoError(t, loadedCA.UnmarshalBinary(data))
+	require.Equal(t, ca.Params(), loadedCA.Params())
+	sk, err := loadedCA.QuerySK("alice")
+	require.NoError(t, err)
+	expected, err := ca.QuerySK("alice")
+	require.NoError(t, err)
+	require.Equal(t, 1, sk.Scalar.Equal(expected.Scalar))
+
+	var client Client
+	require.NoError(t, ca.ExportPublicMatrixForClient(&client))
+	data, err = client.MarshalBinary()
+	require.NoError(t, err)
+	var loadedClient Client
+	require.NoError(t, loadedClient.UnmarshalBinary(data))
+	pk, err := loadedClient.QueryPK("alice")
+	require.NoError(t, err)
+	require.Equal(t, 1, pk.Equal(expected.Public().Point))
+	// 容器的对象类型必须匹配
+	require.ErrorIs(t, loadedCA.UnmarshalBinary(data), ErrInvalidFormat)
+
+	distributedCAs, err := ca.SplitDistributedCAs()
+	require.NoError(t, err)
+	data, err = distributedCAs[2].MarshalBinary()
+	require.NoError(t, err)
+	var distributedCA DistributedCA
+	require.NoError(t, distributedCA.UnmarshalBinary(data))
+	require.Equal(t, int64(2), distributedCA.Index)
+	require.NoError(t, distributedCA.VerifyShares())
+
+	pmPiece, err := distributedCA.ExportPublicMatrixPiece()
+	require.NoError(t, err)
+	data, err = pmPiece.MarshalBinary()
+	require.NoError(t, err)
+	var loadedPMPiece PMPiece
+	require.NoError(t, loadedPMPiece.UnmarshalBinary(data))
+	require.Equal(t, pmPiece.Index, loadedPMPiece.Index)
+	require.Len(t, loadedPMPiece.Piece, params.Size())
+
+	skPiece, err := distributedCA.QuerySK("alice")
+	require.NoError(t, err)
+	data, err = skPiece.MarshalBinary()
+	require.NoError(t, err)
+	var loadedSKPiece SKPiece
+	require.NoError(t, loadedSKPiece.UnmarshalBinary(data))
+	require.Equal(t, skPiece, loadedSKPiece)
+
+	// 任意字节被篡改后校验和不匹配
+	for _, i := range []int{0, 10, len(data) / 2, len(data) - 1} {
+		tampered := append([]byte(nil), data...)
+		tampered[i] ^= 1
+		err = loadedSKPiece.UnmarshalBinary(tampered)
+		require.Error(t, err)
+		if i > 0 {
+			require.ErrorIs(t, err, ErrChecksumMismatch)
+		}
+	}
+	_, err = ReadHeader(data[:20])
+	require.ErrorIs(t, err, ErrInvalidFormat)
+}
+
+func TestUnmarshalBinary_Legacy(t *testing.T) {
+	var ca CA
+	require.NoError(t, ca.InitCA("gen_key"))
+	var client Client
+	require.NoError(t, ca.ExportPublicMatrixForClient(&client))
+	expected, err := ca.QuerySK("alice")
+	require.NoError(t, err)
+
+	// 带参数块的无头部格式
+	var serializer base.Serializer
+	client.Serialize(&serializer)
+	var loadedClient Client
+	require.NoError(t, loadedClient.UnmarshalBinary(serializer))
+	pk, err := loadedClient.QueryPK("alice")
+	require.NoError(t, err)
+	require.Equal(t, 1, pk.Equal(expected.Public().Point))
+
+	// 最初版本的格式：长度加元素
+	serializer = base.Serializer{}
+	serializer.WriteInt64(int64(len(ca.privateMatrix)))
+	for i := range ca.privateMatrix {
+		serializer.WriteSerializable(&ca.privateMatrix[i])
+	}
+	var loadedCA CA
+	require.NoError(t, loadedCA.UnmarshalBinary(serializer))
+	sk, err := loadedCA.QuerySK("alice")
+	require.NoError(t, err)
+	require.Equal(t, 1, sk.Scalar.Equal(expected.Scalar))
+
+	serializer = base.Serializer{}
+	serializer.WriteInt64(int64(len(client.publicMatrix)))
+	for i := range client.publicMatrix {
+		serializer.WriteSerializable(&client.publicMatrix[i])
+	}
+	loadedClient = Client{}
+	require.NoError(t, loadedClient.UnmarshalBinary(serializer))
+	pk, err = loadedClient.QueryPK("alice")
+	require.NoError(t, err)
+	require.Equal(t, 1, pk.Equal(expected.Public().Point))
+
+	// 最初版本的分布式节点保存的是复制的半个矩阵，无法转换为门限分片
+	serializer = base.Serializer{}
+	serializer.WriteInt64(int64(len(ca.privateMatrix) / 2))
+	for i := range ca.privateMatrix[:len(ca.privateMatrix)/2] {
+		serializer.WriteSerializable(&ca.privateMatrix[i])
+	}
+	serializer.WriteInt64(1)
+	var distributedCA DistributedCA
+	require.ErrorIs(t, distributedCA.UnmarshalBinary(serializer), ErrLegacyLayout)
+}
+
+func TestUnmarshalBinary_InvalidPoints(t *testing.T) {
+	var ca CA
+	require.NoError(t, ca.InitCA("gen_key"))
+	var client Client
+	require.NoError(t, ca.ExportPublicMatrixForClient(&client))
+	// y = p 是点 (sqrt(-1), 0) 的非规范编码
+	nonCanonical, err := hex.DecodeString("edffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff7f")
+	require.NoError(t, err)
+	identity := base.NewEd25519Point().Bytes()
+	for _, bad := range [][]byte{nonCanonical, identity} {
+		var serializer base.Serializer
+		client.Serialize(&serializer)
+		data := append([]byte(nil), serializer...)
+		copy(data[len(data)-32:], bad)
+		var loaded Client
+		require.ErrorIs(t, loaded.UnmarshalBinary(data), ErrInvalidPoint)
+
+		pmPiece := PMPiece{Index: 0, Piece: client.QueryPublicKeyMatrix()}
+		serializer = base.Serializer{}
+		pmPiece.Serialize(&serializer)
+		data = append([]byte(nil), serializer...)
+		copy(data[len(data)-32:], bad)
+		var loadedPMPiece PMPiece
+		require.ErrorIs(t, loadedPMPiece.UnmarshalBinary(data), ErrInvalidPoint)
+	}
+
+	// 长度字段远大于实际数据时不分配内存
+	var serializer base.Serializer
+	serializer.WriteInt64(0)
+	serializer.WriteInt64(1 << 60)
+	var pmPiece PMPiece
+	require.ErrorIs(t, pmPiece.UnmarshalBinary(serializer), ErrInvalidFormat)
+}
+
+func TestReadHeader_PayloadLengthOutOfRange(t *testing.T) {
+	data := sealContainer(Header{Version: FormatVersion, ObjectType: ObjectSKPiece}, []byte("payload"))
+	for _, l := range []int64{-1, 6, 8, 1 << 62} {
+		// 校验和正确，但载荷长度与剩余字节不符
+		var serializer base.Serializer
+		serializer.WriteBytes(data[:headerSize-8])
+		serializer.WriteInt64(l)
+		serializer.WriteBytes(data[headerSize : len(data)-blake2b.Size256])
+		checksum := blake2b.Sum256(serializer)
+		serializer.WriteBytes(checksum[:])
+		_, err := ReadHeader(serializer)
+		require.ErrorIs(t, err, ErrInvalidFormat)
+	}
+	_, err := ReadHeader(data)
+	require.NoError(t, err)
+}
@@ -0,0 +1,328 @@
+package cpk
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"github.com/walegarrett/cpk-algs/base"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// 密钥库的域标签，作为 AEAD 的附加数据
+const keystoreTag = "cpk-keystore-v1"
+
+const (
+	keystoreSaltSize = 32
+	// 新建密钥库时 KDF 参数的下限，64 MiB 与 2 轮
+	minKDFTime   = 2
+	minKDFMemory = 64 << 10
+	// 打开密钥库时允许的 KDF 参数上限，避免恶意文件耗尽内存或时间；
+	// 内存与轮数之积不超过 4 GiB，可容纳 RFC 9106 推荐的 2 GiB 单轮参数
+	maxKDFTime    = 16
+	maxKDFMemory  = 2 << 20
+	maxKDFThreads = 16
+	maxKDFCost    = 4 << 20
+)
+
+// KDFParams configures argon2id, Memory is in KiB
+type KDFParams struct {
+	Time    uint32
+	Memory  uint32
+	Threads uint8
+}
+
+// DefaultKDFParams returns the argon2id parameters recommended by RFC 9106 for memory-constrained environments
+func DefaultKDFParams() KDFParams {
+	return KDFParams{Time: 3, Memory: 64 << 10, Threads: 4}
+}
+
+// Validate checks that the argon2id parameters are strong enough to seal a keystore, at
+// least 64 MiB and 2 passes, and small enough to be opened
+func (kdf KDFParams) Validate() error {
+	if err := kdf.check(); err != nil {
+		return err
+	}
+	if kdf.Time < minKDFTime || kdf.Memory < minKDFMemory {
+		return fmt.Errorf("%w: kdf params too weak", ErrInvalidParams)
+	}
+	return nil
+}
+
+// check checks the argon2id parameters of a keystore being opened
+func (kdf KDFParams) check() error {
+	if kdf.Time == 0 || kdf.Threads == 0 || kdf.Memory < 8*uint32(kdf.Threads) {
+		return fmt.Errorf("%w: kdf params too small", ErrInvalidParams)
+	}
+	if kdf.Time > maxKDFTime || kdf.Memory > maxKDFMemory || kdf.Threads > maxKDFThreads ||
+		uint64(kdf.Time)*uint64(kdf.Memory) > maxKDFCost {
+		return fmt.Errorf("%w: kdf params too large", ErrInvalidParams)
+	}
+	return nil
+}
+
+// keystore 文件结构
+// 口令经 argon2id 派生出包装密钥，包装密钥加密随机的数据密钥，数据密钥加密对象的容器编码
+// 修改口令时只需重新包装数据密钥
+type keystore struct {
+	objectType ObjectType
+	kdf        KDFParams
+	salt       []byte
+	// XChaCha20-Poly1305 加密的数据密钥，前24字节为 nonce
+	wrappedKey []byte
+	// XChaCha20-Poly1305 加密的对象，前24字节为 nonce
+	ciphertext []byte
+}
+
+// objectAdditionalData binds the ciphertext to the object type
+func (ks *keystore) objectAdditionalData() []byte {
+	var serializer base.Serializer
+	serializer.WriteString(keystoreTag)
+	serializer.WriteInt32(int32(ks.objectType))
+	return serializer
+}
+
+// keyAdditionalData binds the wrapped data key to the object type and the KDF params
+func (ks *keystore) keyAdditionalData() []byte {
+	serializer := base.Serializer(ks.objectAdditionalData())
+	serializer.WriteInt64(int64(ks.kdf.Time))
+	serializer.WriteInt64(int64(ks.kdf.Memory))
+	serializer.WriteInt64(int64(ks.kdf.Threads))
+	serializer.WriteBytesWithLength(ks.salt)
+	return serializer
+}
+
+func (ks *keystore) Serialize(serializer *base.Serializer) {
+	serializer.WriteInt32(int32(ks.objectType))
+	serializer.WriteInt64(int64(ks.kdf.Time))
+	serializer.WriteInt64(int64(ks.kdf.Memory))
+	serializer.WriteInt64(int64(ks.kdf.Threads))
+	serializer.WriteBytesWithLength(ks.salt)
+	serializer.WriteBytesWithLength(ks.wrappedKey)
+	serializer.WriteBytesWithLength(ks.ciphertext)
+}
+
+func (ks *keystore) Deserialize(deserializer *base.DeSerializer) error {
+	var objectType int32
+	_, err := deserializer.ReadInt32(&objectType)
+	if err != nil {
+		return err
+	}
+	ks.objectType = ObjectType(objectType)
+	var fields [3]int64
+	for i := range fields {
+		if _, err = deserializer.ReadInt64(&fields[i]); err != nil {
+			return err
+		}
+		if fields[i] < 0 || fields[i] > maxKDFMemory {
+			return fmt.Errorf("%w: bad kdf params", ErrInvalidFormat)
+		}
+	}
+	if fields[2] > maxKDFThreads {
+		return fmt.Errorf("%w: bad kdf params", ErrInvalidFormat)
+	}
+	ks.kdf = KDFParams{Time: uint32(fields[0]), Memory: uint32(fields[1]), Threads: uint8(fields[2])}
+	// 旧文件可能使用较弱的参数，打开时只检查上限
+	if err = ks.kdf.check(); err != nil {
+		return err
+	}
+	for _, field := range []*[]byte{&ks.salt, &ks.wrappedKey, &ks.ciphertext} {
+		if _, err = deserializer.ReadBytesWithLength(field); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidFormat, err)
+		}
+	}
+	if len(ks.salt) != keystoreSaltSize {
+		return fmt.Errorf("%w: bad salt size", ErrInvalidFormat)
+	}
+	return nil
+}
+
+// wrappingKey derives the key encrypting the data key from the passphrase
+func (ks *keystore) wrappingKey(passphrase []byte) []byte {
+	return argon2.IDKey(passphrase, ks.salt, ks.kdf.Time, ks.kdf.Memory, ks.kdf.Threads, chacha20poly1305.KeySize)
+}
+
+// seal encrypts the message with XChaCha20-Poly1305 under a random nonce
+func seal(key, message, additionalData []byte) ([]byte, error) {
+	aead, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(message)+aead.Overhead())
+	if _, err = rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, message, additionalData), nil
+}
+
+// open decrypts a message sealed by seal
+func open(key, sealed, additionalData []byte) ([]byte, error) {
+	aead, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("cpk: sealed message too short")
+	}
+	return aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], additionalData)
+}
+
+// wrap derives a wrapping key from the passphrase with a fresh salt and encrypts the data key
+func (ks *keystore) wrap(passphrase, dataKey []byte, kdf KDFParams) error {
+	if err := kdf.Validate(); err != nil {
+		return err
+	}
+	ks.kdf = kdf
+	ks.salt = make([]byte, keystoreSaltSize)
+	if _, err := rand.Read(ks.salt); err != nil {
+		return err
+	}
+	wrappedKey, err := seal(ks.wrappingKey(passphrase), dataKey, ks.keyAdditionalData())
+	if err != nil {
+		return err
+	}
+	ks.wrappedKey = wrappedKey
+	return nil
+}
+
+// unwrap returns the data key, ErrWrongPassphrase when the passphrase does not match
+func (ks *keystore) unwrap(passphrase []byte) ([]byte, error) {
+	dataKey, err := open(ks.wrappingKey(passphrase), ks.wrappedKey, ks.keyAdditionalData())
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+	return dataKey, nil
+}
+
+func (ks *keystore) marshal() []byte {
+	var serializer base.Serializer
+	ks.Serialize(&serializer)
+	return sealContainer(Header{Version: FormatVersion, ObjectType: ObjectKeystore}, serializer)
+}
+
+func unmarshalKeystore(data []byte) (*keystore, error) {
+	_, deserializer, err := openObject(data, ObjectKeystore)
+	if err != nil {
+		return nil, err
+	}
+	var ks keystore
+	if err = ks.Deserialize(deserializer); err != nil {
+		return nil, err
+	}
+	if err = checkConsumed(deserializer); err != nil {
+		return nil, err
+	}
+	return &ks, nil
+}
+
+// sealKeystore encrypts the container encoding of the object under a random data key
+func sealKeystore(objectType ObjectType, plaintext, passphrase []byte, kdf KDFParams) ([]byte, error) {
+	ks := keystore{objectType: objectType}
+	dataKey := make([]byte, chacha20poly1305.KeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, err
+	}
+	defer wipe(dataKey)
+	if err := ks.wrap(passphrase, dataKey, kdf); err != nil {
+		return nil, err
+	}
+	ciphertext, err := seal(dataKey, plaintext, ks.objectAdditionalData())
+	if err != nil {
+		return nil, err
+	}
+	ks.ciphertext = ciphertext
+	return ks.marshal(), nil
+}
+
+// openKeystore decrypts the container encoding of the object stored in the keystore
+func openKeystore(data []byte, objectType ObjectType, passphrase []byte) ([]byte, error) {
+	ks, err := unmarshalKeystore(data)
+	if err != nil {
+		return nil, err
+	}
+	if ks.objectType != objectType {
+		return nil, fmt.Errorf("%w: keystore holds %s, expected %s", ErrInvalidFormat, ks.objectType, objectType)
+	}
+	dataKey, err := ks.unwrap(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	defer wipe(dataKey)
+	plaintext, err := open(dataKey, ks.ciphertext, ks.objectAdditionalData())
+	if err != nil {
+		return nil, fmt.Errorf("%w: cannot decrypt keystore", ErrInvalidFormat)
+	}
+	return plaintext, nil
+}
+
+func wipe(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
+
+// SealCA encrypts the CA into a keystore protected by the passphrase
+func SealCA(ca *CA, passphrase []byte, kdf KDFParams) ([]byte, error) {
+	plaintext, err := ca.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	defer wipe(plaintext)
+	return sealKeystore(ObjectCA, plaintext, passphrase, kdf)
+}
+
+// OpenCA decrypts a CA sealed by SealCA
+func OpenCA(data, passphrase []byte) (*CA, error) {
+	plaintext, err := openKeystore(data, ObjectCA, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	defer wipe(plaintext)
+	var ca CA
+	if err = ca.UnmarshalBinary(plaintext); err != nil {
+		return nil, err
+	}
+	return &ca, nil
+}
+
+// SealDistributedCA encrypts the distributed CA into a keystore protected by the passphrase
+func SealDistributedCA(distributedCA *DistributedCA, passphrase []byte, kdf KDFParams) ([]byte, error) {
+	plaintext, err := distributedCA.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	defer wipe(plaintext)
+	return sealKeystore(ObjectDistributedCA, plaintext, passphrase, kdf)
+}
+
+// OpenDistributedCA decrypts a distributed CA sealed by SealDistributedCA
+func OpenDistributedCA(data, passphrase []byte) (*DistributedCA, error) {
+	plaintext, err := openKeystore(data, ObjectDistributedCA, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	defer wipe(plaintext)
+	var distributedCA DistributedCA
+	if err = distributedCA.UnmarshalBinary(plaintext); err != nil {
+		return nil, err
+	}
+	return &distributedCA, nil
+}
+
+// ChangePassphrase re-wraps the data key of the keystore under the new passphrase with a
+// fresh salt and the given KDF params, the encrypted object is kept as is
+func ChangePassphrase(data, oldPassphrase, newPassphrase []byte, kdf KDFParams) ([]byte, error) {
+	ks, err := unmarshalKeystore(data)
+	if err != nil {
+		return nil, err
+	}
+	dataKey, err := ks.unwrap(oldPassphrase)
+	if err != nil {
+		return nil, err
+	}
+	defer wipe(dataKey)
+	if err = ks.wrap(newPassphrase, dataKey, kdf); err != nil {
+		return nil, err
+	}
+	return ks.marshal(), nil
+}
@@ -0,0 +1,125 @@
+package cpk
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+// 测试中使用允许的最小 KDF 参数
+var testKDFParams = KDFParams{Time: minKDFTime, Memory: minKDFMemory, Threads: 4}
+
+func TestKeystore(t *testing.T) {
+	var ca CA
+	require.NoError(t, ca.InitCA("gen_key"))
+	expected, err := ca.QuerySK("alice")
+	require.NoError(t, err)
+	data, err := SealCA(&ca, []byte("correct horse"), testKDFParams)
+	require.NoError(t, err)
+	// 密钥库中不包含明文私钥矩阵
+	require.False(t, bytes.Contains(data, ca.privateMatrix[0].Bytes()))
+	header, err := ReadHeader(data)
+	require.NoError(t, err)
+	require.Equal(t, ObjectKeystore, header.ObjectType)
+
+	opened, err := OpenCA(data, []byte("correct horse"))
+	require.NoError(t, err)
+	sk, err := opened.QuerySK("alice")
+	require.NoError(t, err)
+	require.Equal(t, 1, sk.Scalar.Equal(expected.Scalar))
+	_, err = OpenCA(data, []byte("wrong horse"))
+	require.ErrorIs(t, err, ErrWrongPassphrase)
+	_, err = OpenDistributedCA(data, []byte("correct horse"))
+	require.ErrorIs(t, err, ErrInvalidFormat)
+
+	changed, err := ChangePassphrase(data, []byte("correct horse"), []byte("battery staple"), testKDFParams)
+	require.NoError(t, err)
+	_, err = OpenCA(changed, []byte("correct horse"))
+	require.ErrorIs(t, err, ErrWrongPassphrase)
+	opened, err = OpenCA(changed, []byte("battery staple"))
+	require.NoError(t, err)
+	sk, err = opened.QuerySK("alice")
+	require.NoError(t, err)
+	require.Equal(t, 1, sk.Scalar.Equal(expected.Scalar))
+	_, err = ChangePassphrase(data, []byte("wrong horse"), []byte("battery staple"), testKDFParams)
+	require.ErrorIs(t, err, ErrWrongPassphrase)
+
+	_, err = SealCA(&ca, []byte("correct horse"), KDFParams{Time: 1, Memory: 4, Threads: 1})
+	require.ErrorIs(t, err, ErrInvalidParams)
+	require.NoError(t, DefaultKDFParams().Validate())
+}
+
+func TestKeystore_DistributedCA(t *testing.T) {
+	var distributedCA DistributedCA
+	require.NoError(t, distributedCA.InitDistributedCA(3, "gen_key"))
+	data, err := SealDistributedCA(&distributedCA, []byte("passphrase"), testKDFParams)
+	require.NoError(t, err)
+	opened, err := OpenDistributedCA(data, []byte("passphrase"))
+	require.NoError(t, err)
+	require.Equal(t, int64(3), opened.Index)
+	require.NoError(t, opened.VerifyShares())
+	expected, err := distributedCA.QuerySK("alice")
+	require.NoError(t, err)
+	skPiece, err := opened.QuerySK("alice")
+	require.NoError(t, err)
+	require.Equal(t, expected, skPiece)
+}
+
+func TestKDFParams_Validate(t *testing.T) {
+	var ca CA
+	require.NoError(t, ca.InitCA("gen_key"))
+	data, err := SealCA(&ca, []byte("correct horse"), testKDFParams)
+	require.NoError(t, err)
+
+	// 新建密钥库与修改口令都拒绝过弱的参数
+	for _, kdf := range []KDFParams{
+		{Time: 1, Memory: 64 << 10, Threads: 4},
+		{Time: 3, Memory: 32 << 10, Threads: 4},
+		{Time: 3, Memory: 64, Threads: 1},
+	} {
+		require.ErrorIs(t, kdf.Validate(), ErrInvalidParams)
+		_, err = SealCA(&ca, []byte("correct horse"), kdf)
+		require.ErrorIs(t, err, ErrInvalidParams)
+		_, err = ChangePassphrase(data, []byte("correct horse"), []byte("battery staple"), kdf)
+		require.ErrorIs(t, err, ErrInvalidParams)
+	}
+	// RFC 9106 推荐的低内存参数可以使用，2 GiB 单轮的参数只在打开时接受
+	require.NoError(t, DefaultKDFParams().Validate())
+	require.NoError(t, KDFParams{Time: 1, Memory: 2 << 20, Threads: 4}.check())
+	for _, kdf := range []KDFParams{
+		{Time: 17, Memory: 64 << 10, Threads: 4},
+		{Time: 2, Memory: 4 << 20, Threads: 4},
+		{Time: 4, Memory: 2 << 20, Threads: 4},
+		{Time: 2, Memory: 64 << 10, Threads: 32},
+	} {
+		require.ErrorIs(t, kdf.Validate(), ErrInvalidParams)
+	}
+
+	// 打开时接受旧文件的弱参数，拒绝过大的参数
+	ks, err := unmarshalKeystore(data)
+	require.NoError(t, err)
+	dataKey, err := ks.unwrap([]byte("correct horse"))
+	require.NoError(t, err)
+	for _, c := range []struct {
+		kdf KDFParams
+		ok  bool
+	}{
+		{KDFParams{Time: 1, Memory: 64, Threads: 1}, true},
+		{KDFParams{Time: 4, Memory: 2 << 20, Threads: 4}, false},
+		{KDFParams{Time: 64, Memory: 64, Threads: 1}, false},
+	} {
+		crafted := *ks
+		crafted.kdf = c.kdf
+		// 过大的参数在派生密钥之前就被拒绝，不必重新包装
+		if c.ok {
+			crafted.wrappedKey, err = seal(crafted.wrappingKey([]byte("correct horse")), dataKey, crafted.keyAdditionalData())
+			require.NoError(t, err)
+		}
+		_, err = OpenCA(crafted.marshal(), []byte("correct horse"))
+		if c.ok {
+			require.NoError(t, err)
+		} else {
+			require.ErrorIs(t, err, ErrInvalidParams)
+		}
+	}
+}
@@ -0,0 +1,288 @@
+package cpk
+
+import (
+	"encoding/hex"
+	"github.com/walegarrett/cpk-algs/base"
+	"golang.org/x/crypto/blake2b"
+	"strings"
+	"time"
+)
+
+const (
+	// 公钥矩阵指纹与清单签名的域标签
+	fingerprintTag = "cpk-matrix-fingerprint-v1"
+	manifestTag    = "cpk-matrix-manifest-v1"
+)
+
+// Fingerprint is the BLAKE2b-256 digest of the matrix params and the public matrix
+type Fingerprint [32]byte
+
+// MatrixFingerprint returns the fingerprint of the public matrix with the given layout
+func MatrixFingerprint(params Params, publicMatrix []base.Ed25519Point) (Fingerprint, error) {
+	if err := params.Validate(); err != nil {
+		return Fingerprint{}, err
+	}
+	if err := checkPoints(publicMatrix, params.Size()); err != nil {
+		return Fingerprint{}, err
+	}
+	var serializer base.Serializer
+	serializer.WriteString(fingerprintTag)
+	params.Serialize(&serializer)
+	serializer.WriteInt64(int64(len(publicMatrix)))
+	for index := range publicMatrix {
+		serializer.WriteSerializable(&publicMatrix[index])
+	}
+	return blake2b.Sum256(serializer), nil
+}
+
+// String returns the fingerprint as groups of four hex digits for out-of-band comparison
+func (fingerprint Fingerprint) String() string {
+	encoded := hex.EncodeToString(fingerprint[:])
+	groups := make([]string, 0, len(encoded)/4)
+	for i := 0; i < len(encoded); i += 4 {
+		groups = append(groups, encoded[i:i+4])
+	}
+	return strings.Join(groups, " ")
+}
+
+// Manifest describes a public matrix and is signed by the root key of the CA
+type Manifest struct {
+	Params      Params      `json:"params"`
+	Fingerprint Fingerprint `json:"fingerprint"`
+	// 公钥矩阵版本号，由 CA 维护
+	Version int64 `json:"version"`
+	// 创建时间，精确到秒
+	CreatedAt time.Time       `json:"createdAt"`
+	Signature *base.Signature `json:"signature,omitempty"`
+}
+
+// NewManifest returns an unsigned manifest of the public matrix
+func NewManifest(params Params, publicMatrix []base.Ed25519Point, version int64, createdAt time.Time) (*Manifest, error) {
+	fingerprint, err := MatrixFingerprint(params, publicMatrix)
+	if err != nil {
+		return nil, err
+	}
+	return &Manifest{
+		Params:      params,
+		Fingerprint: fingerprint,
+		Version:     version,
+		CreatedAt:   time.Unix(createdAt.Unix(), 0).UTC(),
+	}, nil
+}
+
+// signedBytes returns the encoding covered by the root signature
+func (manifest *Manifest) signedBytes() []byte {
+	var serializer base.Serializer
+	serializer.WriteString(manifestTag)
+	manifest.Params.Serialize(&serializer)
+	serializer.WriteBytes(manifest.Fingerprint[:])
+	serializer.WriteInt64(manifest.Version)
+	serializer.WriteInt64(manifest.CreatedAt.Unix())
+	return serializer
+}
+
+// Sign signs the manifest with the root private key
+func (manifest *Manifest) Sign(root *base.PrivateKey) {
+	manifest.Signature = root.Sign(manifest.signedBytes())
+}
+
+// Verify checks the signature of the manifest against the root public key
+func (manifest *Manifest) Verify(root base.PublicKey) error {
+	if root.Point == nil || manifest.Signature == nil {
+		return ErrInvalidManifest
+	}
+	if err := manifest.Params.Validate(); err != nil {
+		return err
+	}
+	if !root.Verify(manifest.signedBytes(), manifest.Signature) {
+		return ErrInvalidManifest
+	}
+	return nil
+}
+
+// Check verifies the manifest against the root public key and checks that it describes the public matrix
+func (manifest *Manifest) Check(root base.PublicKey, publicMatrix []base.Ed25519Point) error {
+	if err := manifest.Verify(root); err != nil {
+		return err
+	}
+	fingerprint, err := MatrixFingerprint(manifest.Params, publicMatrix)
+	if err != nil {
+		return err
+	}
+	if fingerprint != manifest.Fingerprint {
+		return ErrFingerprintMismatch
+	}
+	return nil
+}
+
+func (manifest *Manifest) Serialize(serializer *base.Serializer) {
+	manifest.Params.Serialize(serializer)
+	serializer.WriteBytes(manifest.Fingerprint[:])
+	serializer.WriteInt64(manifest.Version)
+	serializer.WriteInt64(manifest.CreatedAt.Unix())
+	serializer.WriteBool(manifest.Signature != nil)
+	if manifest.Signature != nil {
+		serializer.WriteSerializable(manifest.Signature)
+	}
+}
+
+func (manifest *Manifest) Deserialize(deserializer *base.DeSerializer) error {
+	err := manifest.Params.Deserialize(deserializer)
+	if err != nil {
+		return err
+	}
+	_, err = deserializer.ReadBytes(manifest.Fingerprint[:], uint64(len(manifest.Fingerprint)))
+	if err != nil {
+		return err
+	}
+	_, err = deserializer.ReadInt64(&(manifest.Version))
+	if err != nil {
+		return err
+	}
+	var createdAt int64
+	_, err = deserializer.ReadInt64(&createdAt)
+	if err != nil {
+		return err
+	}
+	manifest.CreatedAt = time.Unix(createdAt, 0).UTC()
+	var signed bool
+	_, err = deserializer.ReadBool(&signed)
+	if err != nil {
+		return err
+	}
+	manifest.Signature = nil
+	if signed {
+		manifest.Signature = &base.Signature{}
+		_, err = deserializer.ReadSerializable(manifest.Signature)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ExportManifest returns the manifest of the public matrix signed with the root private key
+func (ca *CA) ExportManifest(root *base.PrivateKey, version int64) (*Manifest, error) {
+	var client Client
+	if err := ca.ExportPublicMatrixForClient(&client); err != nil {
+		return nil, err
+	}
+	manifest, err := NewManifest(ca.Params(), client.publicMatrix, version, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	manifest.Sign(root)
+	return manifest, nil
+}
+
+// PinRoot pins the root public key, afterwards the client only loads public matrices
+// with a manifest signed by the root
+func (client *Client) PinRoot(root base.PublicKey) {
+	client.root = &root
+}
+
+// requireUnpinned rejects loading an unsigned matrix into a client with a pinned root
+func (client *Client) requireUnpinned() error {
+	if client.root != nil {
+		return ErrManifestRequired
+	}
+	return nil
+}
+
+// LoadSignedMatrix loads the public matrix after checking its manifest against the pinned root
+func (client *Client) LoadSignedMatrix(manifest *Manifest, publicMatrix []base.Ed25519Point) error {
+	if client.root == nil {
+		return ErrRootNotPinned
+	}
+	if manifest == nil {
+		return ErrManifestRequired
+	}
+	if err := manifest.Check(*client.root, publicMatrix); err != nil {
+		return err
+	}
+	client.params = manifest.Params
+	client.publicMatrix = make([]base.Ed25519Point, len(publicMatrix))
+	copy(client.publicMatrix, publicMatrix)
+	client.pmPieces = nil
+	client.manifest = manifest
+	client.precompute()
+	return nil
+}
+
+// CombineSignedPMPieces combines the public matrix from the pieces and checks it against
+// the manifest signed by the pinned root
+func (client *Client) CombineSignedPMPieces(manifest *Manifest, pmPieces []PMPiece) error {
+	if client.root == nil {
+		return ErrRootNotPinned
+	}
+	if manifest == nil {
+		return ErrManifestRequired
+	}
+	if err := manifest.Verify(*client.root); err != nil {
+		return err
+	}
+	publicMatrix, pieces, err := combinePMPieces(manifest.Params, pmPieces)
+	if err != nil {
+		return err
+	}
+	if err = client.LoadSignedMatrix(manifest, publicMatrix); err != nil {
+		return err
+	}
+	client.pmPieces = pieces
+	return nil
+}
+
+// Manifest returns the manifest of the loaded public matrix, nil when it was loaded unsigned
+func (client *Client) Manifest() *Manifest {
+	return client.manifest
+}
+
+// Fingerprint returns the fingerprint of the loaded public matrix
+func (client *Client) Fingerprint() (Fingerprint, error) {
+	if len(client.cachedMatrix) != client.Params().Size() {
+		return Fingerprint{}, ErrMatrixNotLoaded
+	}
+	return client.fingerprint, nil
+}
+
+// SerializeSigned writes the manifest followed by the public matrix
+func (client *Client) SerializeSigned(serializer *base.Serializer) error {
+	if client.manifest == nil {
+		return ErrManifestRequired
+	}
+	client.manifest.Serialize(serializer)
+	serializer.WriteInt64(int64(len(client.publicMatrix)))
+	for index := range client.publicMatrix {
+		serializer.WriteSerializable(&client.publicMatrix[index])
+	}
+	return nil
+}
+
+// DeserializeSigned reads a manifest and a public matrix written by SerializeSigned and
+// loads them after checking the manifest against the pinned root
+func (client *Client) DeserializeSigned(deserializer *base.DeSerializer) error {
+	if client.root == nil {
+		return ErrRootNotPinned
+	}
+	var manifest Manifest
+	err := manifest.Deserialize(deserializer)
+	if err != nil {
+		return err
+	}
+	if err = manifest.Verify(*client.root); err != nil {
+		return err
+	}
+	var l int64
+	_, err = deserializer.ReadInt64(&l)
+	if err != nil {
+		return err
+	}
+	if l != int64(manifest.Params.Size()) {
+		return &ErrMatrixSizeMismatch{Expected: manifest.Params.Size(), Actual: int(l)}
+	}
+	publicMatrix, err := readPoints(deserializer, l)
+	if err != nil {
+		return err
+	}
+	return client.LoadSignedMatrix(&manifest, publicMatrix)
+}
@@ -0,0 +1,107 @@
+package cpk
+
+import (
+	"github.com/stretchr/testify/require"
+	"github.com/walegarrett/cpk-algs/base"
+	"testing"
+	"time"
+)
+
+func TestManifest(t *testing.T) {
+	var ca CA
+	require.NoError(t, ca.InitCA("gen_key"))
+	root := base.RandomPrivateKey()
+	manifest, err := ca.ExportManifest(&root, 1)
+	require.NoError(t, err)
+
+	var unsigned Client
+	require.NoError(t, ca.ExportPublicMatrixForClient(&unsigned))
+	fingerprint, err := unsigned.Fingerprint()
+	require.NoError(t, err)
+	require.Equal(t, manifest.Fingerprint, fingerprint)
+	require.Len(t, fingerprint.String(), 32*2+15)
+
+	client := Client{}
+	client.PinRoot(root.Public())
+	require.NoError(t, client.LoadSignedMatrix(manifest, unsigned.QueryPublicKeyMatrix()))
+	require.Equal(t, manifest, client.Manifest())
+	pk, err := client.QueryPK("alice")
+	require.NoError(t, err)
+	sk, err := ca.QuerySK("alice")
+	require.NoError(t, err)
+	require.Equal(t, 1, pk.Equal(sk.Public().Point))
+
+	// 序列化后由固定同一根公钥的客户端加载
+	var serializer base.Serializer
+	require.NoError(t, client.SerializeSigned(&serializer))
+	deserializer, err := base.NewDeserializer(serializer)
+	require.NoError(t, err)
+	loaded := Client{}
+	loaded.PinRoot(root.Public())
+	require.NoError(t, loaded.DeserializeSigned(deserializer))
+	require.Equal(t, manifest.Version, loaded.Manifest().Version)
+	require.Equal(t, manifest.CreatedAt, loaded.Manifest().CreatedAt)
+
+	// 其他根密钥签名的清单
+	other := base.RandomPrivateKey()
+	forged, err := NewManifest(ca.Params(), unsigned.QueryPublicKeyMatrix(), 2, time.Now())
+	require.NoError(t, err)
+	forged.Sign(&other)
+	require.ErrorIs(t, client.LoadSignedMatrix(forged, unsigned.QueryPublicKeyMatrix()), ErrInvalidManifest)
+	deserializer, err = base.NewDeserializer(serializer)
+	require.NoError(t, err)
+	require.ErrorIs(t, (&Client{root: &base.PublicKey{Point: other.Public().Point}}).DeserializeSigned(deserializer), ErrInvalidManifest)
+
+	// 被替换的公钥矩阵
+	var swapped CA
+	require.NoError(t, swapped.InitCA("attacker"))
+	var attacker Client
+	require.NoError(t, swapped.ExportPublicMatrixForClient(&attacker))
+	require.ErrorIs(t, client.LoadSignedMatrix(manifest, attacker.QueryPublicKeyMatrix()), ErrFingerprintMismatch)
+	// 篡改版本号后签名失效
+	tampered := *manifest
+	tampered.Version = 7
+	require.ErrorIs(t, client.LoadSignedMatrix(&tampered, unsigned.QueryPublicKeyMatrix()), ErrInvalidManifest)
+
+	// 固定根公钥后拒绝未签名的公钥矩阵
+	serializer = base.Serializer{}
+	unsigned.Serialize(&serializer)
+	deserializer, err = base.NewDeserializer(serializer)
+	require.NoError(t, err)
+	require.ErrorIs(t, client.Deserialize(deserializer), ErrManifestRequired)
+	require.ErrorIs(t, swapped.ExportPublicMatrixForClient(&client), ErrManifestRequired)
+	require.ErrorIs(t, unsigned.LoadSignedMatrix(manifest, unsigned.QueryPublicKeyMatrix()), ErrRootNotPinned)
+	pk, err = client.QueryPK("alice")
+	require.NoError(t, err)
+	require.Equal(t, 1, pk.Equal(sk.Public().Point))
+}
+
+func TestClient_CombineSignedPMPieces(t *testing.T) {
+	var ca CA
+	require.NoError(t, ca.InitCA("gen_key"))
+	root := base.RandomPrivateKey()
+	manifest, err := ca.ExportManifest(&root, 1)
+	require.NoError(t, err)
+	var pmPieces []PMPiece
+	for i := 0; i < 4; i++ {
+		var distributedCA DistributedCA
+		require.NoError(t, distributedCA.InitDistributedCA(int64(i), "gen_key"))
+		pmPiece, err := distributedCA.ExportPublicMatrixPiece()
+		require.NoError(t, err)
+		pmPieces = append(pmPieces, pmPiece)
+	}
+	client := Client{}
+	client.PinRoot(root.Public())
+	require.ErrorIs(t, client.CombinePMPieces(pmPieces), ErrManifestRequired)
+	require.NoError(t, client.CombineSignedPMPieces(manifest, pmPieces[:2]))
+	_, err = client.PartialPK("alice", 1)
+	require.NoError(t, err)
+
+	var attacker [2]DistributedCA
+	for i := range attacker {
+		require.NoError(t, attacker[i].InitDistributedCA(int64(i), "attacker"))
+		pmPieces[i], err = attacker[i].ExportPublicMatrixPiece()
+		require.NoError(t, err)
+	}
+	require.ErrorIs(t, client.CombineSignedPMPieces(manifest, pmPieces[:2]), ErrFingerprintMismatch)
+}
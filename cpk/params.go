@@ -0,0 +1,114 @@
+package cpk
+
+import (
+	"fmt"
+	"github.com/walegarrett/cpk-algs/base"
+	"golang.org/x/crypto/blake2b"
+)
+
+const (
+	// 参数上限，避免反序列化时按不可信的参数分配过大的内存
+	maxRows  = 1 << 12
+	maxNodes = 1 << 16
+)
+
+// Params defines the shape of the CPK matrix and how it is shared among distributed nodes
+type Params struct {
+	// 公钥矩阵行数（矩阵为 Rows x Rows 的方阵）
+	Rows int `json:"rows"`
+	// 子矩阵行数
+	SubsSize int `json:"subsSize"`
+	// 子矩阵数量，Rows = SubsSize * Blocks
+	Blocks int `json:"blocks"`
+	// 门限，任意 Threshold 个分布式节点的分片即可组合出私钥
+	Threshold int `json:"threshold"`
+	// 分布式节点数量
+	Nodes int `json:"nodes"`
+}
+
+// DefaultParams returns the 32x32 matrix layout shared 2-of-4 among distributed nodes
+func DefaultParams() Params {
+	return Params{
+		Rows:      32,
+		SubsSize:  8,
+		Blocks:    4,
+		Threshold: 2,
+		Nodes:     4,
+	}
+}
+
+// Validate checks whether the params describe a usable matrix layout
+func (params Params) Validate() error {
+	if params.Rows <= 0 || params.SubsSize <= 0 || params.Blocks <= 0 {
+		return fmt.Errorf("%w: matrix params must be positive", ErrInvalidParams)
+	}
+	if params.Rows > maxRows || params.Nodes > maxNodes {
+		return fmt.Errorf("%w: matrix rows or nodes too large", ErrInvalidParams)
+	}
+	if params.Rows != params.SubsSize*params.Blocks {
+		return fmt.Errorf("%w: rows must equal sub-matrix size times blocks", ErrInvalidParams)
+	}
+	if params.Threshold <= 0 || params.Threshold > params.Nodes {
+		return fmt.Errorf("%w: threshold must be between 1 and nodes", ErrInvalidParams)
+	}
+	return nil
+}
+
+// Size returns the number of elements in the matrix
+func (params Params) Size() int {
+	return params.Rows * params.Rows
+}
+
+// orDefault returns the default params when params is the zero value
+func (params Params) orDefault() Params {
+	if params == (Params{}) {
+		return DefaultParams()
+	}
+	return params
+}
+
+func (params *Params) Serialize(serializer *base.Serializer) {
+	serializer.WriteInt64(int64(params.Rows))
+	serializer.WriteInt64(int64(params.SubsSize))
+	serializer.WriteInt64(int64(params.Blocks))
+	serializer.WriteInt64(int64(params.Threshold))
+	serializer.WriteInt64(int64(params.Nodes))
+}
+
+func (params *Params) Deserialize(deserializer *base.DeSerializer) error {
+	var fields [5]int64
+	for i := range fields {
+		_, err := deserializer.ReadInt64(&fields[i])
+		if err != nil {
+			return err
+		}
+	}
+	params.Rows = int(fields[0])
+	params.SubsSize = int(fields[1])
+	params.Blocks = int(fields[2])
+	params.Threshold = int(fields[3])
+	params.Nodes = int(fields[4])
+	return params.Validate()
+}
+
+// selectIndices returns the matrix indices selected by the identity encoding, ordered by sub-matrix
+func (params Params) selectIndices(ident []byte) ([]int, error) {
+	sum := blake2b.Sum512(ident)
+	hs := base.NewHashstream(sum[:])
+	indices := make([]int, 0, params.Blocks*params.SubsSize)
+	for i := 0; i < params.Blocks; i++ {
+		// 遍历每一个子矩阵
+		// pi和pj用于选出本次子矩阵的开始行
+		pi := hs.ToNextIntn(params.SubsSize)
+		pj := hs.ToNextIntn(params.SubsSize)
+		// 遍历子矩阵的每一行
+		for j := 0; j < params.SubsSize; j++ {
+			// 在总矩阵中的行数
+			y := (pi+j+pj)%params.SubsSize + params.SubsSize*i
+			// 在总矩阵中的列数
+			x := hs.ToNextIntn(params.Rows)
+			indices = append(indices, params.Rows*y+x)
+		}
+	}
+	return indices, nil
+}
@@ -0,0 +1,131 @@
+package cpk
+
+import (
+	"github.com/stretchr/testify/require"
+	"github.com/walegarrett/cpk-algs/base"
+	"github.com/walegarrett/cpk-algs/base/edwards25519"
+	"strconv"
+	"testing"
+)
+
+func TestParams_Validate(t *testing.T) {
+	if err := DefaultParams().Validate(); err != nil {
+		t.Error(err)
+		return
+	}
+	bad := []Params{
+		{},
+		{Rows: 32, SubsSize: 8, Blocks: 3, Threshold: 2, Nodes: 4},
+		{Rows: 32, SubsSize: 8, Blocks: 4, Threshold: 5, Nodes: 4},
+		{Rows: 32, SubsSize: 8, Blocks: 4, Threshold: 0, Nodes: 4},
+		{Rows: 1 << 13, SubsSize: 1 << 10, Blocks: 8, Threshold: 2, Nodes: 4},
+	}
+	for _, params := range bad {
+		if params.Validate() == nil {
+			t.Error("bad params accepted:", params)
+			return
+		}
+	}
+}
+
+func TestCA_InitCAWithParams(t *testing.T) {
+	for _, params := range []Params{
+		{Rows: 64, SubsSize: 8, Blocks: 8, Threshold: 2, Nodes: 4},
+		{Rows: 48, SubsSize: 12, Blocks: 4, Threshold: 2, Nodes: 4},
+	} {
+		var ca CA
+		err := ca.InitCAWithParams(params, "genkey1")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		client := Client{}
+		require.NoError(t, ca.ExportPublicMatrixForClient(&client))
+		if rows, _ := client.QueryPublicKeyMatrixSize(); rows != params.Rows {
+			t.Error("bad client rows:", rows)
+			return
+		}
+		for i := 0; i < 4; i++ {
+			ident := "id" + strconv.Itoa(i)
+			sk, err := ca.QuerySK(ident)
+			require.NoError(t, err)
+			pk, err := client.QueryPK(ident)
+			require.NoError(t, err)
+			if pk.Point.Equal((&edwards25519.Point{}).ScalarBaseMult(sk.Scalar)) != 1 {
+				t.Error("sk not corresponding to pk")
+				return
+			}
+		}
+
+		var serializer base.Serializer
+		client.Serialize(&serializer)
+		deserializer, err := base.NewDeserializer(serializer)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		var client2 Client
+		err = client2.Deserialize(deserializer)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if client2.Params() != params {
+			t.Error("bad deserializer params:", client2.Params())
+			return
+		}
+		pk, err := client.QueryPK("id1")
+		require.NoError(t, err)
+		pk2, err := client2.QueryPK("id1")
+		require.NoError(t, err)
+		if pk2.Equal(pk.Point) != 1 {
+			t.Error("deserialized client query pk mismatch")
+			return
+		}
+	}
+}
+
+func TestDistributedCA_InitDistributedCAWithParams(t *testing.T) {
+	params := Params{Rows: 16, SubsSize: 4, Blocks: 4, Threshold: 3, Nodes: 4}
+	var distributedCAs [4]DistributedCA
+	var pmPieces []PMPiece
+	for i := range distributedCAs {
+		err := distributedCAs[i].InitDistributedCAWithParams(params, int64(i), "gen_key")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		pmPiece, err := distributedCAs[i].ExportPublicMatrixPiece()
+		require.NoError(t, err)
+		pmPieces = append(pmPieces, pmPiece)
+	}
+	client := Client{params: params}
+	require.NoError(t, client.CombinePMPieces(pmPieces))
+
+	// 使用同一个 genKey 时分片组合出的矩阵与 CA 的矩阵一致
+	var ca CA
+	err := ca.InitCAWithParams(params, "gen_key")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	sk, err := ca.QuerySK("ident")
+	require.NoError(t, err)
+	var skPieces []SKPiece
+	for i := range distributedCAs {
+		skPiece, err := distributedCAs[i].QuerySK("ident")
+		require.NoError(t, err)
+		skPieces = append(skPieces, skPiece)
+	}
+	pk, err := client.QueryPK("ident")
+	require.NoError(t, err)
+	privateKey, err := client.CombineSKPieces(skPieces, *pk)
+	if err != nil {
+		t.Error("combine private key pieces failed:", err)
+		return
+	}
+	if privateKey.Scalar.Equal(sk.Scalar) != 1 {
+		t.Error("combined private key is not equal to ca private key")
+		return
+	}
+}
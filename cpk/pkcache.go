@@ -0,0 +1,49 @@
+package cpk
+
+import (
+	"fmt"
+	"github.com/walegarrett/cpk-algs/base"
+)
+
+// PKCacheStats reports the hits and misses of the public key cache of a Client
+type PKCacheStats struct {
+	Hits   uint64
+	Misses uint64
+	// 当前缓存的公钥数量
+	Size int
+}
+
+// EnablePKCache caches up to capacity public keys returned by QueryPK and its variants,
+// the cache is keyed by the identity and the matrix fingerprint and is safe for
+// concurrent queries
+func (client *Client) EnablePKCache(capacity int) error {
+	if capacity <= 0 {
+		return fmt.Errorf("%w: cache capacity must be positive", ErrInvalidParams)
+	}
+	client.pkCache = base.NewLRU(int64(capacity), client.cachedQuery)
+	return nil
+}
+
+// PKCacheStats returns the statistics of the public key cache, zero when it is disabled
+func (client *Client) PKCacheStats() PKCacheStats {
+	if client.pkCache == nil {
+		return PKCacheStats{}
+	}
+	stats := client.pkCache.Stats()
+	return PKCacheStats{Hits: stats.Hits, Misses: stats.Misses, Size: client.pkCache.Len()}
+}
+
+// pkCacheKey returns the cache key of the identity encoding under the loaded matrix
+// 键中包含矩阵指纹，矩阵变化后旧的缓存不会再被命中
+func (client *Client) pkCacheKey(encoded []byte) string {
+	return string(client.fingerprint[:]) + string(encoded)
+}
+
+// cachedQuery is the query function of the cache, it derives the public key on a miss
+func (client *Client) cachedQuery(key string) interface{} {
+	publicKey, err := client.derivePK([]byte(key[len(client.fingerprint):]))
+	if err != nil {
+		return err
+	}
+	return publicKey
+}
@@ -0,0 +1,75 @@
+package cpk
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"testing"
+)
+
+func TestClient_EnablePKCache(t *testing.T) {
+	var ca CA
+	require.NoError(t, ca.InitCA("gen_key"))
+	client := Client{}
+	require.ErrorIs(t, client.EnablePKCache(0), ErrInvalidParams)
+	require.NoError(t, client.EnablePKCache(8))
+	_, err := client.QueryPK("alice")
+	require.ErrorIs(t, err, ErrMatrixNotLoaded)
+	require.NoError(t, ca.ExportPublicMatrixForClient(&client))
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				ident := fmt.Sprintf("device-%d", i%4)
+				pk, err := client.QueryPK(ident)
+				if !assert.NoError(t, err) {
+					return
+				}
+				sk, err := ca.QuerySK(ident)
+				if !assert.NoError(t, err) {
+					return
+				}
+				assert.Equal(t, 1, pk.Equal(sk.Public().Point))
+			}
+		}()
+	}
+	wg.Wait()
+	stats := client.PKCacheStats()
+	require.Equal(t, uint64(4), stats.Misses)
+	require.Equal(t, uint64(796), stats.Hits)
+	require.Equal(t, 4, stats.Size)
+
+	// 超出容量后淘汰最久未使用的公钥
+	for i := 0; i < 10; i++ {
+		_, err = client.QueryPK(fmt.Sprintf("user-%d", i))
+		require.NoError(t, err)
+	}
+	require.Equal(t, 8, client.PKCacheStats().Size)
+
+	// 更换矩阵后缓存自动失效
+	var other CA
+	require.NoError(t, other.InitCA("other_key"))
+	require.NoError(t, other.ExportPublicMatrixForClient(&client))
+	require.Equal(t, 0, client.PKCacheStats().Size)
+	pk, err := client.QueryPK("device-0")
+	require.NoError(t, err)
+	sk, err := other.QuerySK("device-0")
+	require.NoError(t, err)
+	require.Equal(t, 1, pk.Equal(sk.Public().Point))
+
+	// 不同域的客户端使用独立的缓存
+	mailClient, err := client.WithDomain(Domain{Namespace: "mail", Version: 1})
+	require.NoError(t, err)
+	mailCA, err := other.WithDomain(Domain{Namespace: "mail", Version: 1})
+	require.NoError(t, err)
+	pk, err = mailClient.QueryPK("device-0")
+	require.NoError(t, err)
+	sk, err = mailCA.QuerySK("device-0")
+	require.NoError(t, err)
+	require.Equal(t, 1, pk.Equal(sk.Public().Point))
+	require.Equal(t, uint64(1), mailClient.PKCacheStats().Misses)
+}
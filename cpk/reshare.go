@@ -0,0 +1,152 @@
+package cpk
+
+import (
+	"context"
+	"fmt"
+	"github.com/walegarrett/cpk-algs/base/edwards25519"
+)
+
+// ReshareConfig describes a resharing of the private matrix, every endpoint must use the same config
+type ReshareConfig struct {
+	// 当前的矩阵布局与 Feldman 承诺
+	OldParams   Params
+	Commitments *Commitments
+	// 新的矩阵布局，只能改变门限与节点数
+	NewParams Params
+}
+
+// Validate checks whether the shares of the old layout can be moved to the new layout
+func (config ReshareConfig) Validate() error {
+	if err := config.OldParams.Validate(); err != nil {
+		return err
+	}
+	if err := config.NewParams.Validate(); err != nil {
+		return err
+	}
+	old, params := config.OldParams, config.NewParams
+	if old.Rows != params.Rows || old.SubsSize != params.SubsSize || old.Blocks != params.Blocks {
+		return fmt.Errorf("%w: resharing cannot change the matrix layout", ErrInvalidParams)
+	}
+	if config.Commitments == nil {
+		return ErrCommitmentsNotLoaded
+	}
+	if config.Commitments.Threshold != old.Threshold || config.Commitments.Size() != old.Size() {
+		return &ErrMatrixSizeMismatch{Expected: old.Size(), Actual: config.Commitments.Size()}
+	}
+	return nil
+}
+
+// endpoints returns the number of endpoints taking part in the resharing
+func (config ReshareConfig) endpoints() int {
+	if config.OldParams.Nodes > config.NewParams.Nodes {
+		return config.OldParams.Nodes
+	}
+	return config.NewParams.Nodes
+}
+
+// ReshareNode moves the shares of the current nodes to the nodes of a new layout without
+// changing the private matrix, so the public matrix and the identities' keys stay the same
+//
+// 端点 i 既是当前的节点 i（如果持有分片），也是新布局中的节点 i（如果 i < NewParams.Nodes）。
+// 每个当前节点把自己的分片作为常数项重新分享，新节点用拉格朗日系数合并，得到全新的多项式
+type ReshareNode struct {
+	sharingSession
+	config ReshareConfig
+	domain Domain
+}
+
+// NewReshareNode returns the endpoint with the given index of a resharing, current is the
+// distributed CA of the endpoint or nil for a node that joins without a share
+func NewReshareNode(config ReshareConfig, index int64, current *DistributedCA) (*ReshareNode, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	if index < 0 || index >= int64(config.endpoints()) {
+		return nil, ErrIndexOutOfRange
+	}
+	node := &ReshareNode{
+		sharingSession: sharingSession{params: config.NewParams, endpoints: config.endpoints(), index: index},
+		config:         config,
+	}
+	node.checkDealer = node.checkShare
+	if current != nil {
+		if current.Index != index {
+			return nil, ErrIndexOutOfRange
+		}
+		if current.Params() != config.OldParams {
+			return nil, fmt.Errorf("%w: distributed CA not match the old params", ErrInvalidParams)
+		}
+		if len(current.privateMatrixPiece) != config.OldParams.Size() {
+			return nil, ErrMatrixNotLoaded
+		}
+		if err := config.Commitments.VerifyShares(index, current.privateMatrixPiece); err != nil {
+			return nil, err
+		}
+		node.secrets = make([]*edwards25519.Scalar, len(current.privateMatrixPiece))
+		for e := range current.privateMatrixPiece {
+			node.secrets[e] = edwards25519.NewScalar().Set(current.privateMatrixPiece[e].Scalar)
+		}
+		node.domain = current.domain
+	}
+	return node, nil
+}
+
+// checkShare checks that the dealer reshares exactly its current share
+func (node *ReshareNode) checkShare(dealer int64, commitments *Commitments) bool {
+	if dealer >= int64(node.config.OldParams.Nodes) {
+		return false
+	}
+	err := parallelFor(context.Background(), commitments.Size(), func(e int) error {
+		expected, err := node.config.Commitments.SharePublic(dealer, e)
+		if err != nil {
+			return err
+		}
+		if commitments.Points[e*commitments.Threshold].Equal(expected) != 1 {
+			return &ErrInconsistentPiece{Index: dealer, Position: e}
+		}
+		return nil
+	})
+	return err == nil
+}
+
+// Run executes the resharing with the other endpoints over the transport and returns the
+// distributed CA of the new layout, or nil for an endpoint that leaves the new layout
+func (node *ReshareNode) Run(ctx context.Context, transport DKGTransport) (*DistributedCA, error) {
+	defer node.wipe()
+	if err := node.run(ctx, transport); err != nil {
+		return nil, err
+	}
+	qualified := node.Qualified()
+	if len(qualified) < node.config.OldParams.Threshold {
+		return nil, ErrDKGFailed
+	}
+	// 集合不一致时 run 已经失败，所有完成的诚实端点的合格发起者集合相同，取前 Threshold 个插值
+	dealers := qualified[:node.config.OldParams.Threshold]
+	distributedCA, err := node.combine(dealers, lagrangeCoefficients(dealers, -1))
+	if err != nil || distributedCA == nil {
+		return distributedCA, err
+	}
+	publicMatrix := distributedCA.commitments.PublicMatrix()
+	expected := node.config.Commitments.PublicMatrix()
+	for e := range publicMatrix {
+		if publicMatrix[e].Equal(expected[e].Point) != 1 {
+			return nil, ErrDKGFailed
+		}
+	}
+	distributedCA.domain = node.domain
+	return distributedCA, nil
+}
+
+// NewRefreshNode returns the endpoint of a proactive refresh, which reshares the private
+// matrix among the same nodes so that the shares leaked before the refresh become useless
+func (distributedCA *DistributedCA) NewRefreshNode() (*ReshareNode, error) {
+	if distributedCA.commitments == nil {
+		return nil, ErrCommitmentsNotLoaded
+	}
+	config := ReshareConfig{
+		OldParams:   distributedCA.Params(),
+		Commitments: distributedCA.commitments,
+		NewParams:   distributedCA.Params(),
+	}
+	return NewReshareNode(config, distributedCA.Index, distributedCA)
+}
@@ -0,0 +1,191 @@
+package cpk
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/walegarrett/cpk-algs/base"
+	"sync"
+	"testing"
+	"time"
+)
+
+// runReshare runs the resharing with the current distributed CAs, nil for the endpoints without a share,
+// the sorted endpoints in faulty may fail
+func runReshare(t *testing.T, config ReshareConfig, current []*DistributedCA, prepare func(node *ReshareNode), faulty ...int64) []*DistributedCA {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	endpoints := config.endpoints()
+	transports := NewLocalDKGTransports(endpoints)
+	results := make([]*DistributedCA, endpoints)
+	var wg sync.WaitGroup
+	for i := 0; i < endpoints; i++ {
+		var distributedCA *DistributedCA
+		if i < len(current) {
+			distributedCA = current[i]
+		}
+		node, err := NewReshareNode(config, int64(i), distributedCA)
+		require.NoError(t, err)
+		if prepare != nil {
+			prepare(node)
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			distributedCA, err := node.Run(ctx, transports[i])
+			if !containsIndex(faulty, int64(i)) {
+				assert.NoError(t, err)
+			}
+			results[i] = distributedCA
+		}(i)
+	}
+	wg.Wait()
+	return results
+}
+
+// checkSharedMatrix checks that the distributed CAs issue the keys of the CA's matrix
+func checkSharedMatrix(t *testing.T, ca *CA, distributedCAs []*DistributedCA, nodes []int) {
+	var caClient Client
+	require.NoError(t, ca.ExportPublicMatrixForClient(&caClient))
+	pk, err := caClient.QueryPK("alice")
+	require.NoError(t, err)
+	var skPieces []SKPiece
+	var pmPieces []PMPiece
+	for _, node := range nodes {
+		require.NoError(t, distributedCAs[node].VerifyShares())
+		skPiece, err := distributedCAs[node].QuerySK("alice")
+		require.NoError(t, err)
+		skPieces = append(skPieces, skPiece)
+		pmPiece, err := distributedCAs[node].ExportPublicMatrixPiece()
+		require.NoError(t, err)
+		pmPieces = append(pmPieces, pmPiece)
+	}
+	client := Client{params: distributedCAs[nodes[0]].Params()}
+	require.NoError(t, client.CombinePMPieces(pmPieces))
+	// 指纹包含门限与节点数，逐个比较矩阵元素
+	expected := caClient.QueryPublicKeyMatrix()
+	for e, point := range client.QueryPublicKeyMatrix() {
+		require.Equal(t, 1, point.Equal(expected[e].Point))
+	}
+	_, err = client.CombineSKPieces(skPieces, *pk)
+	require.NoError(t, err)
+}
+
+func splitForReshare(t *testing.T, params Params) (*CA, []*DistributedCA) {
+	var ca CA
+	require.NoError(t, ca.InitCAWithParams(params, "gen_key"))
+	distributedCAs, err := ca.SplitDistributedCAs()
+	require.NoError(t, err)
+	current := make([]*DistributedCA, len(distributedCAs))
+	for i := range distributedCAs {
+		current[i] = &distributedCAs[i]
+	}
+	return &ca, current
+}
+
+func TestDistributedCA_NewRefreshNode(t *testing.T) {
+	params := Params{Rows: 16, SubsSize: 4, Blocks: 4, Threshold: 2, Nodes: 3}
+	ca, current := splitForReshare(t, params)
+	_, err := (&DistributedCA{params: params}).NewRefreshNode()
+	require.ErrorIs(t, err, ErrCommitmentsNotLoaded)
+
+	nodes := make([]*ReshareNode, params.Nodes)
+	transports := NewLocalDKGTransports(params.Nodes)
+	refreshed := make([]*DistributedCA, params.Nodes)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	var wg sync.WaitGroup
+	for i := range nodes {
+		nodes[i], err = current[i].NewRefreshNode()
+		require.NoError(t, err)
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			distributedCA, err := nodes[i].Run(ctx, transports[i])
+			assert.NoError(t, err)
+			refreshed[i] = distributedCA
+		}(i)
+	}
+	wg.Wait()
+	checkSharedMatrix(t, ca, refreshed, []int{2, 0})
+
+	// 刷新后分片全部改变，新旧分片不能混合使用
+	for i := range refreshed {
+		require.NotEqual(t, 1, refreshed[i].privateMatrixPiece[0].Scalar.Equal(current[i].privateMatrixPiece[0].Scalar))
+	}
+	var caClient Client
+	require.NoError(t, ca.ExportPublicMatrixForClient(&caClient))
+	pk, err := caClient.QueryPK("alice")
+	require.NoError(t, err)
+	oldPiece, err := current[0].QuerySK("alice")
+	require.NoError(t, err)
+	newPiece, err := refreshed[1].QuerySK("alice")
+	require.NoError(t, err)
+	_, err = caClient.CombineSKPieces([]SKPiece{oldPiece, newPiece}, *pk)
+	require.ErrorIs(t, err, ErrKeyMismatch)
+}
+
+func TestReshareNode_Run(t *testing.T) {
+	params := Params{Rows: 16, SubsSize: 4, Blocks: 4, Threshold: 2, Nodes: 3}
+	ca, current := splitForReshare(t, params)
+	commitments, err := current[0].ExportCommitments()
+	require.NoError(t, err)
+
+	// 扩容为 3-of-5
+	grown := Params{Rows: 16, SubsSize: 4, Blocks: 4, Threshold: 3, Nodes: 5}
+	config := ReshareConfig{OldParams: params, Commitments: commitments, NewParams: grown}
+	results := runReshare(t, config, current, nil)
+	checkSharedMatrix(t, ca, results, []int{4, 0, 3})
+	_, err = results[0].MarshalBinary()
+	require.NoError(t, err)
+
+	// 节点 1 丢失分片，其余节点为它重新生成分片
+	grownCommitments, err := results[0].ExportCommitments()
+	require.NoError(t, err)
+	lost := append([]*DistributedCA(nil), results...)
+	lost[1] = nil
+	config = ReshareConfig{OldParams: grown, Commitments: grownCommitments, NewParams: grown}
+	replaced := runReshare(t, config, lost, nil)
+	checkSharedMatrix(t, ca, replaced, []int{1, 2, 4})
+
+	// 缩减为 2-of-2，节点 2 至 4 退出
+	shrunk := Params{Rows: 16, SubsSize: 4, Blocks: 4, Threshold: 2, Nodes: 2}
+	replacedCommitments, err := replaced[0].ExportCommitments()
+	require.NoError(t, err)
+	config = ReshareConfig{OldParams: grown, Commitments: replacedCommitments, NewParams: shrunk}
+	results = runReshare(t, config, replaced, nil)
+	for i := 2; i < len(results); i++ {
+		require.Nil(t, results[i])
+	}
+	checkSharedMatrix(t, ca, results, []int{1, 0})
+}
+
+func TestReshareNode_RejectsWrongSecret(t *testing.T) {
+	params := Params{Rows: 16, SubsSize: 4, Blocks: 4, Threshold: 2, Nodes: 3}
+	ca, current := splitForReshare(t, params)
+	commitments, err := current[0].ExportCommitments()
+	require.NoError(t, err)
+	config := ReshareConfig{OldParams: params, Commitments: commitments, NewParams: params}
+
+	_, err = NewReshareNode(config, 3, nil)
+	require.ErrorIs(t, err, ErrIndexOutOfRange)
+	_, err = NewReshareNode(config, 1, current[0])
+	require.ErrorIs(t, err, ErrIndexOutOfRange)
+	changed := config
+	changed.NewParams = Params{Rows: 8, SubsSize: 4, Blocks: 2, Threshold: 2, Nodes: 3}
+	_, err = NewReshareNode(changed, 0, current[0])
+	require.ErrorIs(t, err, ErrInvalidParams)
+
+	// 节点 0 重新分享的不是自己的分片，被其他节点取消资格
+	var nodes []*ReshareNode
+	results := runReshare(t, config, current, func(node *ReshareNode) {
+		if node.index == 0 {
+			node.secrets[0] = base.RandomPrivateKey().Scalar
+		}
+		nodes = append(nodes, node)
+	}, 0)
+	for _, node := range nodes[1:] {
+		require.Equal(t, []int64{1, 2}, node.Qualified())
+	}
+	checkSharedMatrix(t, ca, results, []int{1, 2})
+}
@@ -0,0 +1,433 @@
+package cpk
+
+import (
+	"fmt"
+	"github.com/walegarrett/cpk-algs/base"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 带版本签名的域标签
+const versionedSignTag = "cpk-versioned-sign-v1"
+
+// MatrixWindow is the period in which a matrix version issues and verifies keys, a zero
+// time leaves the bound open
+type MatrixWindow struct {
+	NotBefore time.Time
+	NotAfter  time.Time
+}
+
+// Validate checks that the window is not empty
+func (window MatrixWindow) Validate() error {
+	if !window.NotBefore.IsZero() && !window.NotAfter.IsZero() && !window.NotAfter.After(window.NotBefore) {
+		return fmt.Errorf("%w: window ends before it starts", ErrInvalidParams)
+	}
+	return nil
+}
+
+// Contains reports whether t is within [NotBefore, NotAfter)
+func (window MatrixWindow) Contains(t time.Time) bool {
+	if !window.NotBefore.IsZero() && t.Before(window.NotBefore) {
+		return false
+	}
+	if !window.NotAfter.IsZero() && !t.Before(window.NotAfter) {
+		return false
+	}
+	return true
+}
+
+// MatrixVersion identifies a version of the matrix and its window
+type MatrixVersion struct {
+	Fingerprint Fingerprint
+	Window      MatrixWindow
+}
+
+// sortVersions orders the versions by the start of their windows, the newest first
+func sortVersions(versions []MatrixVersion) {
+	sort.SliceStable(versions, func(i, j int) bool {
+		return versions[i].Window.NotBefore.After(versions[j].Window.NotBefore)
+	})
+}
+
+// VersionedSignature is a signature tagged with the matrix version of the signing key
+type VersionedSignature struct {
+	Version   Fingerprint
+	Signature base.Signature
+}
+
+func (sig *VersionedSignature) Serialize(serializer *base.Serializer) {
+	serializer.WriteBytes(sig.Version[:])
+	serializer.WriteSerializable(&sig.Signature)
+}
+
+func (sig *VersionedSignature) Deserialize(deserializer *base.DeSerializer) error {
+	_, err := deserializer.ReadBytes(sig.Version[:], uint64(len(sig.Version)))
+	if err != nil {
+		return err
+	}
+	_, err = deserializer.ReadSerializable(&sig.Signature)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// versionedMessage binds the message to the matrix version, a signature cannot be moved
+// to another version
+func versionedMessage(version Fingerprint, m []byte) []byte {
+	var serializer base.Serializer
+	serializer.WriteString(versionedSignTag)
+	serializer.WriteBytes(version[:])
+	serializer.WriteBytesWithLength(m)
+	return serializer
+}
+
+// VersionedKx is the header of a key exchange, it tells the recipient which matrix
+// version the key exchange was made with
+type VersionedKx struct {
+	Version Fingerprint
+	Sent    []byte
+}
+
+func (kx *VersionedKx) Serialize(serializer *base.Serializer) {
+	serializer.WriteBytes(kx.Version[:])
+	serializer.WriteBytesWithLength(kx.Sent)
+}
+
+func (kx *VersionedKx) Deserialize(deserializer *base.DeSerializer) error {
+	_, err := deserializer.ReadBytes(kx.Version[:], uint64(len(kx.Version)))
+	if err != nil {
+		return err
+	}
+	_, err = deserializer.ReadBytesWithLength(&kx.Sent)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// VersionedPrivateKey is a private key with the matrix version that issued it
+type VersionedPrivateKey struct {
+	Version    Fingerprint
+	PrivateKey base.PrivateKey
+}
+
+// Sign signs the message bound to the matrix version of the key
+func (priv *VersionedPrivateKey) Sign(m []byte) *VersionedSignature {
+	sig := priv.PrivateKey.Sign(versionedMessage(priv.Version, m))
+	return &VersionedSignature{Version: priv.Version, Signature: *sig}
+}
+
+// KxReceive derives the key exchanged by the sender of the header
+func (priv *VersionedPrivateKey) KxReceive(header *VersionedKx) ([64]byte, error) {
+	if header.Version != priv.Version {
+		return [64]byte{}, ErrVersionMismatch
+	}
+	return priv.PrivateKey.KxReceive(header.Sent)
+}
+
+// versionSet holds the matrix versions of a client besides its own matrix
+type versionSet struct {
+	mu sync.RWMutex
+	// 客户端自身矩阵的有效期
+	primary MatrixWindow
+	clients map[Fingerprint]*Client
+	windows map[Fingerprint]MatrixWindow
+}
+
+func newVersionSet() *versionSet {
+	return &versionSet{clients: make(map[Fingerprint]*Client), windows: make(map[Fingerprint]MatrixWindow)}
+}
+
+// withDomain returns a copy of the set whose versions map identities within the domain
+func (versions *versionSet) withDomain(domain Domain) (*versionSet, error) {
+	versions.mu.RLock()
+	defer versions.mu.RUnlock()
+	res := newVersionSet()
+	res.primary = versions.primary
+	for fingerprint, client := range versions.clients {
+		version, err := client.WithDomain(domain)
+		if err != nil {
+			return nil, err
+		}
+		res.clients[fingerprint] = version
+		res.windows[fingerprint] = versions.windows[fingerprint]
+	}
+	return res, nil
+}
+
+// AddVersion adds the matrix of the other client as a version valid within the window,
+// adding a version again replaces its window, the client's own matrix must be loaded
+//
+// 客户端固定了根公钥时，版本必须携带由该根公钥签名且与矩阵一致的清单
+func (client *Client) AddVersion(version *Client, window MatrixWindow) error {
+	if err := window.Validate(); err != nil {
+		return err
+	}
+	fingerprint, err := version.Fingerprint()
+	if err != nil {
+		return err
+	}
+	if client.root != nil {
+		if version.manifest == nil {
+			return ErrManifestRequired
+		}
+		if err = version.manifest.Check(*client.root, version.publicMatrix); err != nil {
+			return err
+		}
+	}
+	own, err := client.Fingerprint()
+	if err != nil {
+		return err
+	}
+	if own == fingerprint {
+		return client.SetVersionWindow(fingerprint, window)
+	}
+	// 版本使用本客户端的身份域
+	version, err = version.WithDomain(client.domain)
+	if err != nil {
+		return err
+	}
+	client.versions.mu.Lock()
+	defer client.versions.mu.Unlock()
+	client.versions.clients[fingerprint] = version
+	client.versions.windows[fingerprint] = window
+	return nil
+}
+
+// SetVersionWindow changes the window of a version, including the client's own matrix
+func (client *Client) SetVersionWindow(fingerprint Fingerprint, window MatrixWindow) error {
+	if err := window.Validate(); err != nil {
+		return err
+	}
+	own, err := client.Fingerprint()
+	if err != nil {
+		return err
+	}
+	client.versions.mu.Lock()
+	defer client.versions.mu.Unlock()
+	if own == fingerprint {
+		client.versions.primary = window
+		return nil
+	}
+	if _, ok := client.versions.clients[fingerprint]; !ok {
+		return ErrUnknownVersion
+	}
+	client.versions.windows[fingerprint] = window
+	return nil
+}
+
+// RemoveVersion retires a version added with AddVersion
+func (client *Client) RemoveVersion(fingerprint Fingerprint) {
+	if client.versions == nil {
+		return
+	}
+	client.versions.mu.Lock()
+	defer client.versions.mu.Unlock()
+	delete(client.versions.clients, fingerprint)
+	delete(client.versions.windows, fingerprint)
+}
+
+// Versions returns the versions known to the client, the newest window first
+func (client *Client) Versions() []MatrixVersion {
+	var versions []MatrixVersion
+	if own, err := client.Fingerprint(); err == nil {
+		version := MatrixVersion{Fingerprint: own}
+		if client.versions != nil {
+			client.versions.mu.RLock()
+			version.Window = client.versions.primary
+			client.versions.mu.RUnlock()
+		}
+		versions = append(versions, version)
+	}
+	if client.versions != nil {
+		client.versions.mu.RLock()
+		for fingerprint, window := range client.versions.windows {
+			versions = append(versions, MatrixVersion{Fingerprint: fingerprint, Window: window})
+		}
+		client.versions.mu.RUnlock()
+	}
+	sortVersions(versions)
+	return versions
+}
+
+// Version returns the client of the matrix version and its window
+func (client *Client) Version(fingerprint Fingerprint) (*Client, MatrixWindow, error) {
+	var window MatrixWindow
+	if client.versions != nil {
+		client.versions.mu.RLock()
+		defer client.versions.mu.RUnlock()
+		window = client.versions.primary
+	}
+	if own, err := client.Fingerprint(); err == nil && own == fingerprint {
+		return client, window, nil
+	}
+	if client.versions != nil {
+		if version, ok := client.versions.clients[fingerprint]; ok {
+			return version, client.versions.windows[fingerprint], nil
+		}
+	}
+	return nil, MatrixWindow{}, ErrUnknownVersion
+}
+
+// QueryPKVersion returns the user's public key in the matrix version
+func (client *Client) QueryPKVersion(ident string, fingerprint Fingerprint) (*base.PublicKey, error) {
+	version, _, err := client.Version(fingerprint)
+	if err != nil {
+		return nil, err
+	}
+	return version.QueryPK(ident)
+}
+
+// VerifyVersioned verifies the signature with the user's key in the version it names,
+// the version must be valid at t
+func (client *Client) VerifyVersioned(ident string, m []byte, sig *VersionedSignature, t time.Time) error {
+	if sig == nil {
+		return ErrInvalidSignature
+	}
+	version, window, err := client.Version(sig.Version)
+	if err != nil {
+		return err
+	}
+	if !window.Contains(t) {
+		return ErrVersionNotValid
+	}
+	publicKey, err := version.QueryPK(ident)
+	if err != nil {
+		return err
+	}
+	if !publicKey.Verify(versionedMessage(sig.Version, m), &sig.Signature) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// KxSendVersioned starts a key exchange with the user's key in the newest version valid at t
+func (client *Client) KxSendVersioned(ident string, t time.Time) (*VersionedKx, [64]byte, error) {
+	for _, candidate := range client.Versions() {
+		if !candidate.Window.Contains(t) {
+			continue
+		}
+		publicKey, err := client.QueryPKVersion(ident, candidate.Fingerprint)
+		if err != nil {
+			return nil, [64]byte{}, err
+		}
+		sent, kx, err := publicKey.KxSend()
+		if err != nil {
+			return nil, [64]byte{}, err
+		}
+		return &VersionedKx{Version: candidate.Fingerprint, Sent: sent}, kx, nil
+	}
+	return nil, [64]byte{}, ErrVersionNotValid
+}
+
+// RotatingCA issues keys from several matrix versions, during the overlap of two windows
+// both matrices issue keys so that users can migrate before the old matrix is retired
+type RotatingCA struct {
+	versions []rotatingVersion
+}
+
+type rotatingVersion struct {
+	ca      *CA
+	version MatrixVersion
+	client  *Client
+}
+
+// AddVersion adds the matrix of the CA issuing within the window and returns its fingerprint
+func (rotating *RotatingCA) AddVersion(ca *CA, window MatrixWindow) (Fingerprint, error) {
+	if err := window.Validate(); err != nil {
+		return Fingerprint{}, err
+	}
+	client := &Client{}
+	if err := ca.ExportPublicMatrixForClient(client); err != nil {
+		return Fingerprint{}, err
+	}
+	client, err := client.WithDomain(ca.domain)
+	if err != nil {
+		return Fingerprint{}, err
+	}
+	fingerprint, err := client.Fingerprint()
+	if err != nil {
+		return Fingerprint{}, err
+	}
+	entry := rotatingVersion{ca: ca, version: MatrixVersion{Fingerprint: fingerprint, Window: window}, client: client}
+	for i := range rotating.versions {
+		if rotating.versions[i].version.Fingerprint == fingerprint {
+			rotating.versions[i] = entry
+			return fingerprint, nil
+		}
+	}
+	rotating.versions = append(rotating.versions, entry)
+	sort.SliceStable(rotating.versions, func(i, j int) bool {
+		return rotating.versions[i].version.Window.NotBefore.After(rotating.versions[j].version.Window.NotBefore)
+	})
+	return fingerprint, nil
+}
+
+// RemoveVersion retires the matrix version
+func (rotating *RotatingCA) RemoveVersion(fingerprint Fingerprint) {
+	for i := range rotating.versions {
+		if rotating.versions[i].version.Fingerprint == fingerprint {
+			rotating.versions = append(rotating.versions[:i], rotating.versions[i+1:]...)
+			return
+		}
+	}
+}
+
+// Versions returns the matrix versions, the newest window first
+func (rotating *RotatingCA) Versions() []MatrixVersion {
+	versions := make([]MatrixVersion, len(rotating.versions))
+	for i := range rotating.versions {
+		versions[i] = rotating.versions[i].version
+	}
+	return versions
+}
+
+// QuerySK returns the user's private keys of every version issuing at t, the newest first
+func (rotating *RotatingCA) QuerySK(ident string, t time.Time) ([]VersionedPrivateKey, error) {
+	var keys []VersionedPrivateKey
+	for _, entry := range rotating.versions {
+		if !entry.version.Window.Contains(t) {
+			continue
+		}
+		privateKey, err := entry.ca.QuerySK(ident)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, VersionedPrivateKey{Version: entry.version.Fingerprint, PrivateKey: privateKey})
+	}
+	if len(keys) == 0 {
+		return nil, ErrVersionNotValid
+	}
+	return keys, nil
+}
+
+// ExportClient returns a client holding every matrix version with its window, the
+// newest version is the client's own matrix
+//
+// 导出的客户端没有固定根公钥；需要固定根公钥的客户端应通过 LoadSignedMatrix 加载矩阵，
+// 再以 AddVersion 添加带签名清单的版本
+func (rotating *RotatingCA) ExportClient() (*Client, error) {
+	if len(rotating.versions) == 0 {
+		return nil, ErrMatrixNotLoaded
+	}
+	newest := rotating.versions[0]
+	client := &Client{}
+	if err := newest.ca.ExportPublicMatrixForClient(client); err != nil {
+		return nil, err
+	}
+	client, err := client.WithDomain(newest.ca.domain)
+	if err != nil {
+		return nil, err
+	}
+	if err = client.SetVersionWindow(newest.version.Fingerprint, newest.version.Window); err != nil {
+		return nil, err
+	}
+	for _, entry := range rotating.versions[1:] {
+		if err = client.AddVersion(entry.client, entry.version.Window); err != nil {
+			return nil, err
+		}
+	}
+	return client, nil
+}
@@ -0,0 +1,204 @@
+package cpk
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/walegarrett/cpk-algs/base"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMatrixWindow_Contains(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	window := MatrixWindow{NotBefore: start, NotAfter: start.Add(time.Hour)}
+	require.NoError(t, window.Validate())
+	require.False(t, window.Contains(start.Add(-time.Second)))
+	require.True(t, window.Contains(start))
+	require.True(t, window.Contains(start.Add(time.Hour-time.Second)))
+	require.False(t, window.Contains(start.Add(time.Hour)))
+	require.True(t, MatrixWindow{}.Contains(start))
+	require.ErrorIs(t, MatrixWindow{NotBefore: start, NotAfter: start}.Validate(), ErrInvalidParams)
+}
+
+func TestRotatingCA(t *testing.T) {
+	params := Params{Rows: 16, SubsSize: 4, Blocks: 4, Threshold: 2, Nodes: 3}
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var oldCA, newCA CA
+	require.NoError(t, oldCA.InitCAWithParams(params, "old_key"))
+	require.NoError(t, newCA.InitCAWithParams(params, "new_key"))
+
+	// 迁移窗口为第 10 天至第 20 天
+	var rotating RotatingCA
+	_, err := rotating.ExportClient()
+	require.ErrorIs(t, err, ErrMatrixNotLoaded)
+	oldVersion, err := rotating.AddVersion(&oldCA, MatrixWindow{NotBefore: start, NotAfter: start.AddDate(0, 0, 20)})
+	require.NoError(t, err)
+	newVersion, err := rotating.AddVersion(&newCA, MatrixWindow{NotBefore: start.AddDate(0, 0, 10)})
+	require.NoError(t, err)
+	require.NotEqual(t, oldVersion, newVersion)
+	versions := rotating.Versions()
+	require.Len(t, versions, 2)
+	require.Equal(t, newVersion, versions[0].Fingerprint)
+
+	keys, err := rotating.QuerySK("alice", start.AddDate(0, 0, 1))
+	require.NoError(t, err)
+	require.Len(t, keys, 1)
+	require.Equal(t, oldVersion, keys[0].Version)
+	keys, err = rotating.QuerySK("alice", start.AddDate(0, 0, 15))
+	require.NoError(t, err)
+	require.Len(t, keys, 2)
+	require.Equal(t, newVersion, keys[0].Version)
+	_, err = rotating.QuerySK("alice", start.AddDate(0, 0, -1))
+	require.ErrorIs(t, err, ErrVersionNotValid)
+
+	client, err := rotating.ExportClient()
+	require.NoError(t, err)
+	require.Equal(t, versions, client.Versions())
+	m := []byte("message")
+	for _, key := range keys {
+		sig := key.Sign(m)
+		require.NoError(t, client.VerifyVersioned("alice", m, sig, start.AddDate(0, 0, 15)))
+		require.ErrorIs(t, client.VerifyVersioned("bob", m, sig, start.AddDate(0, 0, 15)), ErrInvalidSignature)
+
+		var serializer base.Serializer
+		sig.Serialize(&serializer)
+		deserializer, err := base.NewDeserializer(serializer)
+		require.NoError(t, err)
+		var decoded VersionedSignature
+		require.NoError(t, decoded.Deserialize(deserializer))
+		require.NoError(t, client.VerifyVersioned("alice", m, &decoded, start.AddDate(0, 0, 15)))
+	}
+
+	// 旧矩阵的签名在窗口结束后不再有效，版本也不能被替换
+	oldSig := keys[1].Sign(m)
+	require.ErrorIs(t, client.VerifyVersioned("alice", m, oldSig, start.AddDate(0, 0, 20)), ErrVersionNotValid)
+	moved := *oldSig
+	moved.Version = newVersion
+	require.ErrorIs(t, client.VerifyVersioned("alice", m, &moved, start.AddDate(0, 0, 15)), ErrInvalidSignature)
+	moved.Version = Fingerprint{1}
+	require.ErrorIs(t, client.VerifyVersioned("alice", m, &moved, start.AddDate(0, 0, 15)), ErrUnknownVersion)
+
+	// 密钥交换使用当时最新的有效版本
+	header, sent, err := client.KxSendVersioned("alice", start.AddDate(0, 0, 5))
+	require.NoError(t, err)
+	require.Equal(t, oldVersion, header.Version)
+	_, err = keys[0].KxReceive(header)
+	require.ErrorIs(t, err, ErrVersionMismatch)
+	received, err := keys[1].KxReceive(header)
+	require.NoError(t, err)
+	require.Equal(t, sent, received)
+	header, _, err = client.KxSendVersioned("alice", start.AddDate(0, 0, 15))
+	require.NoError(t, err)
+	require.Equal(t, newVersion, header.Version)
+	_, _, err = client.KxSendVersioned("alice", start.AddDate(0, 0, -1))
+	require.ErrorIs(t, err, ErrVersionNotValid)
+
+	// 退役旧矩阵
+	rotating.RemoveVersion(oldVersion)
+	client.RemoveVersion(oldVersion)
+	_, err = client.QueryPKVersion("alice", oldVersion)
+	require.ErrorIs(t, err, ErrUnknownVersion)
+	require.Len(t, client.Versions(), 1)
+}
+
+func TestClient_WithDomainKeepsVersions(t *testing.T) {
+	var oldCA, newCA CA
+	require.NoError(t, oldCA.InitCA("old_key"))
+	require.NoError(t, newCA.InitCA("new_key"))
+	var client, oldClient Client
+	require.NoError(t, newCA.ExportPublicMatrixForClient(&client))
+	require.NoError(t, oldCA.ExportPublicMatrixForClient(&oldClient))
+	require.NoError(t, client.AddVersion(&oldClient, MatrixWindow{}))
+	oldVersion, err := oldClient.Fingerprint()
+	require.NoError(t, err)
+
+	domain := Domain{Namespace: "mail", Version: 1}
+	mailClient, err := client.WithDomain(domain)
+	require.NoError(t, err)
+	mailCA, err := oldCA.WithDomain(domain)
+	require.NoError(t, err)
+	sk, err := mailCA.QuerySK("alice")
+	require.NoError(t, err)
+	pk, err := mailClient.QueryPKVersion("alice", oldVersion)
+	require.NoError(t, err)
+	require.Equal(t, 1, pk.Equal(sk.Public().Point))
+	// 原客户端的版本不受影响
+	pk, err = client.QueryPKVersion("alice", oldVersion)
+	require.NoError(t, err)
+	require.NotEqual(t, 1, pk.Equal(sk.Public().Point))
+}
+
+func TestClient_AddVersionConcurrently(t *testing.T) {
+	var ca, oldCA, newCA CA
+	require.NoError(t, ca.InitCA("key"))
+	require.NoError(t, oldCA.InitCA("old_key"))
+	require.NoError(t, newCA.InitCA("new_key"))
+	var client, oldClient, newClient Client
+	require.NoError(t, ca.ExportPublicMatrixForClient(&client))
+	require.NoError(t, oldCA.ExportPublicMatrixForClient(&oldClient))
+	require.NoError(t, newCA.ExportPublicMatrixForClient(&newClient))
+
+	var wg sync.WaitGroup
+	for _, version := range []*Client{&oldClient, &newClient} {
+		wg.Add(1)
+		go func(version *Client) {
+			defer wg.Done()
+			assert.NoError(t, client.AddVersion(version, MatrixWindow{}))
+			_, err := client.WithDomain(Domain{Namespace: "mail", Version: 1})
+			assert.NoError(t, err)
+		}(version)
+	}
+	wg.Wait()
+	require.Len(t, client.Versions(), 3)
+
+	// 未加载矩阵的客户端没有版本集合
+	var empty Client
+	require.ErrorIs(t, empty.AddVersion(&oldClient, MatrixWindow{}), ErrMatrixNotLoaded)
+}
+
+func TestClient_AddVersionRequiresSignedManifest(t *testing.T) {
+	params := Params{Rows: 16, SubsSize: 4, Blocks: 4, Threshold: 2, Nodes: 3}
+	root := base.RandomPrivateKey()
+	var oldCA, newCA, attackerCA CA
+	require.NoError(t, oldCA.InitCAWithParams(params, "old_key"))
+	require.NoError(t, newCA.InitCAWithParams(params, "new_key"))
+	require.NoError(t, attackerCA.InitCAWithParams(params, "attacker_key"))
+
+	signedClient := func(ca *CA, signer *base.PrivateKey) *Client {
+		manifest, err := ca.ExportManifest(signer, 1)
+		require.NoError(t, err)
+		var exported Client
+		require.NoError(t, ca.ExportPublicMatrixForClient(&exported))
+		client := &Client{}
+		client.PinRoot(signer.Public())
+		require.NoError(t, client.LoadSignedMatrix(manifest, exported.publicMatrix))
+		return client
+	}
+	client := signedClient(&oldCA, &root)
+
+	// 未签名的矩阵不能作为版本加入固定了根公钥的客户端
+	var unsigned Client
+	require.NoError(t, attackerCA.ExportPublicMatrixForClient(&unsigned))
+	require.ErrorIs(t, client.AddVersion(&unsigned, MatrixWindow{}), ErrManifestRequired)
+	attackerRoot := base.RandomPrivateKey()
+	require.ErrorIs(t, client.AddVersion(signedClient(&attackerCA, &attackerRoot), MatrixWindow{}), ErrInvalidManifest)
+	require.Len(t, client.Versions(), 1)
+
+	m := []byte("message")
+	attackerKey, err := attackerCA.QuerySK("alice")
+	require.NoError(t, err)
+	unsignedFingerprint, err := unsigned.Fingerprint()
+	require.NoError(t, err)
+	forged := (&VersionedPrivateKey{Version: unsignedFingerprint, PrivateKey: attackerKey}).Sign(m)
+	require.ErrorIs(t, client.VerifyVersioned("alice", m, forged, time.Now()), ErrUnknownVersion)
+
+	require.NoError(t, client.AddVersion(signedClient(&newCA, &root), MatrixWindow{}))
+	require.Len(t, client.Versions(), 2)
+	newKey, err := newCA.QuerySK("alice")
+	require.NoError(t, err)
+	newFingerprint, err := signedClient(&newCA, &root).Fingerprint()
+	require.NoError(t, err)
+	sig := (&VersionedPrivateKey{Version: newFingerprint, PrivateKey: newKey}).Sign(m)
+	require.NoError(t, client.VerifyVersioned("alice", m, sig, time.Now()))
+}
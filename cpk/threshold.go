@@ -0,0 +1,198 @@
+package cpk
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"github.com/walegarrett/cpk-algs/base"
+	"github.com/walegarrett/cpk-algs/base/edwards25519"
+	"sort"
+)
+
+// scalarFromInt converts a non-negative integer to a scalar
+func scalarFromInt(v int64) *edwards25519.Scalar {
+	var buf [32]byte
+	binary.LittleEndian.PutUint64(buf[:8], uint64(v))
+	scalar, err := (&edwards25519.Scalar{}).SetCanonicalBytes(buf[:])
+	if err != nil {
+		panic(err)
+	}
+	return scalar
+}
+
+// shareX returns the x coordinate of the share held by the node with the given index
+// 节点序号从0开始，x坐标从1开始（x=0处为秘密本身）
+func shareX(index int64) *edwards25519.Scalar {
+	return scalarFromInt(index + 1)
+}
+
+// evalPolynomial evaluates coefficients[0] + coefficients[1]*x + ... at x
+func evalPolynomial(coefficients []*edwards25519.Scalar, x *edwards25519.Scalar) *edwards25519.Scalar {
+	res := edwards25519.NewScalar()
+	for j := len(coefficients) - 1; j >= 0; j-- {
+		res.MultiplyAdd(res, x, coefficients[j])
+	}
+	return res
+}
+
+// lagrangeCoefficients returns the lagrange coefficients of the nodes for
+// interpolating the polynomial at the node at, at = -1 means the secret itself
+func lagrangeCoefficients(indices []int64, at int64) []*edwards25519.Scalar {
+	x := shareX(at)
+	coefficients := make([]*edwards25519.Scalar, len(indices))
+	for i, index := range indices {
+		xi := shareX(index)
+		num := scalarFromInt(1)
+		den := scalarFromInt(1)
+		for j, other := range indices {
+			if i == j {
+				continue
+			}
+			xj := shareX(other)
+			num.Multiply(num, edwards25519.NewScalar().Subtract(x, xj))
+			den.Multiply(den, edwards25519.NewScalar().Subtract(xi, xj))
+		}
+		coefficients[i] = num.Multiply(num, den.Invert(den))
+	}
+	return coefficients
+}
+
+// sortedIndices returns the keys of the map in ascending order
+func sortedIndices[T any](m map[int64]T) []int64 {
+	indices := make([]int64, 0, len(m))
+	for index := range m {
+		indices = append(indices, index)
+	}
+	sort.Slice(indices, func(i, j int) bool {
+		return indices[i] < indices[j]
+	})
+	return indices
+}
+
+// Commitments defines the Feldman commitments of the private matrix polynomials
+type Commitments struct {
+	// 门限，每个矩阵元素对应 Threshold 个承诺点
+	Threshold int
+	// Points[e*Threshold+j] 为第 e 个元素多项式第 j 个系数与基点的乘积
+	Points []base.Ed25519Point
+}
+
+// Size returns the number of matrix elements committed to
+func (commitments *Commitments) Size() int {
+	if commitments.Threshold <= 0 {
+		return 0
+	}
+	return len(commitments.Points) / commitments.Threshold
+}
+
+// PublicMatrix returns the public matrix, which is the commitment to the constant terms
+func (commitments *Commitments) PublicMatrix() []base.Ed25519Point {
+	publicMatrix := make([]base.Ed25519Point, commitments.Size())
+	for e := range publicMatrix {
+		publicMatrix[e] = commitments.Points[e*commitments.Threshold]
+	}
+	return publicMatrix
+}
+
+// SharePublic returns the commitment to the share of element e held by the node with the given index
+func (commitments *Commitments) SharePublic(index int64, e int) (*edwards25519.Point, error) {
+	if index < 0 {
+		return nil, ErrIndexOutOfRange
+	}
+	if e < 0 || e >= commitments.Size() {
+		return nil, &ErrMatrixSizeMismatch{Expected: commitments.Size(), Actual: e + 1}
+	}
+	x := shareX(index)
+	// 承诺与节点序号都是公开的，使用变时的多标量乘法计算 Σ x^j·C_j
+	scalars := make([]*edwards25519.Scalar, commitments.Threshold)
+	points := make([]*edwards25519.Point, commitments.Threshold)
+	power := scalarFromInt(1)
+	for j := range scalars {
+		scalars[j] = edwards25519.NewScalar().Set(power)
+		points[j] = commitments.Points[e*commitments.Threshold+j].Point
+		power.Multiply(power, x)
+	}
+	return (&edwards25519.Point{}).VarTimeMultiScalarMult(scalars, points), nil
+}
+
+// VerifyShares checks the shares of the node with the given index against the commitments
+func (commitments *Commitments) VerifyShares(index int64, shares []base.Ed25519Scala) error {
+	if err := checkScalars(shares, commitments.Size()); err != nil {
+		return err
+	}
+	publicShares := make([]base.Ed25519Point, len(shares))
+	_ = parallelFor(context.Background(), len(shares), func(e int) error {
+		publicShares[e].Point = (&edwards25519.Point{}).ScalarBaseMult(shares[e].Scalar)
+		return nil
+	})
+	return commitments.VerifyPublicShares(index, publicShares)
+}
+
+// VerifyPublicShares checks the shares multiplied by the base point against the commitments
+func (commitments *Commitments) VerifyPublicShares(index int64, publicShares []base.Ed25519Point) error {
+	if err := checkPoints(publicShares, commitments.Size()); err != nil {
+		return err
+	}
+	// 并行检查各元素，出错时返回位置最小的不一致元素
+	return parallelFor(context.Background(), len(publicShares), func(e int) error {
+		expected, err := commitments.SharePublic(index, e)
+		if err != nil {
+			return err
+		}
+		if publicShares[e].Equal(expected) != 1 {
+			return &ErrInconsistentPiece{Index: index, Position: e}
+		}
+		return nil
+	})
+}
+
+func (commitments *Commitments) Serialize(serializer *base.Serializer) {
+	serializer.WriteInt64(int64(commitments.Threshold))
+	serializer.WriteInt64(int64(len(commitments.Points)))
+	for index := range commitments.Points {
+		serializer.WriteSerializable(&commitments.Points[index])
+	}
+}
+
+func (commitments *Commitments) Deserialize(deserializer *base.DeSerializer) error {
+	var threshold, l int64
+	_, err := deserializer.ReadInt64(&threshold)
+	if err != nil {
+		return err
+	}
+	_, err = deserializer.ReadInt64(&l)
+	if err != nil {
+		return err
+	}
+	if threshold <= 0 || l%threshold != 0 {
+		return fmt.Errorf("%w: bad commitments size", ErrInvalidFormat)
+	}
+	commitments.Threshold = int(threshold)
+	commitments.Points, err = readPoints(deserializer, l)
+	return err
+}
+
+// dealShares splits every element of the matrix into shares with the given polynomial coefficients
+// coefficients[e][j] 为第 e 个元素多项式的第 j 个系数
+func dealShares(params Params, coefficients [][]*edwards25519.Scalar) ([]DistributedCA, *Commitments) {
+	commitments := &Commitments{Threshold: params.Threshold}
+	commitments.Points = make([]base.Ed25519Point, len(coefficients)*params.Threshold)
+	_ = parallelFor(context.Background(), len(coefficients), func(e int) error {
+		for j, coefficient := range coefficients[e] {
+			commitments.Points[e*params.Threshold+j].Point = (&edwards25519.Point{}).ScalarBaseMult(coefficient)
+		}
+		return nil
+	})
+	distributedCAs := make([]DistributedCA, params.Nodes)
+	for i := range distributedCAs {
+		distributedCAs[i].params = params
+		distributedCAs[i].Index = int64(i)
+		distributedCAs[i].privateMatrixPiece = make([]base.Ed25519Scala, len(coefficients))
+		x := shareX(int64(i))
+		for e := range coefficients {
+			distributedCAs[i].privateMatrixPiece[e].Scalar = evalPolynomial(coefficients[e], x)
+		}
+		distributedCAs[i].commitments = commitments
+	}
+	return distributedCAs, commitments
+}
@@ -0,0 +1,117 @@
+package cpk
+
+import (
+	"github.com/stretchr/testify/require"
+	"github.com/walegarrett/cpk-algs/base"
+	"github.com/walegarrett/cpk-algs/base/edwards25519"
+	"testing"
+)
+
+func TestLagrangeCoefficients(t *testing.T) {
+	coefficients := []*edwards25519.Scalar{
+		base.RandomPrivateKey().Scalar,
+		base.RandomPrivateKey().Scalar,
+		base.RandomPrivateKey().Scalar,
+	}
+	for _, indices := range [][]int64{{0, 1, 2}, {1, 3, 4}, {0, 2, 4, 5}} {
+		lambdas := lagrangeCoefficients(indices, -1)
+		secret := edwards25519.NewScalar()
+		for i, index := range indices {
+			share := evalPolynomial(coefficients, shareX(index))
+			secret.MultiplyAdd(lambdas[i], share, secret)
+		}
+		if secret.Equal(coefficients[0]) != 1 {
+			t.Error("interpolated secret mismatch:", indices)
+			return
+		}
+	}
+}
+
+func TestCA_SplitDistributedCAs(t *testing.T) {
+	params := Params{Rows: 16, SubsSize: 4, Blocks: 4, Threshold: 3, Nodes: 5}
+	var ca CA
+	err := ca.InitCAWithParams(params, "genkey1")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	distributedCAs, err := ca.SplitDistributedCAs()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(distributedCAs) != params.Nodes {
+		t.Error("bad distributed ca count:", len(distributedCAs))
+		return
+	}
+	for i := range distributedCAs {
+		if err = distributedCAs[i].VerifyShares(); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+
+	// 公钥矩阵即常数项的承诺
+	caClient := Client{}
+	require.NoError(t, ca.ExportPublicMatrixForClient(&caClient))
+	commitments, err := distributedCAs[0].ExportCommitments()
+	require.NoError(t, err)
+	publicMatrix := commitments.PublicMatrix()
+	for e := range publicMatrix {
+		if publicMatrix[e].Equal(caClient.QueryPublicKeyMatrix()[e].Point) != 1 {
+			t.Error("commitments not match public matrix")
+			return
+		}
+	}
+
+	var pmPieces []PMPiece
+	for _, node := range []int{4, 1, 2} {
+		pmPiece, err := distributedCAs[node].ExportPublicMatrixPiece()
+		require.NoError(t, err)
+		pmPieces = append(pmPieces, pmPiece)
+	}
+	client := Client{params: params}
+	require.NoError(t, client.CombinePMPieces(pmPieces))
+	pk, err := client.QueryPK("alice")
+	require.NoError(t, err)
+	expected, err := caClient.QueryPK("alice")
+	require.NoError(t, err)
+	if pk.Equal(expected.Point) != 1 {
+		t.Error("combined public matrix mismatch")
+		return
+	}
+
+	sk, err := ca.QuerySK("alice")
+	require.NoError(t, err)
+	skPieces := make([]SKPiece, len(distributedCAs))
+	for i := range distributedCAs {
+		skPieces[i], err = distributedCAs[i].QuerySK("alice")
+		require.NoError(t, err)
+	}
+	for _, nodes := range [][]int{{0, 1, 2}, {2, 3, 4}, {0, 2, 4}, {0, 1, 2, 3, 4}} {
+		var selected []SKPiece
+		for _, node := range nodes {
+			selected = append(selected, skPieces[node])
+		}
+		privateKey, err := client.CombineSKPieces(selected, *pk)
+		if err != nil {
+			t.Error("combine private key pieces failed:", nodes, err)
+			return
+		}
+		if privateKey.Scalar.Equal(sk.Scalar) != 1 {
+			t.Error("combined private key mismatch:", nodes)
+			return
+		}
+	}
+
+	// 少于门限的分片无法组合出私钥
+	_, err = client.CombineSKPieces(skPieces[:2], *pk)
+	require.ErrorIs(t, err, ErrInsufficientPieces)
+
+	// 篡改后的分片无法通过承诺校验
+	distributedCAs[1].privateMatrixPiece[7] = *base.NewEd25519Scala()
+	var inconsistent *ErrInconsistentPiece
+	require.ErrorAs(t, distributedCAs[1].VerifyShares(), &inconsistent)
+	require.Equal(t, int64(1), inconsistent.Index)
+	require.Equal(t, 7, inconsistent.Position)
+}
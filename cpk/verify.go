@@ -0,0 +1,114 @@
+package cpk
+
+import (
+	"errors"
+	"github.com/walegarrett/cpk-algs/base"
+	"github.com/walegarrett/cpk-algs/base/edwards25519"
+)
+
+// CombineResult is the result of combining verified sk pieces
+type CombineResult struct {
+	PrivateKey base.PrivateKey
+	// 未通过部分公钥校验，或者序号未知、越界而无法校验的节点序号
+	Faulty []int64
+}
+
+// partialPK returns the sum of the piece elements at the given indices
+func (pmPiece *PMPiece) partialPK(indices []int) *base.PublicKey {
+	sum := edwards25519.NewIdentityPoint()
+	for _, index := range indices {
+		sum.Add(sum, pmPiece.Piece[index].Point)
+	}
+	var publicKey base.PublicKey
+	publicKey.Point = sum
+	return &publicKey
+}
+
+// PartialPK returns the public key of the sk piece the node with the given index issues for ident
+func (client *Client) PartialPK(ident string, index int64) (*base.PublicKey, error) {
+	encoded, err := client.domain.plainIdent(ident)
+	if err != nil {
+		return nil, err
+	}
+	return client.partialPK(encoded, index)
+}
+
+func (client *Client) partialPK(ident []byte, index int64) (*base.PublicKey, error) {
+	pmPiece, ok := client.pmPieces[index]
+	if !ok {
+		return nil, ErrPartialKeyUnavailable
+	}
+	indices, err := client.Params().selectIndices(client.domain.encodeIdent(ident))
+	if err != nil {
+		return nil, err
+	}
+	return pmPiece.partialPK(indices), nil
+}
+
+// VerifySKPiece checks the sk piece against the partial public key of the node that issued it
+func (client *Client) VerifySKPiece(ident string, skPiece SKPiece) error {
+	encoded, err := client.domain.plainIdent(ident)
+	if err != nil {
+		return err
+	}
+	return client.verifySKPiece(encoded, skPiece)
+}
+
+func (client *Client) verifySKPiece(ident []byte, skPiece SKPiece) error {
+	partial, err := client.partialPK(ident, skPiece.Index)
+	if err != nil {
+		return err
+	}
+	if skPiece.Secret.Scalar == nil {
+		return &ErrFaultyPiece{Index: skPiece.Index}
+	}
+	point := (&edwards25519.Point{}).ScalarBaseMult(skPiece.Secret.Scalar)
+	if point.Equal(partial.Point) != 1 {
+		return &ErrFaultyPiece{Index: skPiece.Index}
+	}
+	return nil
+}
+
+// CombineVerifiedSKPieces checks every sk piece against its partial public key, drops the
+// faulty ones and combines the rest, the result reports the faulty node indices. A piece of
+// a node the client holds no PMPiece of is faulty too, unless the client holds no PMPiece at all
+func (client *Client) CombineVerifiedSKPieces(ident string, skPieces []SKPiece) (CombineResult, error) {
+	encoded, err := client.domain.plainIdent(ident)
+	if err != nil {
+		return CombineResult{}, err
+	}
+	return client.combineVerifiedSKPieces(encoded, skPieces)
+}
+
+// CombineVerifiedSKPiecesAt is CombineVerifiedSKPieces for the user's epoch key
+func (client *Client) CombineVerifiedSKPiecesAt(ident string, epoch Epoch, skPieces []SKPiece) (CombineResult, error) {
+	encoded, err := epoch.encodeIdent(ident)
+	if err != nil {
+		return CombineResult{}, err
+	}
+	return client.combineVerifiedSKPieces(encoded, skPieces)
+}
+
+func (client *Client) combineVerifiedSKPieces(ident []byte, skPieces []SKPiece) (CombineResult, error) {
+	var result CombineResult
+	publicKey, err := client.queryPK(ident)
+	if err != nil {
+		return result, err
+	}
+	var honest []SKPiece
+	for _, skPiece := range skPieces {
+		err = client.verifySKPiece(ident, skPiece)
+		var faulty *ErrFaultyPiece
+		// 客户端持有分片时，序号未知的分片不可能来自合法节点；完全没有分片时无法校验任何分片
+		if errors.As(err, &faulty) || (errors.Is(err, ErrPartialKeyUnavailable) && len(client.pmPieces) > 0) {
+			result.Faulty = append(result.Faulty, skPiece.Index)
+			continue
+		}
+		if err != nil {
+			return result, err
+		}
+		honest = append(honest, skPiece)
+	}
+	result.PrivateKey, err = client.CombineSKPieces(honest, *publicKey)
+	return result, err
+}
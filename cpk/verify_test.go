@@ -0,0 +1,104 @@
+package cpk
+
+import (
+	"github.com/stretchr/testify/require"
+	"github.com/walegarrett/cpk-algs/base"
+	"testing"
+)
+
+func TestClient_CombineVerifiedSKPieces(t *testing.T) {
+	params := Params{Rows: 16, SubsSize: 4, Blocks: 4, Threshold: 2, Nodes: 4}
+	var ca CA
+	require.NoError(t, ca.InitCAWithParams(params, "genkey1"))
+	distributedCAs, err := ca.SplitDistributedCAs()
+	require.NoError(t, err)
+	var pmPieces []PMPiece
+	for i := range distributedCAs {
+		pmPiece, err := distributedCAs[i].ExportPublicMatrixPiece()
+		require.NoError(t, err)
+		pmPieces = append(pmPieces, pmPiece)
+	}
+	client := Client{params: params}
+	require.NoError(t, client.CombinePMPieces(pmPieces))
+
+	skPieces := make([]SKPiece, len(distributedCAs))
+	for i := range distributedCAs {
+		skPieces[i], err = distributedCAs[i].QuerySK("alice")
+		require.NoError(t, err)
+		require.NoError(t, client.VerifySKPiece("alice", skPieces[i]))
+		partial, err := client.PartialPK("alice", int64(i))
+		require.NoError(t, err)
+		require.Equal(t, 1, partial.Equal((&base.PrivateKey{Scalar: skPieces[i].Secret.Scalar}).Public().Point))
+	}
+
+	// 节点1和节点3返回了错误的分片
+	bad := base.RandomPrivateKey()
+	skPieces[1].Secret.Scalar = bad.Scalar
+	skPieces[3] = SKPiece{Index: 3, Secret: skPieces[0].Secret}
+	var faulty *ErrFaultyPiece
+	require.ErrorAs(t, client.VerifySKPiece("alice", skPieces[1]), &faulty)
+	require.Equal(t, int64(1), faulty.Index)
+
+	result, err := client.CombineVerifiedSKPieces("alice", skPieces)
+	require.NoError(t, err)
+	require.Equal(t, []int64{1, 3}, result.Faulty)
+	sk, err := ca.QuerySK("alice")
+	require.NoError(t, err)
+	require.Equal(t, 1, result.PrivateKey.Scalar.Equal(sk.Scalar))
+
+	// 剩余的诚实分片不足门限
+	result, err = client.CombineVerifiedSKPieces("alice", skPieces[1:])
+	require.ErrorIs(t, err, ErrInsufficientPieces)
+	require.Equal(t, []int64{1, 3}, result.Faulty)
+
+	caClient := Client{}
+	require.NoError(t, ca.ExportPublicMatrixForClient(&caClient))
+	_, err = caClient.PartialPK("alice", 0)
+	require.ErrorIs(t, err, ErrPartialKeyUnavailable)
+}
+
+func TestClient_CombineVerifiedSKPiecesAt(t *testing.T) {
+	var distributedCAs [4]DistributedCA
+	var pmPieces []PMPiece
+	for i := range distributedCAs {
+		require.NoError(t, distributedCAs[i].InitDistributedCA(int64(i), "gen_key"))
+		pmPiece, err := distributedCAs[i].ExportPublicMatrixPiece()
+		require.NoError(t, err)
+		pmPieces = append(pmPieces, pmPiece)
+	}
+	client := Client{}
+	require.NoError(t, client.CombinePMPieces(pmPieces[1:]))
+
+	epoch := Epoch{Granularity: EpochDay, Number: 19782}
+	var skPieces []SKPiece
+	for i := range distributedCAs {
+		skPiece, err := distributedCAs[i].QuerySKAt("alice", epoch)
+		require.NoError(t, err)
+		skPieces = append(skPieces, skPiece)
+	}
+	// 客户端没有节点0的公钥矩阵分片，无法校验其私钥分片，作为错误分片丢弃
+	result, err := client.CombineVerifiedSKPiecesAt("alice", epoch, skPieces)
+	require.NoError(t, err)
+	require.Equal(t, []int64{0}, result.Faulty)
+	pk, err := client.QueryPKAt("alice", epoch)
+	require.NoError(t, err)
+	require.Equal(t, 1, pk.Equal(result.PrivateKey.Public().Point))
+
+	result, err = client.CombineVerifiedSKPiecesAt("alice", epoch, skPieces[1:])
+	require.NoError(t, err)
+	require.Empty(t, result.Faulty)
+	require.Equal(t, 1, pk.Equal(result.PrivateKey.Public().Point))
+
+	// 序号越界的分片同样被丢弃
+	outOfRange := append([]SKPiece{{Index: 7, Secret: skPieces[1].Secret}, {Index: -1, Secret: skPieces[2].Secret}}, skPieces[1:]...)
+	result, err = client.CombineVerifiedSKPiecesAt("alice", epoch, outOfRange)
+	require.NoError(t, err)
+	require.Equal(t, []int64{7, -1}, result.Faulty)
+	require.Equal(t, 1, pk.Equal(result.PrivateKey.Public().Point))
+
+	// 客户端没有任何分片时无法校验
+	published, err := NewClientWithParams(client.Params(), client.QueryPublicKeyMatrix())
+	require.NoError(t, err)
+	_, err = published.CombineVerifiedSKPiecesAt("alice", epoch, skPieces[1:])
+	require.ErrorIs(t, err, ErrPartialKeyUnavailable)
+}